@@ -16,9 +16,19 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 
@@ -32,9 +42,11 @@ func main() {
 	defer klog.Flush()
 	cfg := &hostpath.Config{}
 	var dataDir string
-	var metricsCertFile string
-	var metricsKeyFile string
-	var metricsTLSVersion string
+	var metricsCipherSuites string
+	var metricsAuth bool
+	var logFormat string
+	var tracingCfg hostpath.TracingConfig
+	metricsCfg := hostpath.MetricsServerConfig{}
 	klog.InitFlags(nil)
 	flag.Set("logtostderr", "true")
 	flag.StringVar(&cfg.Endpoint, "endpoint", "unix://tmp/csi.sock", "CSI endpoint")
@@ -42,25 +54,93 @@ func main() {
 	flag.StringVar(&dataDir, "datadir", "[{\"name\":\"legacy\",\"path\":\"/csi-data-dir\",\"snapshotPath\":\"/snap-dir\", \"snapshotProvider\":\"reflink\"}]", "storage pool array with each entry including, storage pool name, directory path, and optional snapshot directory path and snapshot provider, all of this in JSON format. Example: [{\"name\":\"legacy\",\"path\":\"/csi-data-dir\",\"snapshotPath\":\"/snap-dir\",\"snapshotProvider\":\"reflink\"}]")
 	flag.StringVar(&cfg.NodeID, "nodeid", "", "node id")
 	flag.StringVar(&cfg.Version, "version", "", "version of the plugin")
-	flag.StringVar(&metricsCertFile, "metrics-cert-file", "", "path to TLS certificate file for metrics server (optional, will use self-signed cert if not provided). Note: self-signed certs only include localhost+127.0.0.1 by default; set POD_IP (most important), POD_NAMESPACE, and SERVICE_NAME env vars for in-cluster SANs needed for certificate verification")
-	flag.StringVar(&metricsKeyFile, "metrics-key-file", "", "path to TLS key file for metrics server (optional, will use self-signed cert if not provided)")
-	flag.StringVar(&metricsTLSVersion, "metrics-tls-version", "VersionTLS13", "minimum TLS version for metrics server (VersionTLS10, VersionTLS11, VersionTLS12, or VersionTLS13)")
+	flag.StringVar(&cfg.GRPCCertFile, "grpc-tls-cert-file", "", "path to TLS certificate file for the CSI gRPC server (optional, only supported with tcp endpoints)")
+	flag.StringVar(&cfg.GRPCKeyFile, "grpc-tls-key-file", "", "path to TLS key file for the CSI gRPC server (optional, only supported with tcp endpoints)")
+	flag.StringVar(&cfg.GRPCClientCAFile, "grpc-tls-client-ca-file", "", "path to CA certificate file used to verify client certificates of the CSI gRPC server (optional, enables mutual TLS)")
+	flag.StringVar(&metricsCfg.Address, "metrics-bind-address", ":8443", "address and port the metrics server listens on")
+	flag.StringVar(&metricsCfg.Path, "metrics-path", "/metrics", "path the metrics are served on")
+	flag.StringVar(&metricsCfg.InsecureAddress, "metrics-insecure-bind-address", "", "loopback address and port on which the metrics are also served over plain HTTP without authentication, for sidecars (optional, for example 127.0.0.1:8080)")
+	flag.BoolVar(&metricsCfg.EnablePprof, "metrics-enable-pprof", false, "serve the /debug/pprof handlers on the metrics server, behind the same authentication and authorization as the metrics. Requires --metrics-auth or --metrics-client-ca-file")
+	flag.StringVar(&metricsCfg.CertFile, "metrics-cert-file", "", "path to TLS certificate file for metrics server, reloaded when it changes (optional, will use a self-signed cert, renewed before it expires, if not provided). Note: self-signed certs only include localhost+127.0.0.1 by default; set POD_IP (most important), POD_NAMESPACE, and SERVICE_NAME env vars for in-cluster SANs needed for certificate verification")
+	flag.StringVar(&metricsCfg.KeyFile, "metrics-key-file", "", "path to TLS key file for metrics server (optional, will use self-signed cert if not provided)")
+	flag.StringVar(&metricsCfg.TLSVersion, "metrics-tls-version", "VersionTLS13", "minimum TLS version for metrics server (VersionTLS10, VersionTLS11, VersionTLS12, or VersionTLS13)")
+	flag.StringVar(&metricsCipherSuites, "metrics-tls-cipher-suites", "", "comma separated list of cipher suites allowed by the metrics server, for example TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (optional, TLS 1.3 cipher suites are not configurable)")
+	flag.StringVar(&metricsCfg.ClientCAFile, "metrics-client-ca-file", "", "path to CA certificate file used to verify client certificates of the metrics server, reloaded when it changes (optional, enables mutual TLS)")
+	flag.BoolVar(&metricsAuth, "metrics-auth", false, "authenticate and authorize metrics requests with TokenReviews and SubjectAccessReviews, requires get access to the metrics path as a non-resource URL")
+	flag.StringVar(&tracingCfg.Endpoint, "tracing-endpoint", "", "host:port of the OTLP gRPC collector the traces of the CSI calls are exported to (optional, tracing is disabled when not set)")
+	flag.BoolVar(&tracingCfg.Insecure, "tracing-insecure", false, "connect to the OTLP collector without TLS")
+	flag.Float64Var(&tracingCfg.SamplingRatio, "tracing-sampling-ratio", 1, "fraction of the new traces that are sampled, traces started by the caller follow its sampling decision")
+	flag.StringVar(&logFormat, "log-format", hostpath.LogFormatText, "format of the log output, text or json")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "time to wait for in flight operations to complete when shutting down. Stopping the metrics server and flushing the traces take up to 10s more, so the terminationGracePeriodSeconds of the pod must be longer than the timeout plus 10s")
+	flag.IntVar(&cfg.MaxConcurrentSnapshots, "max-concurrent-snapshots", 0, "maximum number of snapshots and restores copying data at once on the node, 0 for no limit")
+	flag.IntVar(&cfg.MaxConcurrentDeletes, "max-concurrent-deletes", 0, "maximum number of volumes and snapshots being deleted at once on the node, 0 for no limit")
+	flag.DurationVar(&cfg.OperationQueueTimeout, "operation-queue-timeout", 10*time.Second, "time a snapshot, restore or delete over its concurrency limit waits before it is rejected with ResourceExhausted, 0 to reject it right away")
+	flag.BoolVar(&cfg.EnableModifyVolume, "enable-modify-volume", false, "advertise the MODIFY_VOLUME capability, so the mutable parameters of the volumes can be changed with a VolumeAttributesClass")
 	flag.Parse()
 
+	verbosity, _ := strconv.Atoi(flag.Lookup("v").Value.String())
+	if err := hostpath.SetLogFormat(logFormat, verbosity); err != nil {
+		klog.Errorf("Failed to set log format: %v", err)
+		os.Exit(1)
+	}
+
+	ctx := signals.SetupSignalHandler()
+
 	klog.V(1).Info("Starting Prometheus metrics endpoint server")
-	hostpath.RunPrometheusServer(":8443", metricsCertFile, metricsKeyFile, metricsTLSVersion)
+	if metricsCipherSuites != "" {
+		metricsCfg.CipherSuites = strings.Split(metricsCipherSuites, ",")
+	}
+	var client kubernetes.Interface
+	restConfig, err := rest.InClusterConfig()
+	if err == nil {
+		client, err = kubernetes.NewForConfig(restConfig)
+	}
+	if err != nil {
+		if metricsAuth {
+			klog.Errorf("Failed to create client for metrics authorization: %v", err)
+			os.Exit(1)
+		}
+		klog.Warningf("Not recording events, unable to create client: %v", err)
+	} else {
+		if metricsAuth {
+			metricsCfg.AuthClient = client
+		}
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events(v1.NamespaceAll)})
+		defer broadcaster.Shutdown()
+		cfg.EventRecorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: cfg.DriverName, Host: cfg.NodeID})
+	}
+	metricsServer, err := hostpath.RunPrometheusServer(ctx, metricsCfg)
+	if err != nil {
+		klog.Errorf("Failed to start Prometheus metrics endpoint server: %v", err)
+		os.Exit(1)
+	}
+
+	tracingCfg.ServiceName = cfg.DriverName
+	tracingCfg.ServiceVersion = cfg.Version
+	shutdownTracing, err := hostpath.SetupTracing(ctx, tracingCfg)
+	if err != nil {
+		klog.Errorf("Failed to set up tracing: %v", err)
+		os.Exit(1)
+	}
 
 	klog.V(1).Infof("Starting new HostPathDriver, config: %v", *cfg)
-	ctx := signals.SetupSignalHandler()
 	driver, err := hostpath.NewHostPathDriver(ctx, cfg, dataDir)
 	if err != nil {
 		klog.V(1).Infof("Failed to initialize driver: %s", err.Error())
 		os.Exit(1)
 	}
 
-	if err := driver.Run(); err != nil {
+	err = driver.Run(ctx)
+	metricsServer.Stop(5 * time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		klog.Errorf("Failed to flush traces: %v", err)
+	}
+	cancel()
+	if err != nil {
 		klog.V(1).Infof("Failed to run driver: %s", err.Error())
 		os.Exit(1)
-
 	}
+	klog.V(1).Info("Driver stopped")
 }
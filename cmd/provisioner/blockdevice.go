@@ -0,0 +1,218 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog/v2"
+
+	"kubevirt.io/hostpath-provisioner/controller"
+)
+
+const (
+	// blockImageFile is the preallocated image backing a block volume, in the
+	// directory of the volume.
+	blockImageFile = "block.img"
+	// blockDeviceLink is the symlink to the device link of the volume in
+	// blockDeviceDir. The PV points at it, so it stays valid when the loop
+	// device changes after a reboot.
+	blockDeviceLink = "block"
+)
+
+var (
+	losetupFunc = losetup
+	// blockDeviceDir has the links of the block volumes, named after their PV,
+	// to their loop device. It is in /dev, which does not survive a reboot any
+	// more than the loop devices do, so the links of the volumes dangle until
+	// their images are attached again rather than pointing at the loop device
+	// of another image.
+	blockDeviceDir = "/dev/hostpath-provisioner"
+)
+
+var _ controller.BlockProvisioner = &hostPathProvisioner{}
+
+// SupportsBlock returns true, block volumes are backed by loop devices.
+func (p *hostPathProvisioner) SupportsBlock() bool {
+	return true
+}
+
+func isBlockVolume(pv *v1.PersistentVolume) bool {
+	return pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock
+}
+
+// volumeDirectory returns the directory of the volume, which is the hostPath
+// of filesystem volumes and holds the image and device link of block volumes.
+func volumeDirectory(pv *v1.PersistentVolume) string {
+	if pv.Spec.Local != nil {
+		return filepath.Dir(pv.Spec.Local.Path)
+	}
+	if pv.Spec.HostPath != nil {
+		return pv.Spec.HostPath.Path
+	}
+	return ""
+}
+
+func losetup(args ...string) (string, error) {
+	out, err := exec.Command("losetup", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("losetup %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// createBlockDevice preallocates the image of the block volume of the PV
+// pvName of size bytes in dir, and attaches it to a loop device.
+func createBlockDevice(dir, pvName string, size int64) error {
+	image := filepath.Join(dir, blockImageFile)
+	glog.Infof("preallocating block image: %v", image)
+	f, err := os.OpenFile(image, os.O_WRONLY|os.O_CREATE, 0660)
+	if err != nil {
+		return err
+	}
+	err = unix.Fallocate(int(f.Fd()), 0, 0, size)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to preallocate %s: %w", image, err)
+	}
+	return attachBlockDevice(dir, pvName)
+}
+
+// attachBlockDevice attaches the image in dir to a loop device, unless it is
+// attached already, and points the device links of the PV pvName at the loop
+// device.
+func attachBlockDevice(dir, pvName string) error {
+	image := filepath.Join(dir, blockImageFile)
+	devices, err := loopDevices(image)
+	if err != nil {
+		return err
+	}
+	var device string
+	if len(devices) > 0 {
+		device = devices[0]
+	} else {
+		glog.Infof("attaching block image: %v", image)
+		if device, err = losetupFunc("--find", "--show", image); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(blockDeviceDir, 0755); err != nil {
+		return err
+	}
+	deviceLink := filepath.Join(blockDeviceDir, pvName)
+	if err := replaceSymlink(deviceLink, device); err != nil {
+		return err
+	}
+	return replaceSymlink(filepath.Join(dir, blockDeviceLink), deviceLink)
+}
+
+// replaceSymlink points link at target, replacing it atomically since it may
+// be in use by the PV already.
+func replaceSymlink(link, target string) error {
+	if current, err := os.Readlink(link); err == nil && current == target {
+		return nil
+	}
+	tmpLink := link + ".tmp"
+	if err := os.Remove(tmpLink); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, tmpLink); err != nil {
+		return err
+	}
+	return os.Rename(tmpLink, link)
+}
+
+// removeDeviceLink removes the device link of the PV pvName, so its volume
+// cannot be mapped until its image is attached again.
+func removeDeviceLink(pvName string) error {
+	if err := os.Remove(filepath.Join(blockDeviceDir, pvName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// detachBlockDevice removes the device link of the PV pvName, and detaches
+// the loop devices of the image in dir.
+func detachBlockDevice(dir, pvName string) error {
+	if err := removeDeviceLink(pvName); err != nil {
+		return err
+	}
+	image := filepath.Join(dir, blockImageFile)
+	if _, err := os.Stat(image); os.IsNotExist(err) {
+		return nil
+	}
+	devices, err := loopDevices(image)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		glog.Infof("detaching block image: %v from %v", image, device)
+		if _, err := losetupFunc("--detach", device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopDevices returns the loop devices the image is attached to.
+func loopDevices(image string) ([]string, error) {
+	out, err := losetupFunc("--list", "--noheadings", "--output", "NAME", "--associated", image)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// reattachBlockDevices attaches the images of the block volumes of the node
+// again, since loop devices do not survive a reboot of the node. The device
+// links of all the volumes are removed first, so a volume is never mapped to
+// the loop device another image got while its own is being attached.
+func (p *hostPathProvisioner) reattachBlockDevices() error {
+	volumes, err := p.client.CoreV1().PersistentVolumes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	var blockVolumes []*v1.PersistentVolume
+	for i := range volumes.Items {
+		volume := &volumes.Items[i]
+		if !isBlockVolume(volume) || volume.Spec.Local == nil ||
+			volume.Annotations["hostPathProvisionerIdentity"] != p.identity ||
+			volume.Annotations["kubevirt.io/provisionOnNode"] != p.nodeName {
+			continue
+		}
+		if err := removeDeviceLink(volume.Name); err != nil {
+			return fmt.Errorf("unable to remove device link of PV %s: %w", volume.Name, err)
+		}
+		blockVolumes = append(blockVolumes, volume)
+	}
+	for _, volume := range blockVolumes {
+		if err := attachBlockDevice(volumeDirectory(volume), volume.Name); err != nil {
+			glog.Errorf("unable to attach block device of PV %s: %v", volume.Name, err)
+		}
+	}
+	return nil
+}
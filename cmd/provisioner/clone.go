@@ -0,0 +1,241 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog/v2"
+
+	"kubevirt.io/hostpath-provisioner/controller"
+	"kubevirt.io/hostpath-provisioner/pkg/hostpath"
+)
+
+var (
+	cloneDirectoryFunc = copyDirectoryContents
+)
+
+// cloneState tracks a clone copying in the background. The fields are
+// guarded by the clonesLock of the provisioner.
+type cloneState struct {
+	claim  *v1.PersistentVolumeClaim
+	volume *v1.PersistentVolume
+	done   bool
+	err    error
+	// abandoned is set when the claim is deleted during the copy, so the
+	// directory is removed once the copy is done.
+	abandoned bool
+}
+
+// ProvisionExt provisions the claim like Provision. Claims with another claim
+// as data source are cloned by copying the directory of the source volume in
+// the background, and ProvisioningInBackground is returned until the copy is
+// done. The controller retries the claim, so the state of the copy is kept
+// between the calls. The controller keeps retrying a claim deleted during the
+// copy, so the clones of the deleted claims are dropped on every call.
+func (p *hostPathProvisioner) ProvisionExt(options controller.ProvisionOptions) (*v1.PersistentVolume, controller.ProvisioningState, error) {
+	dataSource := options.PVC.Spec.DataSource
+	if dataSource == nil {
+		pv, err := p.Provision(options)
+		return pv, controller.ProvisioningFinished, err
+	}
+	if dataSource.Kind != "PersistentVolumeClaim" || (dataSource.APIGroup != nil && *dataSource.APIGroup != "") {
+		return nil, controller.ProvisioningFinished, fmt.Errorf("unsupported data source %s %s, only claims can be cloned", dataSource.Kind, dataSource.Name)
+	}
+
+	p.dropDeletedClones()
+	if !p.claimExists(options.PVC) {
+		return nil, controller.ProvisioningFinished, fmt.Errorf("claim %s/%s was deleted", options.PVC.Namespace, options.PVC.Name)
+	}
+	// The controller does not provision a claim concurrently, so the clone of
+	// the PV does not change until it is started below.
+	p.clonesLock.Lock()
+	state, ok := p.clones[options.PVName]
+	done := ok && state.done
+	if done {
+		delete(p.clones, options.PVName)
+	}
+	p.clonesLock.Unlock()
+	if ok {
+		if !done {
+			return nil, controller.ProvisioningInBackground, fmt.Errorf("cloning claim %s into %s is in progress", dataSource.Name, volumeDirectory(state.volume))
+		}
+		if state.err != nil {
+			return nil, controller.ProvisioningFinished, state.err
+		}
+		return state.volume, controller.ProvisioningFinished, nil
+	}
+
+	pv, err := p.newVolume(options)
+	if err != nil {
+		return nil, controller.ProvisioningFinished, err
+	}
+	if isBlockVolume(pv) {
+		return nil, controller.ProvisioningFinished, errors.New("cloning block volumes is not supported")
+	}
+	source, err := p.cloneSource(options.PVC)
+	if err != nil {
+		return nil, controller.ProvisioningFinished, err
+	}
+	// Clones are at least as large as their source. Claims without a request
+	// got all the free space of the storage pool, which the source must fit.
+	sourceCapacity := source.Spec.Capacity[v1.ResourceStorage]
+	if request, ok := options.PVC.Spec.Resources.Requests[v1.ResourceStorage]; !ok || request.IsZero() {
+		available := pv.Spec.Capacity[v1.ResourceStorage]
+		if sourceCapacity.Cmp(available) > 0 {
+			return nil, controller.ProvisioningFinished, fmt.Errorf("size %s of the source claim %s is larger than the free space %s of the storage pool", sourceCapacity.String(), dataSource.Name, available.String())
+		}
+		pv.Spec.Capacity[v1.ResourceStorage] = sourceCapacity
+	} else if request.Cmp(sourceCapacity) < 0 {
+		return nil, controller.ProvisioningFinished, fmt.Errorf("requested size %s is smaller than the size %s of the source claim %s", request.String(), sourceCapacity.String(), dataSource.Name)
+	}
+	vPath := volumeDirectory(pv)
+	if err := p.createVolumeDirectory(options, vPath); err != nil {
+		return nil, controller.ProvisioningFinished, err
+	}
+
+	state = &cloneState{claim: options.PVC, volume: pv}
+	p.clonesLock.Lock()
+	if p.clones == nil {
+		p.clones = make(map[string]*cloneState)
+	}
+	p.clones[options.PVName] = state
+	p.clonesLock.Unlock()
+	go p.cloneVolume(state, source.Spec.HostPath.Path, vPath)
+	return nil, controller.ProvisioningInBackground, fmt.Errorf("cloning claim %s into %s is in progress", dataSource.Name, vPath)
+}
+
+// dropDeletedClones drops the clones whose claim was deleted, and removes
+// their directory, once the copy is done for the ones in progress. The claims
+// are looked up without holding the clonesLock, so the clones are listed
+// first, and only dropped when they were not replaced meanwhile.
+func (p *hostPathProvisioner) dropDeletedClones() {
+	p.clonesLock.Lock()
+	clones := maps.Clone(p.clones)
+	p.clonesLock.Unlock()
+	for pvName, state := range clones {
+		if p.claimExists(state.claim) {
+			continue
+		}
+		p.clonesLock.Lock()
+		if p.clones[pvName] != state {
+			p.clonesLock.Unlock()
+			continue
+		}
+		glog.Infof("claim %s/%s was deleted, dropping its clone %s", state.claim.Namespace, state.claim.Name, pvName)
+		delete(p.clones, pvName)
+		done := state.done
+		state.abandoned = !done
+		p.clonesLock.Unlock()
+		if done {
+			removeClone(state)
+		}
+	}
+}
+
+// claimExists returns whether the claim still exists. It is assumed to when
+// that cannot be known.
+func (p *hostPathProvisioner) claimExists(pvc *v1.PersistentVolumeClaim) bool {
+	claim, err := p.client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		return false
+	} else if err != nil {
+		glog.Errorf("unable to get claim %s/%s: %v", pvc.Namespace, pvc.Name, err)
+		return true
+	}
+	return claim.UID == pvc.UID
+}
+
+// removeClone removes the directory of a clone whose claim was deleted.
+func removeClone(state *cloneState) {
+	vPath := volumeDirectory(state.volume)
+	glog.Infof("removing backing directory: %v", vPath)
+	if err := os.RemoveAll(vPath); err != nil {
+		glog.Errorf("failed to remove %v: %v", vPath, err)
+		return
+	}
+	if err := releaseVolumeDirectory(vPath); err != nil {
+		glog.Errorf("failed to release %v: %v", vPath, err)
+	}
+}
+
+// cloneSource returns the volume bound to the data source of the claim, which
+// must have been provisioned on this node.
+func (p *hostPathProvisioner) cloneSource(pvc *v1.PersistentVolumeClaim) (*v1.PersistentVolume, error) {
+	name := pvc.Spec.DataSource.Name
+	claim, err := p.client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get source claim %s: %w", name, err)
+	}
+	if claim.Status.Phase != v1.ClaimBound || claim.Spec.VolumeName == "" {
+		return nil, fmt.Errorf("source claim %s is not bound", name)
+	}
+	volume, err := p.client.CoreV1().PersistentVolumes().Get(context.TODO(), claim.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get volume %s of source claim %s: %w", claim.Spec.VolumeName, name, err)
+	}
+	if volume.Annotations["hostPathProvisionerIdentity"] != p.identity || volume.Spec.HostPath == nil {
+		return nil, fmt.Errorf("volume %s of source claim %s was not provisioned by %s", volume.Name, name, p.identity)
+	}
+	if node := volume.Annotations["kubevirt.io/provisionOnNode"]; node != p.nodeName {
+		return nil, fmt.Errorf("source claim %s is on node %s, clones must be provisioned on the same node", name, node)
+	}
+	return volume, nil
+}
+
+// cloneVolume copies src to dst and records the result in state. The
+// directory is removed when the copy fails, so the next attempt starts over.
+func (p *hostPathProvisioner) cloneVolume(state *cloneState, src, dst string) {
+	glog.Infof("cloning backing directory: %v to %v", src, dst)
+	err := cloneDirectoryFunc(src, dst)
+	if err != nil {
+		glog.Errorf("failed to clone %v to %v: %v", src, dst, err)
+		if removeErr := os.RemoveAll(dst); removeErr != nil {
+			glog.Errorf("failed to remove %v: %v", dst, removeErr)
+		}
+	}
+	p.clonesLock.Lock()
+	state.done = true
+	state.err = err
+	abandoned := state.abandoned
+	p.clonesLock.Unlock()
+	if abandoned {
+		removeClone(state)
+	}
+}
+
+// copyDirectoryContents copies the entries of src into dst.
+func copyDirectoryContents(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := hostpath.CopyReflinkFunc(filepath.Join(src, entry.Name()), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"kubevirt.io/hostpath-provisioner/controller"
+)
+
+// Config is the configuration of the provisioner. The env variables set the
+// defaults, the file given with --config overrides them, and the flags set on
+// the command line override the file.
+type Config struct {
+	// ProvisionerName is the provisioner of the storage classes the
+	// provisioner serves, and its identity on the PVs it creates. Provisioners
+	// with different names are independent of each other.
+	ProvisionerName string `json:"provisionerName"`
+	// NodeName is the node the provisioner creates volumes on.
+	NodeName string `json:"nodeName"`
+	// PVDir is the path of the legacy storage pool.
+	PVDir string `json:"pvDir"`
+	// StoragePools lists the storage pools in the JSON format of the CSI
+	// driver.
+	StoragePools    string `json:"storagePools"`
+	UseNamingPrefix bool   `json:"useNamingPrefix"`
+
+	Threadiness              int             `json:"threadiness"`
+	FailedProvisionThreshold int             `json:"failedProvisionThreshold"`
+	LeaderElection           bool            `json:"leaderElection"`
+	LeaderElectionNamespace  string          `json:"leaderElectionNamespace"`
+	ResyncPeriod             metav1.Duration `json:"resyncPeriod"`
+	AddFinalizer             bool            `json:"addFinalizer"`
+
+	MetricsPort    int    `json:"metricsPort"`
+	MetricsAddress string `json:"metricsAddress"`
+	MetricsPath    string `json:"metricsPath"`
+}
+
+// defaultConfig returns the configuration of the env variables, and the
+// defaults of the controller otherwise.
+func defaultConfig() *Config {
+	return &Config{
+		ProvisionerName:          defaultProvisionerName,
+		NodeName:                 os.Getenv("NODE_NAME"),
+		PVDir:                    os.Getenv("PV_DIR"),
+		StoragePools:             os.Getenv("STORAGE_POOLS"),
+		UseNamingPrefix:          strings.ToLower(os.Getenv("USE_NAMING_PREFIX")) == "true",
+		Threadiness:              controller.DefaultThreadiness,
+		FailedProvisionThreshold: controller.DefaultFailedProvisionThreshold,
+		LeaderElection:           false,
+		ResyncPeriod:             metav1.Duration{Duration: controller.DefaultResyncPeriod},
+		AddFinalizer:             controller.DefaultAddFinalizer,
+		MetricsPort:              controller.DefaultMetricsPort,
+		MetricsAddress:           controller.DefaultMetricsAddress,
+		MetricsPath:              controller.DefaultMetricsPath,
+	}
+}
+
+func (c *Config) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ProvisionerName, "provisioner-name", c.ProvisionerName, "name of the provisioner in the storage classes it serves, provisioners with different names are independent")
+	fs.StringVar(&c.NodeName, "node-name", c.NodeName, "node the provisioner creates volumes on, defaults to the NODE_NAME env variable")
+	fs.StringVar(&c.PVDir, "pv-dir", c.PVDir, "path of the legacy storage pool, defaults to the PV_DIR env variable")
+	fs.StringVar(&c.StoragePools, "storage-pools", c.StoragePools, "storage pools in JSON format, defaults to the STORAGE_POOLS env variable. Example: [{\"name\":\"fast\",\"path\":\"/var/hpvolumes-fast\"}]")
+	fs.BoolVar(&c.UseNamingPrefix, "use-naming-prefix", c.UseNamingPrefix, "prefix the directories of the volumes with the name of the claim, defaults to the USE_NAMING_PREFIX env variable")
+	fs.IntVar(&c.Threadiness, "threadiness", c.Threadiness, "number of claim and volume workers each")
+	fs.IntVar(&c.FailedProvisionThreshold, "failed-provision-threshold", c.FailedProvisionThreshold, "number of retries of a failed provisioning before giving up, 0 to retry forever")
+	fs.BoolVar(&c.LeaderElection, "leader-election", c.LeaderElection, "elect a leader among the provisioners of the same name, not supported since every node runs its own provisioner")
+	fs.StringVar(&c.LeaderElectionNamespace, "leader-election-namespace", c.LeaderElectionNamespace, "namespace of the leader election lease, defaults to the namespace of the provisioner")
+	fs.DurationVar(&c.ResyncPeriod.Duration, "resync-period", c.ResyncPeriod.Duration, "period at which all claims and volumes are synced again")
+	fs.BoolVar(&c.AddFinalizer, "add-finalizer", c.AddFinalizer, "add a finalizer to the PVs, so they are not removed before their directory is deleted")
+	fs.IntVar(&c.MetricsPort, "metrics-port", c.MetricsPort, "port to serve the prometheus metrics on, 0 disables the metrics server")
+	fs.StringVar(&c.MetricsAddress, "metrics-address", c.MetricsAddress, "IP address to serve the prometheus metrics on")
+	fs.StringVar(&c.MetricsPath, "metrics-path", c.MetricsPath, "path to serve the prometheus metrics on")
+}
+
+// loadConfig parses the flags in args, and returns the configuration of the
+// file given with --config, if any, overridden by the flags set in args.
+func loadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := defaultConfig()
+	configFile := fs.String("config", "", "path of a YAML configuration file, the flags set on the command line override it")
+	cfg.addFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *configFile != "" {
+		// The file replaces the values of the flags, so set them again after
+		// reading it.
+		flags := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) {
+			flags[f.Name] = f.Value.String()
+		})
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse config file %s: %w", *configFile, err)
+		}
+		for name, value := range flags {
+			if err := fs.Set(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate returns an error describing all the invalid fields of the
+// configuration.
+func (c *Config) Validate() error {
+	var errs []error
+	if msgs := validation.IsQualifiedName(c.ProvisionerName); len(msgs) > 0 {
+		errs = append(errs, fmt.Errorf("invalid provisioner name %q: %s", c.ProvisionerName, strings.Join(msgs, ", ")))
+	}
+	if c.NodeName == "" {
+		errs = append(errs, errors.New("node name must be set so that this provisioner can identify itself"))
+	}
+	if c.PVDir == "" && c.StoragePools == "" {
+		errs = append(errs, errors.New("PV dir or storage pools must be set so that this provisioner knows where to place its data"))
+	} else if _, _, err := parseStoragePools(c.PVDir, c.StoragePools); err != nil {
+		errs = append(errs, fmt.Errorf("invalid storage pools: %w", err))
+	}
+	// Every provisioner only provisions the claims of its node, a single
+	// leader would leave the claims of the other nodes pending.
+	if c.LeaderElection {
+		errs = append(errs, errors.New("leader election cannot be enabled, every node runs its own provisioner which only serves the claims of its node"))
+	}
+	if c.Threadiness < 1 {
+		errs = append(errs, fmt.Errorf("threadiness %d must be at least 1", c.Threadiness))
+	}
+	if c.FailedProvisionThreshold < 0 {
+		errs = append(errs, fmt.Errorf("failed provision threshold %d must not be negative", c.FailedProvisionThreshold))
+	}
+	if c.ResyncPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("resync period %s must be positive", c.ResyncPeriod.Duration))
+	}
+	if c.MetricsPort < 0 || c.MetricsPort > 65535 {
+		errs = append(errs, fmt.Errorf("metrics port %d must be between 0 and 65535", c.MetricsPort))
+	}
+	if c.MetricsPort > 0 && !strings.HasPrefix(c.MetricsPath, "/") {
+		errs = append(errs, fmt.Errorf("metrics path %q must start with /", c.MetricsPath))
+	}
+	return errors.Join(errs...)
+}
+
+// controllerOptions returns the options of the provision controller of the
+// configuration.
+func (c *Config) controllerOptions() []func(*controller.ProvisionController) error {
+	options := []func(*controller.ProvisionController) error{
+		controller.ClaimFilter(claimForNode(c.NodeName)),
+		controller.VolumeFilter(volumeForNode(c.NodeName)),
+		controller.Threadiness(c.Threadiness),
+		controller.FailedProvisionThreshold(c.FailedProvisionThreshold),
+		controller.LeaderElection(c.LeaderElection),
+		controller.ResyncPeriod(c.ResyncPeriod.Duration),
+		controller.AddFinalizer(c.AddFinalizer),
+		controller.MetricsPort(int32(c.MetricsPort)),
+		controller.MetricsAddress(c.MetricsAddress),
+		controller.MetricsPath(c.MetricsPath),
+	}
+	if c.LeaderElectionNamespace != "" {
+		options = append(options, controller.LeaderElectionNamespace(c.LeaderElectionNamespace))
+	}
+	return options
+}
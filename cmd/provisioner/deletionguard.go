@@ -0,0 +1,332 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	v1 "k8s.io/api/core/v1"
+	glog "k8s.io/klog/v2"
+
+	"kubevirt.io/hostpath-provisioner/controller"
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+const (
+	// blockedMounted is the reason of deletions blocked by a mount of the volume.
+	blockedMounted = "mounted"
+	// blockedOpenFiles is the reason of deletions blocked by open files in the volume.
+	blockedOpenFiles = "open_files"
+
+	volumeInUseReason = "VolumeInUse"
+)
+
+var (
+	procPath     = "/proc"
+	deviceNumber = blockDeviceNumber
+)
+
+var _ controller.DeletionGuard = &hostPathProvisioner{}
+
+// mountInfo is a mount of /proc/self/mountinfo.
+type mountInfo struct {
+	device     string
+	root       string
+	mountPoint string
+}
+
+// ShouldDelete defers deleting the directory of a released volume while it is
+// mounted, or while a process has files in it open. The loop devices of block
+// volumes are detached even when their directory is retained, so deleting a
+// block volume is also deferred while its loop device is mapped or open. The
+// volume is checked again the next time the controller syncs it.
+func (p *hostPathProvisioner) ShouldDelete(volume *v1.PersistentVolume) bool {
+	if !p.guardsDeletion(volume) {
+		return true
+	}
+	path := volumeDirectory(volume)
+	mounts, err := parseMountInfo(filepath.Join(procPath, "self", "mountinfo"))
+	if err != nil {
+		glog.Errorf("unable to check mounts of %v: %v", path, err)
+		return true
+	}
+	deletesDirectory := volume.Annotations[annOnDelete] != onDeleteRetain
+	var devices []string
+	if isBlockVolume(volume) {
+		devices = blockLoopDevices(path)
+	}
+	mountPoints := make([]string, 0)
+	if deletesDirectory {
+		mountPoints = append(mountPoints, volumeMounts(mounts, path)...)
+		mountPoints = append(mountPoints, otherNamespaceMounts(mounts, path)...)
+	}
+	for _, device := range devices {
+		mountPoints = append(mountPoints, volumeMounts(mounts, device)...)
+		mountPoints = append(mountPoints, otherNamespaceMounts(mounts, device)...)
+	}
+	if len(mountPoints) > 0 {
+		p.deletionBlocked(volume, blockedMounted, fmt.Sprintf("Deletion of %s deferred, it is mounted at %s", path, strings.Join(mountPoints, ", ")))
+		return false
+	}
+	pids := make([]string, 0)
+	if deletesDirectory {
+		pids = append(pids, openFilePids(path)...)
+	}
+	pids = append(pids, openDevicePids(devices)...)
+	if len(pids) > 0 {
+		p.deletionBlocked(volume, blockedOpenFiles, fmt.Sprintf("Deletion of %s deferred, processes %s have files in it open", path, strings.Join(pids, ", ")))
+		return false
+	}
+	return true
+}
+
+// guardsDeletion returns whether Delete would remove or archive the directory
+// of the volume, or detach its loop device, so only those volumes are checked.
+func (p *hostPathProvisioner) guardsDeletion(volume *v1.PersistentVolume) bool {
+	return volume.Status.Phase == v1.VolumeReleased &&
+		volume.Spec.PersistentVolumeReclaimPolicy == v1.PersistentVolumeReclaimDelete &&
+		volume.DeletionTimestamp == nil &&
+		volumeDirectory(volume) != "" &&
+		volume.Annotations["hostPathProvisionerIdentity"] == p.identity &&
+		volume.Annotations["kubevirt.io/provisionOnNode"] == p.nodeName &&
+		(volume.Annotations[annOnDelete] != onDeleteRetain || isBlockVolume(volume))
+}
+
+// blockLoopDevices returns the loop devices the image of the block volume in
+// dir is attached to.
+func blockLoopDevices(dir string) []string {
+	image := filepath.Join(dir, blockImageFile)
+	if _, err := os.Stat(image); os.IsNotExist(err) {
+		return nil
+	}
+	devices, err := loopDevices(image)
+	if err != nil {
+		glog.Errorf("unable to check loop devices of %v: %v", image, err)
+		return nil
+	}
+	return devices
+}
+
+func (p *hostPathProvisioner) deletionBlocked(volume *v1.PersistentVolume, reason, message string) {
+	glog.Infof("not deleting PV %s: %s", volume.Name, message)
+	metrics.IncProvisionerDeletionsBlocked(reason)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(volume, v1.EventTypeWarning, volumeInUseReason, message)
+	}
+}
+
+// parseMountInfo returns the mounts listed in the mountinfo file at path.
+func parseMountInfo(path string) ([]mountInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mounts := make([]mountInfo, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("invalid mountinfo line %q", scanner.Text())
+		}
+		mounts = append(mounts, mountInfo{
+			device:     fields[2],
+			root:       unescapeMountPath(fields[3]),
+			mountPoint: unescapeMountPath(fields[4]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes of spaces, tabs, newlines and
+// backslashes in mountinfo paths.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// volumeMounts returns the mount points of the mounts on or beneath path, and
+// of the bind mounts of path or of directories in it.
+func volumeMounts(mounts []mountInfo, path string) []string {
+	path = filepath.Clean(path)
+	device, root := volumeSource(mounts, path)
+	mountPoints := make([]string, 0)
+	for _, mount := range mounts {
+		if isPathWithin(mount.mountPoint, path) || (root != "" && mount.device == device && isPathWithin(mount.root, root)) {
+			mountPoints = append(mountPoints, mount.mountPoint)
+		}
+	}
+	return mountPoints
+}
+
+// volumeSource returns the device and the root in its filesystem of the
+// directory at path, from the mount containing it, to find its bind mounts.
+func volumeSource(mounts []mountInfo, path string) (string, string) {
+	var parent *mountInfo
+	for i := range mounts {
+		if mounts[i].mountPoint != path && isPathWithin(path, mounts[i].mountPoint) &&
+			(parent == nil || len(mounts[i].mountPoint) >= len(parent.mountPoint)) {
+			parent = &mounts[i]
+		}
+	}
+	if parent == nil {
+		return "", ""
+	}
+	rel, err := filepath.Rel(parent.mountPoint, path)
+	if err != nil {
+		return "", ""
+	}
+	return parent.device, filepath.Join(parent.root, rel)
+}
+
+// otherNamespaceMounts returns the bind mounts of path or of directories in
+// it in the mount namespaces of the other processes, like the hostPath
+// volumes of the pods. Only the processes in the PID namespace of the
+// provisioner are found.
+func otherNamespaceMounts(mounts []mountInfo, path string) []string {
+	path = filepath.Clean(path)
+	device, root := volumeSource(mounts, path)
+	if root == "" {
+		return nil
+	}
+	ownNamespace, err := os.Readlink(filepath.Join(procPath, "self", "ns", "mnt"))
+	if err != nil {
+		glog.Errorf("unable to get the mount namespace of the provisioner: %v", err)
+		return nil
+	}
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		glog.Errorf("unable to list processes: %v", err)
+		return nil
+	}
+	namespaces := map[string]bool{ownNamespace: true}
+	mountPoints := make([]string, 0)
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		// Processes exit, and the namespaces of others may not be readable.
+		namespace, err := os.Readlink(filepath.Join(procPath, entry.Name(), "ns", "mnt"))
+		if err != nil || namespaces[namespace] {
+			continue
+		}
+		namespaces[namespace] = true
+		processMounts, err := parseMountInfo(filepath.Join(procPath, entry.Name(), "mountinfo"))
+		if err != nil {
+			continue
+		}
+		for _, mount := range processMounts {
+			if mount.device == device && isPathWithin(mount.root, root) {
+				mountPoints = append(mountPoints, fmt.Sprintf("%s in the mount namespace of process %s", mount.mountPoint, entry.Name()))
+			}
+		}
+	}
+	return mountPoints
+}
+
+// openFilePids returns the processes with files on or beneath path open. Only
+// the processes in the PID namespace of the provisioner are found, and their
+// files only match when they see the directory at the same path.
+func openFilePids(path string) []string {
+	path = filepath.Clean(path)
+	return openFdPids(func(fd string) bool {
+		target, err := os.Readlink(fd)
+		return err == nil && isPathWithin(target, path)
+	})
+}
+
+// openDevicePids returns the processes with one of the block devices open.
+// Devices match by their device number, since pods open the device nodes of
+// their volumeDevices at other paths.
+func openDevicePids(devices []string) []string {
+	numbers := make(map[uint64]bool)
+	for _, device := range devices {
+		if number, ok := deviceNumber(device); ok {
+			numbers[number] = true
+		}
+	}
+	if len(numbers) == 0 {
+		return nil
+	}
+	return openFdPids(func(fd string) bool {
+		number, ok := deviceNumber(fd)
+		return ok && numbers[number]
+	})
+}
+
+// openFdPids returns the processes with an open file descriptor, given by its
+// link in /proc, that matches.
+func openFdPids(matches func(fd string) bool) []string {
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		glog.Errorf("unable to list processes: %v", err)
+		return nil
+	}
+	pids := make([]string, 0)
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		fdPath := filepath.Join(procPath, entry.Name(), "fd")
+		// Processes exit, and the files of others may not be readable.
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if matches(filepath.Join(fdPath, fd.Name())) {
+				pids = append(pids, entry.Name())
+				break
+			}
+		}
+	}
+	return pids
+}
+
+// blockDeviceNumber returns the device number of the block device at path,
+// following symlinks like the file descriptor links in /proc.
+func blockDeviceNumber(path string) (uint64, bool) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil || stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return 0, false
+	}
+	return stat.Rdev, true
+}
+
+// isPathWithin returns whether path is dir or a path beneath it.
+func isPathWithin(path, dir string) bool {
+	return path == dir || dir == "/" || strings.HasPrefix(path, dir+"/")
+}
@@ -17,12 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 
@@ -33,23 +39,47 @@ import (
 	storage "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
 	defaultProvisionerName = "kubevirt.io/hostpath-provisioner"
-	annStorageProvisioner  = "volume.beta.kubernetes.io/storage-provisioner"
+	// annOnDelete records on the PV what to do with the directory when the PV
+	// is deleted, so later changes to the storage class do not affect it.
+	annOnDelete = "kubevirt.io/onDelete"
+
+	// onDeleteParameter is the StorageClass parameter selecting what happens
+	// to the directory of a deleted PV.
+	onDeleteParameter = "onDelete"
+	onDeleteDelete    = "delete"
+	onDeleteArchive   = "archive"
+	onDeleteRetain    = "retain"
+
+	// mountOptionsIgnoredReason is the reason of the event recorded on the
+	// claims of a storage class with mount options.
+	mountOptionsIgnoredReason = "MountOptionsIgnored"
+
+	archivedPrefix    = "archived-"
+	archiveTimeFormat = "20060102-150405"
 )
 
-var provisionerName string
-
 type hostPathProvisioner struct {
-	pvDir           string
+	// pools are the paths of the storage pools by name.
+	pools           map[string]string
+	defaultPool     string
 	identity        string
 	nodeName        string
 	useNamingPrefix bool
+	client          kubernetes.Interface
+	eventRecorder   record.EventRecorder
+
+	// clones are the clones copying in the background by PV name.
+	clonesLock sync.Mutex
+	clones     map[string]*cloneState
 }
 
 // Common allocation units
@@ -62,49 +92,64 @@ const (
 
 var provisionerID string
 
-// NewHostPathProvisioner creates a new hostpath provisioner
-func NewHostPathProvisioner() controller.Provisioner {
-	useNamingPrefix := false
-	nodeName := os.Getenv("NODE_NAME")
-	if nodeName == "" {
-		glog.Fatal("env variable NODE_NAME must be set so that this provisioner can identify itself")
-	}
-
-	// note that the pvDir variable informs us *where* the provisioner should be writing backing files to
+// NewHostPathProvisioner creates a new hostpath provisioner of the validated
+// configuration
+func NewHostPathProvisioner(client kubernetes.Interface, cfg *Config) controller.Provisioner {
+	// note that the pvDir variable and the pool paths inform us *where* the provisioner should be writing backing files to
 	// this needs to match the path speciied in the volumes.hostPath spec of the deployment
-	pvDir := os.Getenv("PV_DIR")
-	if pvDir == "" {
-		glog.Fatal("env variable PV_DIR must be set so that this provisioner knows where to place its data")
+	pools, defaultPool, err := parseStoragePools(cfg.PVDir, cfg.StoragePools)
+	if err != nil {
+		glog.Fatalf("invalid storage pools: %v", err)
 	}
-	if strings.ToLower(os.Getenv("USE_NAMING_PREFIX")) == "true" {
-		useNamingPrefix = true
+	glog.Infof("initiating kubevirt/hostpath-provisioner on node: %s\n", cfg.NodeName)
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events(v1.NamespaceAll)})
+	eventRecorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: cfg.ProvisionerName, Host: cfg.NodeName})
+	p := &hostPathProvisioner{
+		pools:           pools,
+		defaultPool:     defaultPool,
+		identity:        cfg.ProvisionerName,
+		nodeName:        cfg.NodeName,
+		useNamingPrefix: cfg.UseNamingPrefix,
+		client:          client,
+		eventRecorder:   eventRecorder,
+		clones:          make(map[string]*cloneState),
 	}
-	glog.Infof("initiating kubevirt/hostpath-provisioner on node: %s\n", nodeName)
-	provisionerName = "kubevirt.io/hostpath-provisioner"
-	return &hostPathProvisioner{
-		pvDir:           pvDir,
-		identity:        provisionerName,
-		nodeName:        nodeName,
-		useNamingPrefix: useNamingPrefix,
+	if err := p.reattachBlockDevices(); err != nil {
+		glog.Fatalf("unable to attach block devices: %v", err)
 	}
+	return p
 }
 
 var _ controller.Provisioner = &hostPathProvisioner{}
+var _ controller.ProvisionerExt = &hostPathProvisioner{}
 
 func isCorrectNodeByBindingMode(annotations map[string]string, nodeName string, bindingMode storage.VolumeBindingMode) bool {
 	glog.Infof("isCorrectNodeByBindingMode mode: %s", string(bindingMode))
 	if _, ok := annotations["kubevirt.io/provisionOnNode"]; ok {
-		if isCorrectNode(annotations, nodeName, "kubevirt.io/provisionOnNode") {
-			annotations[annStorageProvisioner] = defaultProvisionerName
-			return true
-		}
-		return false
+		return isCorrectNode(annotations, nodeName, "kubevirt.io/provisionOnNode")
 	} else if bindingMode == storage.VolumeBindingWaitForFirstConsumer {
 		return isCorrectNode(annotations, nodeName, "volume.kubernetes.io/selected-node")
 	}
 	return false
 }
 
+// claimForNode returns whether the claim may be provisioned on the node, so
+// the provisioner of every node only queues its own claims. The claims are
+// checked in ShouldProvision with the binding mode of the storage class.
+func claimForNode(nodeName string) func(*v1.PersistentVolumeClaim) bool {
+	return func(claim *v1.PersistentVolumeClaim) bool {
+		return claim.Annotations["kubevirt.io/provisionOnNode"] == nodeName || claim.Annotations["volume.kubernetes.io/selected-node"] == nodeName
+	}
+}
+
+// volumeForNode returns whether the volume was provisioned on the node.
+func volumeForNode(nodeName string) func(*v1.PersistentVolume) bool {
+	return func(volume *v1.PersistentVolume) bool {
+		return volume.Annotations["kubevirt.io/provisionOnNode"] == nodeName
+	}
+}
+
 func isCorrectNode(annotations map[string]string, nodeName string, annotationName string) bool {
 	if val, ok := annotations[annotationName]; ok {
 		glog.Infof("claim included %s annotation: %s\n", annotationName, val)
@@ -119,11 +164,20 @@ func isCorrectNode(annotations map[string]string, nodeName string, annotationNam
 	return false
 }
 
-func (p *hostPathProvisioner) ShouldProvision(pvc *v1.PersistentVolumeClaim, bindingMode *storage.VolumeBindingMode) bool {
-	shouldProvision := isCorrectNodeByBindingMode(pvc.GetAnnotations(), p.nodeName, *bindingMode)
+func (p *hostPathProvisioner) ShouldProvision(pvc *v1.PersistentVolumeClaim, class *storage.StorageClass) bool {
+	bindingMode := storage.VolumeBindingImmediate
+	if class.VolumeBindingMode != nil {
+		bindingMode = *class.VolumeBindingMode
+	}
+	shouldProvision := isCorrectNodeByBindingMode(pvc.GetAnnotations(), p.nodeName, bindingMode)
 
 	if shouldProvision {
-		pvCapacity, err := calculatePvCapacity(p.pvDir)
+		poolPath, err := p.poolPath(class)
+		if err != nil {
+			glog.Errorf("Unable to provision PVC %s/%s: %v", pvc.Namespace, pvc.Name, err)
+			return false
+		}
+		pvCapacity, err := calculatePvCapacity(poolPath)
 		if pvCapacity != nil && pvCapacity.Cmp(pvc.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)]) < 0 {
 			glog.Error("PVC request size larger than total possible PV size")
 			shouldProvision = false
@@ -135,53 +189,145 @@ func (p *hostPathProvisioner) ShouldProvision(pvc *v1.PersistentVolumeClaim, bin
 	return shouldProvision
 }
 
-// Provision creates a storage asset and returns a PV object representing it.
-func (p *hostPathProvisioner) Provision(options controller.ProvisionOptions) (*v1.PersistentVolume, error) {
-	vPath := path.Join(p.pvDir, options.PVName)
-	pvCapacity, err := calculatePvCapacity(p.pvDir)
+// volumePath returns the path of the directory backing the volume in the
+// selected storage pool, from the pathPattern parameter of the storage class
+// if set.
+func (p *hostPathProvisioner) volumePath(options controller.ProvisionOptions) (string, error) {
+	poolPath, err := p.poolPath(options.StorageClass)
+	if err != nil {
+		return "", err
+	}
+	if options.StorageClass != nil {
+		if pattern, ok := options.StorageClass.Parameters[pathPatternParameter]; ok {
+			expanded, err := expandPathPattern(pattern, options)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(poolPath, expanded), nil
+		}
+	}
 	if p.useNamingPrefix {
-		vPath = path.Join(p.pvDir, options.PVC.Name+"-"+options.PVName)
+		return path.Join(poolPath, options.PVC.Name+"-"+options.PVName), nil
+	}
+	return path.Join(poolPath, options.PVName), nil
+}
+
+// pvCapacity returns the capacity of the PV for the claim, which is the
+// requested size. Claims without a request get all the free space of the
+// selected storage pool. Requests larger than the free space fail, a smaller
+// PV would never be bound to the claim.
+func (p *hostPathProvisioner) pvCapacity(pvc *v1.PersistentVolumeClaim, class *storage.StorageClass) (*resource.Quantity, error) {
+	poolPath, err := p.poolPath(class)
+	if err != nil {
+		return nil, err
+	}
+	available, err := calculateAvailableCapacity(poolPath)
+	if err != nil {
+		return nil, err
+	}
+	request, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok || request.IsZero() {
+		return available, nil
+	}
+	if request.Cmp(*available) > 0 {
+		return nil, fmt.Errorf("requested size %s is larger than the free space %s of the storage pool", request.String(), available.String())
 	}
+	return &request, nil
+}
 
-	if pvCapacity != nil {
-		glog.Infof("creating backing directory: %v", vPath)
+// onDeletePolicy returns the onDelete parameter of the storage class,
+// defaulting to delete.
+func onDeletePolicy(class *storage.StorageClass) (string, error) {
+	if class == nil || class.Parameters[onDeleteParameter] == "" {
+		return onDeleteDelete, nil
+	}
+	switch onDelete := strings.ToLower(class.Parameters[onDeleteParameter]); onDelete {
+	case onDeleteDelete, onDeleteArchive, onDeleteRetain:
+		return onDelete, nil
+	default:
+		return "", fmt.Errorf("invalid %s parameter %q, must be %s, %s or %s", onDeleteParameter, class.Parameters[onDeleteParameter], onDeleteDelete, onDeleteArchive, onDeleteRetain)
+	}
+}
 
-		if err := os.MkdirAll(vPath, 0777); err != nil {
+// Provision creates a storage asset and returns a PV object representing it.
+func (p *hostPathProvisioner) Provision(options controller.ProvisionOptions) (*v1.PersistentVolume, error) {
+	pv, err := p.newVolume(options)
+	if err != nil {
+		return nil, err
+	}
+	vPath := volumeDirectory(pv)
+	if err := p.createVolumeDirectory(options, vPath); err != nil {
+		return nil, err
+	}
+	if isBlockVolume(pv) {
+		capacity := pv.Spec.Capacity[v1.ResourceStorage]
+		if err := createBlockDevice(vPath, options.PVName, capacity.Value()); err != nil {
 			return nil, err
 		}
+	}
+	return pv, nil
+}
 
-		pv := &v1.PersistentVolume{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: options.PVName,
-				Annotations: map[string]string{
-					"hostPathProvisionerIdentity": p.identity,
-					"kubevirt.io/provisionOnNode": p.nodeName,
-				},
+// newVolume returns the PV for the claim, without creating its directory.
+func (p *hostPathProvisioner) newVolume(options controller.ProvisionOptions) (*v1.PersistentVolume, error) {
+	onDelete, err := onDeletePolicy(options.StorageClass)
+	if err != nil {
+		return nil, err
+	}
+	reclaimPolicy := v1.PersistentVolumeReclaimDelete
+	if options.StorageClass != nil {
+		// The kubelet refuses to mount hostPath volumes with mount options, so
+		// the PV is created without them.
+		if len(options.StorageClass.MountOptions) > 0 {
+			p.mountOptionsIgnored(options)
+		}
+		if options.StorageClass.ReclaimPolicy != nil {
+			reclaimPolicy = *options.StorageClass.ReclaimPolicy
+		}
+	}
+	accessModes := options.PVC.Spec.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+	}
+	vPath, err := p.volumePath(options)
+	if err != nil {
+		return nil, err
+	}
+	pvCapacity, err := p.pvCapacity(options.PVC, options.StorageClass)
+	if err != nil {
+		return nil, err
+	}
+
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: options.PVName,
+			Annotations: map[string]string{
+				"hostPathProvisionerIdentity": p.identity,
+				"kubevirt.io/provisionOnNode": p.nodeName,
+				annOnDelete:                   onDelete,
 			},
-			Spec: v1.PersistentVolumeSpec{
-				PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete,
-				AccessModes: []v1.PersistentVolumeAccessMode{
-					v1.ReadWriteOnce,
-				},
-				Capacity: v1.ResourceList{
-					v1.ResourceName(v1.ResourceStorage): *pvCapacity,
-				},
-				PersistentVolumeSource: v1.PersistentVolumeSource{
-					HostPath: &v1.HostPathVolumeSource{
-						Path: vPath,
-					},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: reclaimPolicy,
+			AccessModes:                   accessModes,
+			Capacity: v1.ResourceList{
+				v1.ResourceName(v1.ResourceStorage): *pvCapacity,
+			},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: vPath,
 				},
-				NodeAffinity: &v1.VolumeNodeAffinity{
-					Required: &v1.NodeSelector{
-						NodeSelectorTerms: []v1.NodeSelectorTerm{
-							{
-								MatchExpressions: []v1.NodeSelectorRequirement{
-									{
-										Key:      "kubernetes.io/hostname",
-										Operator: v1.NodeSelectorOpIn,
-										Values: []string{
-											p.nodeName,
-										},
+			},
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{
+							MatchExpressions: []v1.NodeSelectorRequirement{
+								{
+									Key:      "kubernetes.io/hostname",
+									Operator: v1.NodeSelectorOpIn,
+									Values: []string{
+										p.nodeName,
 									},
 								},
 							},
@@ -189,10 +335,68 @@ func (p *hostPathProvisioner) Provision(options controller.ProvisionOptions) (*v
 					},
 				},
 			},
+		},
+	}
+	if options.PVC.Spec.VolumeMode != nil && *options.PVC.Spec.VolumeMode == v1.PersistentVolumeBlock {
+		// Block volumes are preallocated, so they need a size.
+		if request, ok := options.PVC.Spec.Resources.Requests[v1.ResourceStorage]; !ok || request.IsZero() {
+			return nil, errors.New("block volumes must request a size")
+		}
+		pv.Spec.VolumeMode = options.PVC.Spec.VolumeMode
+		pv.Spec.PersistentVolumeSource = v1.PersistentVolumeSource{
+			Local: &v1.LocalVolumeSource{
+				Path: path.Join(vPath, blockDeviceLink),
+			},
+		}
+	}
+	return pv, nil
+}
+
+// mountOptionsIgnored warns on the claim that the mount options of its storage
+// class are not set on the PV.
+func (p *hostPathProvisioner) mountOptionsIgnored(options controller.ProvisionOptions) {
+	message := fmt.Sprintf("mountOptions %v of storage class %s are ignored, hostPath volumes cannot be mounted with options", options.StorageClass.MountOptions, options.StorageClass.Name)
+	glog.Warningf("claim %s/%s: %s", options.PVC.Namespace, options.PVC.Name, message)
+	if p.eventRecorder != nil {
+		p.eventRecorder.Event(options.PVC, v1.EventTypeWarning, mountOptionsIgnoredReason, message)
+	}
+}
+
+// createVolumeDirectory creates the backing directory of the volume at vPath.
+func (p *hostPathProvisioner) createVolumeDirectory(options controller.ProvisionOptions, vPath string) error {
+	glog.Infof("creating backing directory: %v", vPath)
+	if options.StorageClass != nil && options.StorageClass.Parameters[pathPatternParameter] != "" {
+		// The pattern may be chosen by the claim through an annotation, so
+		// it must not reach the directory of another PV.
+		volumePaths, err := p.volumeDirectories(options.PVName)
+		if err != nil {
+			return err
 		}
-		return pv, nil
+		return claimVolumeDirectory(vPath, options.PVName, volumePaths)
 	}
-	return nil, err
+	return os.MkdirAll(vPath, 0777)
+}
+
+// volumeDirectories returns the backing directories of the PVs provisioned on
+// the node, other than the named one.
+func (p *hostPathProvisioner) volumeDirectories(pvName string) ([]string, error) {
+	volumes, err := p.client.CoreV1().PersistentVolumes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list PVs: %w", err)
+	}
+	var paths []string
+	for i := range volumes.Items {
+		volume := &volumes.Items[i]
+		if volume.Name == pvName ||
+			volume.Annotations["hostPathProvisionerIdentity"] != p.identity ||
+			volume.Annotations["kubevirt.io/provisionOnNode"] != p.nodeName {
+			continue
+		}
+		if path := volumeDirectory(volume); path != "" {
+			paths = append(paths, filepath.Clean(path))
+		}
+	}
+	return paths, nil
 }
 
 // Delete removes the storage asset that was created by Provision represented
@@ -209,13 +413,43 @@ func (p *hostPathProvisioner) Delete(volume *v1.PersistentVolume) error {
 		return &controller.IgnoredError{Reason: "identity annotation on pvc does not match ours, not deleting PV"}
 	}
 
-	path := volume.Spec.PersistentVolumeSource.HostPath.Path
-	glog.Infof("removing backing directory: %v", path)
-	if err := os.RemoveAll(path); err != nil {
-		return err
+	path := volumeDirectory(volume)
+	if isBlockVolume(volume) {
+		if err := detachBlockDevice(path, volume.Name); err != nil {
+			return err
+		}
+	}
+	// PVs provisioned before the onDelete parameter have no annotation.
+	switch onDelete := volume.Annotations[annOnDelete]; onDelete {
+	case onDeleteRetain:
+		glog.Infof("retaining backing directory: %v", path)
+		return nil
+	case onDeleteArchive:
+		archivePath := filepath.Join(filepath.Dir(path), archivedPrefix+filepath.Base(path)+"-"+time.Now().UTC().Format(archiveTimeFormat))
+		glog.Infof("archiving backing directory: %v to %v", path, archivePath)
+		if err := os.Rename(path, archivePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return releaseVolumeDirectory(path)
+	case onDeleteDelete, "":
+		glog.Infof("removing backing directory: %v", path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		return releaseVolumeDirectory(path)
+	default:
+		return fmt.Errorf("invalid %s annotation %q on PV %s", annOnDelete, onDelete, volume.Name)
 	}
+}
 
-	return nil
+// calculateAvailableCapacity returns the free space of the filesystem of path
+// available to unprivileged users, rounded down like calculatePvCapacity.
+func calculateAvailableCapacity(path string) (*resource.Quantity, error) {
+	statfs := &unix.Statfs_t{}
+	if err := unix.Statfs(path, statfs); err != nil {
+		return nil, err
+	}
+	return resource.NewQuantity(roundDownCapacityPretty(int64(statfs.Bavail)*int64(statfs.Bsize)), resource.BinarySI), nil
 }
 
 func calculatePvCapacity(path string) (*resource.Quantity, error) {
@@ -249,7 +483,10 @@ func roundDownCapacityPretty(capacityBytes int64) int64 {
 func main() {
 	syscall.Umask(0)
 
-	flag.Parse()
+	cfg, err := loadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		glog.Fatalf("Invalid configuration: %v", err)
+	}
 	flag.Set("logtostderr", "true")
 
 	// Create an InClusterConfig and use it to create a client for the controller
@@ -272,11 +509,15 @@ func main() {
 
 	// Create the provisioner: it implements the Provisioner interface expected by
 	// the controller
-	hostPathProvisioner := NewHostPathProvisioner()
+	hostPathProvisioner := NewHostPathProvisioner(clientset, cfg)
 
-	glog.Infof("creating provisioner controller with name: %s\n", provisionerName)
+	glog.Infof("creating provisioner controller with name: %s\n", cfg.ProvisionerName)
 	// Start the provision controller which will dynamically provision hostPath
 	// PVs
-	pc := controller.NewProvisionController(clientset, provisionerName, hostPathProvisioner, serverVersion.GitVersion)
-	pc.Run(wait.NeverStop)
+	pc := controller.NewProvisionController(clientset, cfg.ProvisionerName, hostPathProvisioner, serverVersion.GitVersion, cfg.controllerOptions()...)
+	// Stop the controller cleanly on SIGTERM, so the work in progress is
+	// finished before the pod exits.
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	pc.Run(ctx)
 }
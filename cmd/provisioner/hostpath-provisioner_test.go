@@ -17,9 +17,17 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/sys/unix"
 
@@ -27,6 +35,13 @@ import (
 	storage "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"kubevirt.io/hostpath-provisioner/controller"
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
 )
 
 func getKubevirtNodeAnnotation(value string) map[string]string {
@@ -184,6 +199,60 @@ func Test_isCorrectNodeByBindingMode(t *testing.T) {
 	}
 }
 
+func Test_isCorrectNodeByBindingModeDoesNotMutate(t *testing.T) {
+	annotations := getKubevirtNodeAnnotation("test-node")
+	if !isCorrectNodeByBindingMode(annotations, "test-node", storage.VolumeBindingImmediate) {
+		t.Errorf("isCorrectNodeByBindingMode() = false, want true")
+	}
+	if len(annotations) != 1 {
+		t.Errorf("isCorrectNodeByBindingMode() changed the annotations to %v", annotations)
+	}
+}
+
+func Test_claimForNode(t *testing.T) {
+	filter := claimForNode("test-node")
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{
+			name:        "kubevirt node annotation",
+			annotations: getKubevirtNodeAnnotation("test-node"),
+			want:        true,
+		},
+		{
+			name:        "selected node annotation",
+			annotations: getSelectedNodeAnnotation("test-node"),
+			want:        true,
+		},
+		{
+			name:        "other node",
+			annotations: getSelectedNodeAnnotation("other-node"),
+			want:        false,
+		},
+		{
+			name:        "no annotation",
+			annotations: nil,
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if got := filter(claim); got != tt.want {
+				t.Errorf("claimForNode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !volumeForNode("testNode")(createPv("testId", "testNode", "/path")) {
+		t.Errorf("volumeForNode() = false for a volume of the node")
+	}
+	if volumeForNode("otherNode")(createPv("testId", "testNode", "/path")) {
+		t.Errorf("volumeForNode() = true for a volume of another node")
+	}
+}
+
 func Test_Delete(t *testing.T) {
 	type args struct {
 		identity string
@@ -241,6 +310,71 @@ func Test_Delete(t *testing.T) {
 	}
 }
 
+func Test_DeleteOnDelete(t *testing.T) {
+	testProvisioner := &hostPathProvisioner{
+		nodeName: "testNode",
+		identity: "testId",
+	}
+	tests := []struct {
+		name        string
+		onDelete    string
+		wantExists  bool
+		wantArchive bool
+		wantErr     bool
+	}{
+		{
+			name:       "No annotation deletes",
+			onDelete:   "",
+			wantExists: false,
+		},
+		{
+			name:       "Delete",
+			onDelete:   onDeleteDelete,
+			wantExists: false,
+		},
+		{
+			name:       "Retain",
+			onDelete:   onDeleteRetain,
+			wantExists: true,
+		},
+		{
+			name:        "Archive",
+			onDelete:    onDeleteArchive,
+			wantExists:  false,
+			wantArchive: true,
+		},
+		{
+			name:       "Invalid",
+			onDelete:   "shred",
+			wantExists: true,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pvDir := t.TempDir()
+			dirPath := filepath.Join(pvDir, "pv")
+			if err := os.Mkdir(dirPath, 0755); err != nil {
+				t.Fatal(err)
+			}
+			pv := createPv("testId", "testNode", dirPath)
+			if tt.onDelete != "" {
+				pv.Annotations[annOnDelete] = tt.onDelete
+			}
+			if err := testProvisioner.Delete(pv); (err != nil) != tt.wantErr {
+				t.Errorf("Delete, error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(dirPath); (err == nil) != tt.wantExists {
+				t.Errorf("Delete, directory exists = %v, want %v", err == nil, tt.wantExists)
+			}
+			archived, _ := filepath.Glob(filepath.Join(pvDir, archivedPrefix+"pv-*"))
+			if (len(archived) == 1) != tt.wantArchive {
+				t.Errorf("Delete, archived directories = %v, want archive %v", archived, tt.wantArchive)
+			}
+		})
+	}
+}
+
 func Test_calculatePvCapacity(t *testing.T) {
 	type args struct {
 		path string
@@ -341,56 +475,1415 @@ func Test_roundDownCapacityPretty(t *testing.T) {
 	}
 }
 
-func getTotalCapacity(path string) (int64, error) {
-	statfs := &unix.Statfs_t{}
-	err := unix.Statfs(path, statfs)
+func Test_expandPathPattern(t *testing.T) {
+	options := controller.ProvisionOptions{
+		PVName: "pvc-1234",
+		PVC: &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "disk",
+				Namespace: "vms",
+				Annotations: map[string]string{
+					"example.com/app":   "web/../server",
+					"example.com/empty": "",
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name    string
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "namespace and name",
+			pattern: "${.PVC.namespace}/${.PVC.name}",
+			want:    "vms/disk",
+		},
+		{
+			name:    "PV name",
+			pattern: "${.PVC.name}-${.PV.name}",
+			want:    "disk-pvc-1234",
+		},
+		{
+			name:    "annotation is sanitised",
+			pattern: "${.PVC.annotations.example.com/app}",
+			want:    "web-..-server",
+		},
+		{
+			name:    "missing annotation",
+			pattern: "${.PVC.annotations.example.com/missing}",
+			wantErr: true,
+		},
+		{
+			name:    "empty annotation",
+			pattern: "${.PVC.annotations.example.com/empty}/${.PVC.name}",
+			wantErr: true,
+		},
+		{
+			name:    "unknown variable",
+			pattern: "${.PVC.uid}",
+			wantErr: true,
+		},
+		{
+			name:    "absolute path",
+			pattern: "/etc/${.PVC.name}",
+			wantErr: true,
+		},
+		{
+			name:    "parent directory",
+			pattern: "../${.PVC.name}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPathPattern(tt.pattern, options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandPathPattern() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("expandPathPattern() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_claimVolumeDirectory(t *testing.T) {
+	vPath := filepath.Join(t.TempDir(), "vms", "disk")
+	if err := claimVolumeDirectory(vPath, "pv-1", nil); err != nil {
+		t.Fatalf("claimVolumeDirectory() error = %v", err)
+	}
+	// Retries for the same PV succeed, even once the volume has data.
+	if err := os.WriteFile(filepath.Join(vPath, "data"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := claimVolumeDirectory(vPath, "pv-1", nil); err != nil {
+		t.Errorf("claimVolumeDirectory() retry error = %v", err)
+	}
+	if err := claimVolumeDirectory(vPath, "pv-2", nil); err == nil {
+		t.Errorf("claimVolumeDirectory() for another PV succeeded")
+	}
+
+	// Existing directories not created by the provisioner are not taken
+	// over, even empty.
+	pvDir := t.TempDir()
+	for _, dir := range []string{"existing", "empty"} {
+		if err := os.MkdirAll(filepath.Join(pvDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(pvDir, "existing", "data"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"existing", "empty"} {
+		existing := filepath.Join(pvDir, dir)
+		if err := claimVolumeDirectory(existing, "pv-1", nil); err == nil {
+			t.Errorf("claimVolumeDirectory() of existing directory %s succeeded", dir)
+		}
+		if _, err := os.Stat(pvMarkerPath(existing)); !os.IsNotExist(err) {
+			t.Errorf("claimVolumeDirectory() of existing directory %s recorded an owner: %v", dir, err)
+		}
+	}
+
+	// The directories of the other PVs cannot be nested into, or nest one.
+	volumePaths := []string{filepath.Join(pvDir, "pv-3"), filepath.Join(pvDir, "vms", "pv-4")}
+	for _, path := range []string{
+		filepath.Join(pvDir, "pv-3"),
+		filepath.Join(pvDir, "pv-3", "disk"),
+		filepath.Join(pvDir, "vms"),
+	} {
+		if err := claimVolumeDirectory(path, "pv-1", volumePaths); err == nil {
+			t.Errorf("claimVolumeDirectory() of %s overlapping %v succeeded", path, volumePaths)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("claimVolumeDirectory() of %s overlapping %v created it: %v", path, volumePaths, err)
+		}
+	}
+	if err := claimVolumeDirectory(filepath.Join(pvDir, "pv-30"), "pv-1", volumePaths); err != nil {
+		t.Errorf("claimVolumeDirectory() next to the other PVs error = %v", err)
+	}
+}
+
+func Test_Provision(t *testing.T) {
+	pvDir := t.TempDir()
+	testProvisioner := &hostPathProvisioner{
+		pools:       map[string]string{legacyPoolName: pvDir},
+		defaultPool: legacyPoolName,
+		identity:    "testId",
+		nodeName:    "testNode",
+		client:      fake.NewSimpleClientset(createPv("testId", "testNode", filepath.Join(pvDir, "pv-0"))),
+	}
+	available, err := calculateAvailableCapacity(pvDir)
 	if err != nil {
-		return int64(-1), err
+		t.Fatal(err)
+	}
+	storageClass := &storage.StorageClass{
+		Parameters: map[string]string{pathPatternParameter: "${.PVC.namespace}/${.PVC.name}"},
+	}
+	createOptions := func(pvName, request string) controller.ProvisionOptions {
+		pvc := &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "disk", Namespace: "vms"},
+		}
+		if request != "" {
+			pvc.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse(request)}
+		}
+		return controller.ProvisionOptions{PVName: pvName, PVC: pvc, StorageClass: storageClass}
 	}
 
-	// Capacity is total block count * block size
-	return int64(statfs.Blocks) * int64(statfs.Bsize), nil
+	pv, err := testProvisioner.Provision(createOptions("pv-1", "1Mi"))
+	if err != nil {
+		t.Fatalf("Provision() error = %v", err)
+	}
+	if pv.Spec.HostPath.Path != filepath.Join(pvDir, "vms", "disk") {
+		t.Errorf("Provision() path = %s", pv.Spec.HostPath.Path)
+	}
+	if capacity := pv.Spec.Capacity[v1.ResourceStorage]; capacity.Cmp(resource.MustParse("1Mi")) != 0 {
+		t.Errorf("Provision() capacity = %s, want 1Mi", capacity.String())
+	}
+	// The owner is recorded next to the volume, which starts empty.
+	if entries, err := os.ReadDir(pv.Spec.HostPath.Path); err != nil || len(entries) != 0 {
+		t.Errorf("Provision() volume entries = %v, %v, want none", entries, err)
+	}
+	if _, err := os.Stat(filepath.Join(pvDir, "vms", ".disk.pv")); err != nil {
+		t.Errorf("Provision() did not record the owner of the volume: %v", err)
+	}
+
+	if _, err := testProvisioner.Provision(createOptions("pv-2", "1Mi")); err == nil {
+		t.Errorf("Provision() of another PV with the same path succeeded")
+	}
+	if err := testProvisioner.Delete(pv); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pvDir, "vms", ".disk.pv")); !os.IsNotExist(err) {
+		t.Errorf("Delete() kept the owner of the volume: %v", err)
+	}
+	if _, err := testProvisioner.Provision(createOptions("pv-2", "1Mi")); err != nil {
+		t.Errorf("Provision() of another PV after deleting the first one error = %v", err)
+	}
+
+	// Annotations cannot point the volume into the directory of another PV,
+	// even one not named by a pattern.
+	storageClass.Parameters = map[string]string{pathPatternParameter: "${.PVC.annotations.dir}/disk"}
+	options := createOptions("pv-5", "1Mi")
+	options.PVC.Annotations = map[string]string{"dir": "pv-0"}
+	if _, err := testProvisioner.Provision(options); err == nil {
+		t.Errorf("Provision() into the directory of another PV succeeded")
+	}
+
+	storageClass.Parameters = nil
+	pv, err = testProvisioner.Provision(createOptions("pv-3", ""))
+	if err != nil {
+		t.Fatalf("Provision() without request error = %v", err)
+	}
+	if capacity := pv.Spec.Capacity[v1.ResourceStorage]; capacity.Cmp(*available) > 0 {
+		t.Errorf("Provision() capacity = %s, larger than available %s", capacity.String(), available.String())
+	}
+
+	// Requests larger than the free space fail, and the claims larger than
+	// the whole filesystem are not provisioned.
+	if _, err := testProvisioner.Provision(createOptions("pv-4", "1Ei")); err == nil {
+		t.Errorf("Provision() of a request larger than the free space succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(pvDir, "pv-4")); !os.IsNotExist(err) {
+		t.Errorf("Provision() of a request larger than the free space created the volume: %v", err)
+	}
+	pvc := createOptions("pv-4", "1Ei").PVC
+	pvc.Annotations = getSelectedNodeAnnotation("testNode")
+	wffc := storage.VolumeBindingWaitForFirstConsumer
+	if testProvisioner.ShouldProvision(pvc, &storage.StorageClass{VolumeBindingMode: &wffc}) {
+		t.Errorf("ShouldProvision() of a request larger than the filesystem = true")
+	}
 }
 
-func createPv(identity, nodeName, dirPath string) *v1.PersistentVolume {
-	return &v1.PersistentVolume{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "pv",
-			Annotations: map[string]string{
-				"hostPathProvisionerIdentity": identity,
-				"kubevirt.io/provisionOnNode": nodeName,
+func Test_ProvisionStorageClass(t *testing.T) {
+	testProvisioner := &hostPathProvisioner{
+		pools:       map[string]string{legacyPoolName: t.TempDir()},
+		defaultPool: legacyPoolName,
+		identity:    "testId",
+		nodeName:    "testNode",
+	}
+	retain := v1.PersistentVolumeReclaimRetain
+	options := controller.ProvisionOptions{
+		PVName: "pv-1",
+		PVC: &v1.PersistentVolumeClaim{
+			Spec: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOncePod},
 			},
 		},
-		Spec: v1.PersistentVolumeSpec{
-			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete,
-			AccessModes: []v1.PersistentVolumeAccessMode{
-				v1.ReadWriteOnce,
-			},
-			Capacity: v1.ResourceList{
-				v1.ResourceName(v1.ResourceStorage): resource.MustParse("2Gi"),
-			},
-			PersistentVolumeSource: v1.PersistentVolumeSource{
-				HostPath: &v1.HostPathVolumeSource{
-					Path: dirPath,
-				},
-			},
-			NodeAffinity: &v1.VolumeNodeAffinity{
-				Required: &v1.NodeSelector{
-					NodeSelectorTerms: []v1.NodeSelectorTerm{
-						{
-							MatchExpressions: []v1.NodeSelectorRequirement{
-								{
-									Key:      "kubernetes.io/hostname",
-									Operator: v1.NodeSelectorOpIn,
-									Values: []string{
-										nodeName,
-									},
-								},
-							},
-						},
-					},
-				},
+		StorageClass: &storage.StorageClass{
+			ReclaimPolicy: &retain,
+			Parameters:    map[string]string{onDeleteParameter: "Archive"},
+		},
+	}
+	pv, err := testProvisioner.Provision(options)
+	if err != nil {
+		t.Fatalf("Provision() error = %v", err)
+	}
+	if pv.Spec.PersistentVolumeReclaimPolicy != retain {
+		t.Errorf("Provision() reclaim policy = %s, want %s", pv.Spec.PersistentVolumeReclaimPolicy, retain)
+	}
+	if len(pv.Spec.AccessModes) != 1 || pv.Spec.AccessModes[0] != v1.ReadWriteOncePod {
+		t.Errorf("Provision() access modes = %v, want %v", pv.Spec.AccessModes, options.PVC.Spec.AccessModes)
+	}
+	if pv.Annotations[annOnDelete] != onDeleteArchive {
+		t.Errorf("Provision() onDelete annotation = %s, want %s", pv.Annotations[annOnDelete], onDeleteArchive)
+	}
+
+	options.StorageClass.Parameters[onDeleteParameter] = "shred"
+	if _, err := testProvisioner.Provision(options); err == nil {
+		t.Errorf("Provision() with invalid onDelete succeeded")
+	}
+	options.StorageClass.Parameters = nil
+	options.StorageClass.MountOptions = []string{"noatime"}
+	recorder := record.NewFakeRecorder(1)
+	testProvisioner.eventRecorder = recorder
+	pv, err = testProvisioner.Provision(options)
+	if err != nil {
+		t.Fatalf("Provision() with mountOptions error = %v", err)
+	}
+	if len(pv.Spec.MountOptions) != 0 {
+		t.Errorf("Provision() mount options = %v, want none", pv.Spec.MountOptions)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, mountOptionsIgnoredReason) {
+			t.Errorf("Provision() with mountOptions recorded %q, want %s", event, mountOptionsIgnoredReason)
+		}
+	default:
+		t.Errorf("Provision() with mountOptions recorded no event")
+	}
+}
+
+func Test_parseStoragePools(t *testing.T) {
+	tests := []struct {
+		name            string
+		pvDir           string
+		poolsJSON       string
+		wantPools       map[string]string
+		wantDefaultPool string
+		wantErr         bool
+	}{
+		{
+			name:            "PV_DIR only",
+			pvDir:           "/var/hpvolumes",
+			wantPools:       map[string]string{legacyPoolName: "/var/hpvolumes"},
+			wantDefaultPool: legacyPoolName,
+		},
+		{
+			name:            "pools only",
+			poolsJSON:       `[{"name":"fast","path":"/mnt/fast"},{"name":"slow","path":"/mnt/slow"}]`,
+			wantPools:       map[string]string{"fast": "/mnt/fast", "slow": "/mnt/slow"},
+			wantDefaultPool: "fast",
+		},
+		{
+			name:            "PV_DIR and pools",
+			pvDir:           "/var/hpvolumes",
+			poolsJSON:       `[{"name":"fast","path":"/mnt/fast"}]`,
+			wantPools:       map[string]string{legacyPoolName: "/var/hpvolumes", "fast": "/mnt/fast"},
+			wantDefaultPool: legacyPoolName,
+		},
+		{
+			name:    "nothing",
+			wantErr: true,
+		},
+		{
+			name:      "invalid JSON",
+			poolsJSON: `{"name":"fast"}`,
+			wantErr:   true,
+		},
+		{
+			name:      "pool without name",
+			poolsJSON: `[{"path":"/mnt/fast"}]`,
+			wantErr:   true,
+		},
+		{
+			name:      "relative path",
+			poolsJSON: `[{"name":"fast","path":"mnt/fast"}]`,
+			wantErr:   true,
+		},
+		{
+			name:      "duplicate pool",
+			pvDir:     "/var/hpvolumes",
+			poolsJSON: `[{"name":"legacy","path":"/mnt/fast"}]`,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pools, defaultPool, err := parseStoragePools(tt.pvDir, tt.poolsJSON)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseStoragePools() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(pools, tt.wantPools) || defaultPool != tt.wantDefaultPool {
+				t.Errorf("parseStoragePools() = %v, %s, want %v, %s", pools, defaultPool, tt.wantPools, tt.wantDefaultPool)
+			}
+		})
+	}
+}
+
+func Test_ProvisionStoragePool(t *testing.T) {
+	legacyDir := t.TempDir()
+	fastDir := t.TempDir()
+	testProvisioner := &hostPathProvisioner{
+		pools:       map[string]string{legacyPoolName: legacyDir, "fast": fastDir},
+		defaultPool: legacyPoolName,
+		identity:    "testId",
+		nodeName:    "testNode",
+	}
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: getSelectedNodeAnnotation("testNode"),
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			Resources: v1.VolumeResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Mi")},
 			},
 		},
 	}
+	wffc := storage.VolumeBindingWaitForFirstConsumer
+	tests := []struct {
+		name     string
+		pool     string
+		wantPath string
+		wantErr  bool
+	}{
+		{
+			name:     "default pool",
+			wantPath: filepath.Join(legacyDir, "pv"),
+		},
+		{
+			name:     "selected pool",
+			pool:     "fast",
+			wantPath: filepath.Join(fastDir, "pv"),
+		},
+		{
+			name:    "unknown pool",
+			pool:    "slow",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := &storage.StorageClass{
+				VolumeBindingMode: &wffc,
+				Parameters:        map[string]string{},
+			}
+			if tt.pool != "" {
+				class.Parameters[storagePoolParameter] = tt.pool
+			}
+			if got := testProvisioner.ShouldProvision(pvc, class); got == tt.wantErr {
+				t.Errorf("ShouldProvision() = %v, want %v", got, !tt.wantErr)
+			}
+			pv, err := testProvisioner.Provision(controller.ProvisionOptions{PVName: "pv", PVC: pvc, StorageClass: class})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Provision() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && pv.Spec.HostPath.Path != tt.wantPath {
+				t.Errorf("Provision() path = %s, want %s", pv.Spec.HostPath.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+// createCloneSource provisions a source claim with a file in its directory,
+// and returns the provisioner with a client knowing about it.
+func createCloneSource(t *testing.T, sourceNode string) *hostPathProvisioner {
+	testProvisioner := &hostPathProvisioner{
+		pools:       map[string]string{legacyPoolName: t.TempDir()},
+		defaultPool: legacyPoolName,
+		identity:    "testId",
+		nodeName:    sourceNode,
+	}
+	sourceClaim := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "source", Namespace: "vms"},
+		Spec: v1.PersistentVolumeClaimSpec{
+			VolumeName: "pv-source",
+			Resources: v1.VolumeResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("2Mi")},
+			},
+		},
+		Status: v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound},
+	}
+	sourceVolume, err := testProvisioner.Provision(controller.ProvisionOptions{PVName: "pv-source", PVC: sourceClaim})
+	if err != nil {
+		t.Fatalf("Provision() of source error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceVolume.Spec.HostPath.Path, "disk.img"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testProvisioner.nodeName = "testNode"
+	testProvisioner.client = fake.NewSimpleClientset(sourceClaim, sourceVolume, createCloneOptions("", "").PVC)
+	return testProvisioner
+}
+
+func createCloneOptions(pvName, request string) controller.ProvisionOptions {
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "clone", Namespace: "vms"},
+		Spec: v1.PersistentVolumeClaimSpec{
+			DataSource: &v1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "source"},
+		},
+	}
+	if request != "" {
+		pvc.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse(request)}
+	}
+	return controller.ProvisionOptions{PVName: pvName, PVC: pvc}
+}
+
+func Test_ProvisionExtClone(t *testing.T) {
+	testProvisioner := createCloneSource(t, "testNode")
+	oldCloneDirectoryFunc := cloneDirectoryFunc
+	defer func() {
+		cloneDirectoryFunc = oldCloneDirectoryFunc
+	}()
+	copyDone := make(chan struct{})
+	cloneDirectoryFunc = func(src, dst string) error {
+		<-copyDone
+		return copyDirectoryContents(src, dst)
+	}
+
+	options := createCloneOptions("pv-clone", "")
+	for i := 0; i < 2; i++ {
+		pv, state, err := testProvisioner.ProvisionExt(options)
+		if pv != nil || state != controller.ProvisioningInBackground || err == nil {
+			t.Fatalf("ProvisionExt() while copying = %v, %s, %v, want in background", pv, state, err)
+		}
+	}
+	close(copyDone)
+
+	var pv *v1.PersistentVolume
+	err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		volume, state, err := testProvisioner.ProvisionExt(options)
+		if state == controller.ProvisioningInBackground {
+			return false, nil
+		}
+		pv = volume
+		return true, err
+	})
+	if err != nil {
+		t.Fatalf("ProvisionExt() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(pv.Spec.HostPath.Path, "disk.img"))
+	if err != nil || string(data) != "data" {
+		t.Errorf("clone has data %q, error %v", string(data), err)
+	}
+	if capacity := pv.Spec.Capacity[v1.ResourceStorage]; capacity.Cmp(resource.MustParse("2Mi")) != 0 {
+		t.Errorf("ProvisionExt() capacity = %s, want the 2Mi of the source", capacity.String())
+	}
+	if len(testProvisioner.clones) != 0 {
+		t.Errorf("clones = %v, want none left", testProvisioner.clones)
+	}
+}
+
+func Test_ProvisionExtCloneFailure(t *testing.T) {
+	testProvisioner := createCloneSource(t, "testNode")
+	oldCloneDirectoryFunc := cloneDirectoryFunc
+	defer func() {
+		cloneDirectoryFunc = oldCloneDirectoryFunc
+	}()
+	cloneDirectoryFunc = func(src, dst string) error {
+		return errors.New("copy failed")
+	}
+
+	options := createCloneOptions("pv-clone", "")
+	if _, state, _ := testProvisioner.ProvisionExt(options); state != controller.ProvisioningInBackground {
+		t.Fatalf("ProvisionExt() state = %s, want %s", state, controller.ProvisioningInBackground)
+	}
+	var state controller.ProvisioningState
+	err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		_, state, _ = testProvisioner.ProvisionExt(options)
+		return state != controller.ProvisioningInBackground, nil
+	})
+	if err != nil {
+		t.Fatal("clone did not finish")
+	}
+	if state != controller.ProvisioningFinished {
+		t.Errorf("ProvisionExt() state = %s, want %s", state, controller.ProvisioningFinished)
+	}
+	if _, err := os.Stat(filepath.Join(testProvisioner.pools[legacyPoolName], "pv-clone")); !os.IsNotExist(err) {
+		t.Errorf("directory of failed clone was not removed: %v", err)
+	}
+}
+
+func Test_ProvisionExtCloneClaimDeleted(t *testing.T) {
+	testProvisioner := createCloneSource(t, "testNode")
+	oldCloneDirectoryFunc := cloneDirectoryFunc
+	defer func() {
+		cloneDirectoryFunc = oldCloneDirectoryFunc
+	}()
+	// Every copy waits for a value.
+	copies := make(chan struct{})
+	cloneDirectoryFunc = func(src, dst string) error {
+		<-copies
+		return copyDirectoryContents(src, dst)
+	}
+	pool := testProvisioner.pools[legacyPoolName]
+
+	// The claim of pv-clone-1 is deleted once its copy is done, and the one
+	// of pv-clone-2 during its copy.
+	options := createCloneOptions("pv-clone-1", "")
+	if _, state, _ := testProvisioner.ProvisionExt(options); state != controller.ProvisioningInBackground {
+		t.Fatalf("ProvisionExt() state = %s, want %s", state, controller.ProvisioningInBackground)
+	}
+	copies <- struct{}{}
+	err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		testProvisioner.clonesLock.Lock()
+		defer testProvisioner.clonesLock.Unlock()
+		return testProvisioner.clones["pv-clone-1"].done, nil
+	})
+	if err != nil {
+		t.Fatal("clone did not finish")
+	}
+	if err := testProvisioner.client.CoreV1().PersistentVolumeClaims("vms").Delete(context.TODO(), "clone", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	testProvisioner.clones["pv-clone-2"] = &cloneState{
+		claim:  options.PVC,
+		volume: &v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{HostPath: &v1.HostPathVolumeSource{Path: filepath.Join(pool, "pv-clone-2")}}}},
+	}
+	if err := os.Mkdir(filepath.Join(pool, "pv-clone-2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	go testProvisioner.cloneVolume(testProvisioner.clones["pv-clone-2"], filepath.Join(pool, "pv-source"), filepath.Join(pool, "pv-clone-2"))
+
+	// The retries of the deleted claim drop both clones.
+	if pv, state, err := testProvisioner.ProvisionExt(options); pv != nil || state != controller.ProvisioningFinished || err == nil {
+		t.Errorf("ProvisionExt() of deleted claim = %v, %s, %v, want final error", pv, state, err)
+	}
+	if len(testProvisioner.clones) != 0 {
+		t.Errorf("clones = %v, want none left", testProvisioner.clones)
+	}
+	if _, err := os.Stat(filepath.Join(pool, "pv-clone-1")); !os.IsNotExist(err) {
+		t.Errorf("directory of clone of deleted claim was not removed: %v", err)
+	}
+	copies <- struct{}{}
+	err = wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		_, err := os.Stat(filepath.Join(pool, "pv-clone-2"))
+		return os.IsNotExist(err), nil
+	})
+	if err != nil {
+		t.Errorf("directory of clone of claim deleted during the copy was not removed")
+	}
+}
+
+func Test_ProvisionExt(t *testing.T) {
+	otherNodeProvisioner := createCloneSource(t, "otherNode")
+	testProvisioner := createCloneSource(t, "testNode")
+	// The source of largeSourceProvisioner is larger than the free space.
+	largeSourceProvisioner := createCloneSource(t, "testNode")
+	largeSource, err := largeSourceProvisioner.client.CoreV1().PersistentVolumes().Get(context.TODO(), "pv-source", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	largeSource.Spec.Capacity[v1.ResourceStorage] = resource.MustParse("1Ei")
+	if _, err := largeSourceProvisioner.client.CoreV1().PersistentVolumes().Update(context.TODO(), largeSource, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	snapshotGroup := "snapshot.storage.k8s.io"
+	tests := []struct {
+		name        string
+		provisioner *hostPathProvisioner
+		options     func() controller.ProvisionOptions
+		wantErr     bool
+	}{
+		{
+			name:        "no data source",
+			provisioner: testProvisioner,
+			options: func() controller.ProvisionOptions {
+				options := createCloneOptions("pv", "1Mi")
+				options.PVC.Spec.DataSource = nil
+				return options
+			},
+		},
+		{
+			name:        "snapshot data source",
+			provisioner: testProvisioner,
+			options: func() controller.ProvisionOptions {
+				options := createCloneOptions("pv", "")
+				options.PVC.Spec.DataSource = &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot"}
+				return options
+			},
+			wantErr: true,
+		},
+		{
+			name:        "missing source",
+			provisioner: testProvisioner,
+			options: func() controller.ProvisionOptions {
+				options := createCloneOptions("pv", "")
+				options.PVC.Spec.DataSource.Name = "missing"
+				return options
+			},
+			wantErr: true,
+		},
+		{
+			name:        "source on other node",
+			provisioner: otherNodeProvisioner,
+			options: func() controller.ProvisionOptions {
+				return createCloneOptions("pv", "")
+			},
+			wantErr: true,
+		},
+		{
+			name:        "smaller than source",
+			provisioner: testProvisioner,
+			options: func() controller.ProvisionOptions {
+				return createCloneOptions("pv", "1Mi")
+			},
+			wantErr: true,
+		},
+		{
+			name:        "source larger than free space",
+			provisioner: largeSourceProvisioner,
+			options: func() controller.ProvisionOptions {
+				return createCloneOptions("pv", "")
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pv, state, err := tt.provisioner.ProvisionExt(tt.options())
+			if state != controller.ProvisioningFinished {
+				t.Errorf("ProvisionExt() state = %s, want %s", state, controller.ProvisioningFinished)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ProvisionExt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && pv == nil {
+				t.Errorf("ProvisionExt() returned no PV")
+			}
+		})
+	}
+}
+
+func Test_volumeMounts(t *testing.T) {
+	mounts := []mountInfo{
+		{device: "0:50", root: "/", mountPoint: "/"},
+		{device: "253:1", root: "/hpvolumes", mountPoint: "/var/hpvolumes"},
+		{device: "253:1", root: "/hpvolumes/pv-1", mountPoint: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~empty-dir/disk"},
+		{device: "253:1", root: "/hpvolumes/pv-2/data", mountPoint: "/run/data"},
+		{device: "253:1", root: "/hpvolumes/pv-10", mountPoint: "/run/pv-10"},
+		{device: "0:60", root: "/", mountPoint: "/var/hpvolumes/pv-3/tmp"},
+		{device: "0:70", root: "/hpvolumes/pv-4", mountPoint: "/run/other-device"},
+	}
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			name: "bind mount of the volume",
+			path: "/var/hpvolumes/pv-1",
+			want: []string{"/var/lib/kubelet/pods/uid/volumes/kubernetes.io~empty-dir/disk"},
+		},
+		{
+			name: "bind mount of a directory in the volume",
+			path: "/var/hpvolumes/pv-2",
+			want: []string{"/run/data"},
+		},
+		{
+			name: "mount in the volume",
+			path: "/var/hpvolumes/pv-3",
+			want: []string{"/var/hpvolumes/pv-3/tmp"},
+		},
+		{
+			name: "same root on another device",
+			path: "/var/hpvolumes/pv-4",
+			want: []string{},
+		},
+		{
+			name: "not mounted",
+			path: "/var/hpvolumes/pv-5",
+			want: []string{},
+		},
+		{
+			name: "unclean path",
+			path: "/var/hpvolumes/pv-1/../pv-1",
+			want: []string{"/var/lib/kubelet/pods/uid/volumes/kubernetes.io~empty-dir/disk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := volumeMounts(mounts, tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("volumeMounts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseMountInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	content := "22 1 253:1 / / rw,relatime shared:1 - xfs /dev/vda1 rw\n" +
+		"36 22 253:1 /hpvolumes/my\\040pv /run/my\\040disk rw,relatime shared:1 - xfs /dev/vda1 rw\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mounts, err := parseMountInfo(path)
+	if err != nil {
+		t.Fatalf("parseMountInfo() error = %v", err)
+	}
+	want := []mountInfo{
+		{device: "253:1", root: "/", mountPoint: "/"},
+		{device: "253:1", root: "/hpvolumes/my pv", mountPoint: "/run/my disk"},
+	}
+	if !reflect.DeepEqual(mounts, want) {
+		t.Errorf("parseMountInfo() = %v, want %v", mounts, want)
+	}
+}
+
+func Test_ShouldDelete(t *testing.T) {
+	oldProcPath, oldDeviceNumber := procPath, deviceNumber
+	defer func() {
+		procPath, deviceNumber = oldProcPath, oldDeviceNumber
+	}()
+	procPath = t.TempDir()
+	fakeLosetup := setupFakeLosetup(t)
+	// Process 45 opened the device node of its volumeDevice, /dev/xvda, which
+	// is /dev/loop2.
+	deviceNumbers := map[string]uint64{"/dev/loop0": 1, "/dev/loop1": 2, "/dev/loop2": 3, "/dev/xvda": 3}
+	deviceNumber = func(path string) (uint64, bool) {
+		if target, err := os.Readlink(path); err == nil {
+			path = target
+		}
+		number, ok := deviceNumbers[path]
+		return number, ok
+	}
+	pvDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procPath, "self"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mountInfo := fmt.Sprintf("22 1 253:1 / / rw - xfs /dev/vda1 rw\n"+
+		"36 22 253:1 /mounted /run/mounted rw - xfs /dev/vda1 rw\n"+
+		"37 22 253:1 / %s rw - xfs /dev/vda1 rw\n"+
+		"38 22 0:5 / /dev rw - devtmpfs devtmpfs rw\n", pvDir)
+	if err := os.WriteFile(filepath.Join(procPath, "self", "mountinfo"), []byte(mountInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(procPath, "42", "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(pvDir, "open", "disk.img"), filepath.Join(procPath, "42", "fd", "3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(procPath, "45", "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/dev/xvda", filepath.Join(procPath, "45", "fd", "3")); err != nil {
+		t.Fatal(err)
+	}
+	// Process 43 runs in a pod with a hostPath volume, and process 44 in a pod
+	// with a volumeDevice.
+	for _, dir := range []string{"self/ns", "42/ns", "43/ns", "44/ns"} {
+		if err := os.MkdirAll(filepath.Join(procPath, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for pid, namespace := range map[string]string{"self": "mnt:[1]", "42": "mnt:[1]", "43": "mnt:[2]", "44": "mnt:[3]"} {
+		if err := os.Symlink(namespace, filepath.Join(procPath, pid, "ns", "mnt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	podMountInfo := "50 40 253:1 /pod-volume/data /data rw - xfs /dev/vda1 rw\n"
+	if err := os.WriteFile(filepath.Join(procPath, "43", "mountinfo"), []byte(podMountInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blockPodMountInfo := "60 40 0:5 /loop1 /dev/xvda rw - devtmpfs devtmpfs rw\n"
+	if err := os.WriteFile(filepath.Join(procPath, "44", "mountinfo"), []byte(blockPodMountInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	testProvisioner := &hostPathProvisioner{
+		identity:      "testId",
+		nodeName:      "testNode",
+		eventRecorder: recorder,
+	}
+	tests := []struct {
+		name       string
+		path       string
+		phase      v1.PersistentVolumePhase
+		nodeName   string
+		onDelete   string
+		device     string
+		want       bool
+		wantReason string
+	}{
+		{
+			name:  "not in use",
+			path:  filepath.Join(pvDir, "unused"),
+			phase: v1.VolumeReleased,
+			want:  true,
+		},
+		{
+			name:       "mounted",
+			path:       "/mounted",
+			phase:      v1.VolumeReleased,
+			want:       false,
+			wantReason: blockedMounted,
+		},
+		{
+			name:       "mounted in a pod",
+			path:       "/pod-volume",
+			phase:      v1.VolumeReleased,
+			want:       false,
+			wantReason: blockedMounted,
+		},
+		{
+			name:       "open files",
+			path:       filepath.Join(pvDir, "open"),
+			phase:      v1.VolumeReleased,
+			want:       false,
+			wantReason: blockedOpenFiles,
+		},
+		{
+			name:       "archived",
+			path:       filepath.Join(pvDir, "open"),
+			phase:      v1.VolumeReleased,
+			onDelete:   onDeleteArchive,
+			want:       false,
+			wantReason: blockedOpenFiles,
+		},
+		{
+			name:     "retained",
+			path:     filepath.Join(pvDir, "open"),
+			phase:    v1.VolumeReleased,
+			onDelete: onDeleteRetain,
+			want:     true,
+		},
+		{
+			name:   "block not in use",
+			path:   filepath.Join(pvDir, "block-unused"),
+			phase:  v1.VolumeReleased,
+			device: "/dev/loop0",
+			want:   true,
+		},
+		{
+			name:       "block mapped in a pod",
+			path:       filepath.Join(pvDir, "block-mapped"),
+			phase:      v1.VolumeReleased,
+			device:     "/dev/loop1",
+			want:       false,
+			wantReason: blockedMounted,
+		},
+		{
+			name:       "block open",
+			path:       filepath.Join(pvDir, "block-open"),
+			phase:      v1.VolumeReleased,
+			device:     "/dev/loop2",
+			want:       false,
+			wantReason: blockedOpenFiles,
+		},
+		{
+			name:       "block retained",
+			path:       filepath.Join(pvDir, "block-open"),
+			phase:      v1.VolumeReleased,
+			onDelete:   onDeleteRetain,
+			device:     "/dev/loop2",
+			want:       false,
+			wantReason: blockedOpenFiles,
+		},
+		{
+			name:  "bound",
+			path:  filepath.Join(pvDir, "open"),
+			phase: v1.VolumeBound,
+			want:  true,
+		},
+		{
+			name:     "other node",
+			path:     filepath.Join(pvDir, "open"),
+			phase:    v1.VolumeReleased,
+			nodeName: "otherNode",
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeName := "testNode"
+			if tt.nodeName != "" {
+				nodeName = tt.nodeName
+			}
+			volume := createPv("testId", nodeName, tt.path)
+			volume.Status.Phase = tt.phase
+			if tt.device != "" {
+				if err := os.MkdirAll(tt.path, 0755); err != nil {
+					t.Fatal(err)
+				}
+				image := filepath.Join(tt.path, blockImageFile)
+				if err := os.WriteFile(image, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				fakeLosetup.devices[image] = tt.device
+				block := v1.PersistentVolumeBlock
+				volume.Spec.VolumeMode = &block
+				volume.Spec.HostPath = nil
+				volume.Spec.Local = &v1.LocalVolumeSource{Path: filepath.Join(tt.path, blockDeviceLink)}
+			}
+			if tt.onDelete != "" {
+				volume.Annotations[annOnDelete] = tt.onDelete
+			}
+			blocked := 0.0
+			if tt.wantReason != "" {
+				blocked = metrics.GetProvisionerDeletionsBlocked(tt.wantReason)
+			}
+			if got := testProvisioner.ShouldDelete(volume); got != tt.want {
+				t.Errorf("ShouldDelete() = %v, want %v", got, tt.want)
+			}
+			if tt.wantReason == "" {
+				if len(recorder.Events) != 0 {
+					t.Errorf("ShouldDelete() recorded event %s", <-recorder.Events)
+				}
+				return
+			}
+			if got := metrics.GetProvisionerDeletionsBlocked(tt.wantReason); got != blocked+1 {
+				t.Errorf("blocked deletions with reason %s = %v, want %v", tt.wantReason, got, blocked+1)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !strings.Contains(event, volumeInUseReason) {
+					t.Errorf("ShouldDelete() recorded event %s, want %s", event, volumeInUseReason)
+				}
+			default:
+				t.Errorf("ShouldDelete() recorded no event")
+			}
+		})
+	}
+}
+
+// fakeLosetup attaches images to loop devices without the kernel.
+type fakeLosetup struct {
+	devices map[string]string
+	next    int
+	// failing are the images that fail to attach.
+	failing map[string]bool
+}
+
+func (f *fakeLosetup) losetup(args ...string) (string, error) {
+	switch args[0] {
+	case "--find":
+		if f.failing[args[len(args)-1]] {
+			return "", fmt.Errorf("no free loop device")
+		}
+		device := fmt.Sprintf("/dev/loop%d", f.next)
+		f.next++
+		f.devices[args[len(args)-1]] = device
+		return device, nil
+	case "--list":
+		return f.devices[args[len(args)-1]], nil
+	case "--detach":
+		for image, device := range f.devices {
+			if device == args[1] {
+				delete(f.devices, image)
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("%s is not attached", args[1])
+	}
+	return "", fmt.Errorf("unexpected losetup %v", args)
+}
+
+// setupFakeLosetup fakes losetup, and the directory of the device links.
+func setupFakeLosetup(t *testing.T) *fakeLosetup {
+	oldLosetupFunc, oldBlockDeviceDir := losetupFunc, blockDeviceDir
+	t.Cleanup(func() {
+		losetupFunc, blockDeviceDir = oldLosetupFunc, oldBlockDeviceDir
+	})
+	fakeLosetup := &fakeLosetup{devices: make(map[string]string), failing: make(map[string]bool)}
+	losetupFunc = fakeLosetup.losetup
+	blockDeviceDir = filepath.Join(t.TempDir(), "dev")
+	return fakeLosetup
+}
+
+// readDeviceLink returns the loop device the block device link links to
+// through the device link of the PV.
+func readDeviceLink(link string) (string, error) {
+	deviceLink, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Dir(deviceLink) != blockDeviceDir {
+		return "", fmt.Errorf("%s links to %s, not to a device link", link, deviceLink)
+	}
+	return os.Readlink(deviceLink)
+}
+
+func Test_ProvisionBlock(t *testing.T) {
+	fakeLosetup := setupFakeLosetup(t)
+
+	pvDir := t.TempDir()
+	testProvisioner := &hostPathProvisioner{
+		pools:       map[string]string{legacyPoolName: pvDir},
+		defaultPool: legacyPoolName,
+		identity:    "testId",
+		nodeName:    "testNode",
+	}
+	if !testProvisioner.SupportsBlock() {
+		t.Fatal("SupportsBlock() = false")
+	}
+	block := v1.PersistentVolumeBlock
+	options := controller.ProvisionOptions{
+		PVName: "pv-block",
+		PVC: &v1.PersistentVolumeClaim{
+			Spec: v1.PersistentVolumeClaimSpec{
+				VolumeMode: &block,
+			},
+		},
+	}
+	if _, err := testProvisioner.Provision(options); err == nil {
+		t.Errorf("Provision() of block volume without request succeeded")
+	}
+
+	options.PVC.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Mi")}
+	pv, err := testProvisioner.Provision(options)
+	if err != nil {
+		t.Fatalf("Provision() error = %v", err)
+	}
+	vPath := filepath.Join(pvDir, "pv-block")
+	if pv.Spec.VolumeMode == nil || *pv.Spec.VolumeMode != block || pv.Spec.Local == nil || pv.Spec.HostPath != nil {
+		t.Fatalf("Provision() returned PV %v, want a local block volume", pv.Spec)
+	}
+	if pv.Spec.Local.Path != filepath.Join(vPath, blockDeviceLink) {
+		t.Errorf("Provision() local path = %s", pv.Spec.Local.Path)
+	}
+	info, err := os.Stat(filepath.Join(vPath, blockImageFile))
+	if err != nil || info.Size() != MiB {
+		t.Errorf("block image = %v, error %v, want %d bytes", info, err, MiB)
+	}
+	if target, err := readDeviceLink(pv.Spec.Local.Path); err != nil || target != "/dev/loop0" {
+		t.Errorf("device link = %s, error %v, want /dev/loop0", target, err)
+	}
+
+	// The loop devices and the device links are gone after a reboot.
+	fakeLosetup.devices = make(map[string]string)
+	if err := os.RemoveAll(blockDeviceDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pv.Spec.Local.Path); !os.IsNotExist(err) {
+		t.Errorf("device link resolves before reattach: %v", err)
+	}
+	pv.Status.Phase = v1.VolumeBound
+	testProvisioner.client = fake.NewSimpleClientset(pv, createPv("testId", "testNode", t.TempDir()))
+	if err := testProvisioner.reattachBlockDevices(); err != nil {
+		t.Fatalf("reattachBlockDevices() error = %v", err)
+	}
+	if target, err := readDeviceLink(pv.Spec.Local.Path); err != nil || target != "/dev/loop1" {
+		t.Errorf("device link after reattach = %s, error %v, want /dev/loop1", target, err)
+	}
+	if err := testProvisioner.reattachBlockDevices(); err != nil || len(fakeLosetup.devices) != 1 {
+		t.Errorf("reattachBlockDevices() of attached device error = %v, devices %v", err, fakeLosetup.devices)
+	}
+
+	if err := testProvisioner.Delete(pv); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if len(fakeLosetup.devices) != 0 {
+		t.Errorf("Delete() left devices %v attached", fakeLosetup.devices)
+	}
+	if _, err := os.Stat(vPath); !os.IsNotExist(err) {
+		t.Errorf("Delete() left %s: %v", vPath, err)
+	}
+	if _, err := os.Lstat(filepath.Join(blockDeviceDir, "pv-block")); !os.IsNotExist(err) {
+		t.Errorf("Delete() left the device link: %v", err)
+	}
+}
+
+func Test_reattachBlockDevicesInvalidatesLinks(t *testing.T) {
+	fakeLosetup := setupFakeLosetup(t)
+	pvDir := t.TempDir()
+	testProvisioner := &hostPathProvisioner{
+		pools:       map[string]string{legacyPoolName: pvDir},
+		defaultPool: legacyPoolName,
+		identity:    "testId",
+		nodeName:    "testNode",
+	}
+	block := v1.PersistentVolumeBlock
+	var pvs []runtime.Object
+	for _, name := range []string{"pv-a", "pv-b"} {
+		pv, err := testProvisioner.Provision(controller.ProvisionOptions{
+			PVName: name,
+			PVC: &v1.PersistentVolumeClaim{
+				Spec: v1.PersistentVolumeClaimSpec{
+					VolumeMode: &block,
+					Resources: v1.VolumeResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Mi")},
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Provision() error = %v", err)
+		}
+		pvs = append(pvs, pv)
+	}
+
+	// The provisioner restarts after the loop devices were detached, and the
+	// image of pv-a cannot be attached again while pv-b gets its loop device.
+	fakeLosetup.devices = make(map[string]string)
+	fakeLosetup.next = 0
+	fakeLosetup.failing[filepath.Join(pvDir, "pv-a", blockImageFile)] = true
+	testProvisioner.client = fake.NewSimpleClientset(pvs...)
+	if err := testProvisioner.reattachBlockDevices(); err != nil {
+		t.Fatalf("reattachBlockDevices() error = %v", err)
+	}
+	if target, err := readDeviceLink(filepath.Join(pvDir, "pv-b", blockDeviceLink)); err != nil || target != "/dev/loop0" {
+		t.Errorf("device link of pv-b = %s, error %v, want /dev/loop0", target, err)
+	}
+	if target, err := readDeviceLink(filepath.Join(pvDir, "pv-a", blockDeviceLink)); !os.IsNotExist(err) {
+		t.Errorf("device link of pv-a = %s, error %v, want it removed", target, err)
+	}
+}
+
+func getTotalCapacity(path string) (int64, error) {
+	statfs := &unix.Statfs_t{}
+	err := unix.Statfs(path, statfs)
+	if err != nil {
+		return int64(-1), err
+	}
+
+	// Capacity is total block count * block size
+	return int64(statfs.Blocks) * int64(statfs.Bsize), nil
+}
+
+func createPv(identity, nodeName, dirPath string) *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pv",
+			Annotations: map[string]string{
+				"hostPathProvisionerIdentity": identity,
+				"kubevirt.io/provisionOnNode": nodeName,
+			},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete,
+			AccessModes: []v1.PersistentVolumeAccessMode{
+				v1.ReadWriteOnce,
+			},
+			Capacity: v1.ResourceList{
+				v1.ResourceName(v1.ResourceStorage): resource.MustParse("2Gi"),
+			},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: dirPath,
+				},
+			},
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{
+							MatchExpressions: []v1.NodeSelectorRequirement{
+								{
+									Key:      "kubernetes.io/hostname",
+									Operator: v1.NodeSelectorOpIn,
+									Values: []string{
+										nodeName,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func validConfig() *Config {
+	cfg := defaultConfig()
+	cfg.NodeName = "node-1"
+	cfg.PVDir = "/var/hpvolumes"
+	return cfg
+}
+
+func Test_ConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:   "storage pools only",
+			modify: func(c *Config) { c.PVDir = ""; c.StoragePools = `[{"name":"fast","path":"/mnt/fast"}]` },
+		},
+		{
+			name:   "other provisioner name",
+			modify: func(c *Config) { c.ProvisionerName = "example.com/fast-hostpath" },
+		},
+		{
+			name:    "empty provisioner name",
+			modify:  func(c *Config) { c.ProvisionerName = "" },
+			wantErr: "invalid provisioner name",
+		},
+		{
+			name:    "invalid provisioner name",
+			modify:  func(c *Config) { c.ProvisionerName = "kubevirt.io/hostpath provisioner" },
+			wantErr: "invalid provisioner name",
+		},
+		{
+			name:    "no node name",
+			modify:  func(c *Config) { c.NodeName = "" },
+			wantErr: "node name must be set",
+		},
+		{
+			name:    "no storage",
+			modify:  func(c *Config) { c.PVDir = "" },
+			wantErr: "PV dir or storage pools must be set",
+		},
+		{
+			name:    "invalid storage pools",
+			modify:  func(c *Config) { c.StoragePools = `[{"name":"fast","path":"mnt/fast"}]` },
+			wantErr: "invalid storage pools",
+		},
+		{
+			name:    "leader election",
+			modify:  func(c *Config) { c.LeaderElection = true },
+			wantErr: "leader election cannot be enabled",
+		},
+		{
+			name:    "no threads",
+			modify:  func(c *Config) { c.Threadiness = 0 },
+			wantErr: "threadiness 0 must be at least 1",
+		},
+		{
+			name:    "negative failed provision threshold",
+			modify:  func(c *Config) { c.FailedProvisionThreshold = -1 },
+			wantErr: "failed provision threshold -1 must not be negative",
+		},
+		{
+			name:    "no resync period",
+			modify:  func(c *Config) { c.ResyncPeriod = metav1.Duration{} },
+			wantErr: "resync period 0s must be positive",
+		},
+		{
+			name:    "invalid metrics port",
+			modify:  func(c *Config) { c.MetricsPort = 70000 },
+			wantErr: "metrics port 70000 must be between 0 and 65535",
+		},
+		{
+			name:    "relative metrics path",
+			modify:  func(c *Config) { c.MetricsPort = 8080; c.MetricsPath = "metrics" },
+			wantErr: `metrics path "metrics" must start with /`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_loadConfig(t *testing.T) {
+	t.Setenv("NODE_NAME", "env-node")
+	t.Setenv("PV_DIR", "/var/hpvolumes")
+	t.Setenv("STORAGE_POOLS", "")
+	t.Setenv("USE_NAMING_PREFIX", "true")
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configFile, []byte(`provisionerName: example.com/fast-hostpath
+pvDir: /mnt/fast
+threadiness: 8
+resyncPeriod: 5m
+addFinalizer: true
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(invalidFile, []byte("threads: 8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    func(*Config)
+		wantErr bool
+	}{
+		{
+			name: "env",
+			want: func(c *Config) {},
+		},
+		{
+			name: "flags",
+			args: []string{"--provisioner-name=example.com/slow-hostpath", "--threadiness=2", "--failed-provision-threshold=0", "--metrics-port=8080"},
+			want: func(c *Config) {
+				c.ProvisionerName = "example.com/slow-hostpath"
+				c.Threadiness = 2
+				c.FailedProvisionThreshold = 0
+				c.MetricsPort = 8080
+			},
+		},
+		{
+			name: "file",
+			args: []string{"--config", configFile},
+			want: func(c *Config) {
+				c.ProvisionerName = "example.com/fast-hostpath"
+				c.PVDir = "/mnt/fast"
+				c.Threadiness = 8
+				c.ResyncPeriod = metav1.Duration{Duration: 5 * time.Minute}
+				c.AddFinalizer = true
+			},
+		},
+		{
+			name: "flags override file",
+			args: []string{"--threadiness=2", "--config", configFile, "--add-finalizer=false"},
+			want: func(c *Config) {
+				c.ProvisionerName = "example.com/fast-hostpath"
+				c.PVDir = "/mnt/fast"
+				c.Threadiness = 2
+				c.ResyncPeriod = metav1.Duration{Duration: 5 * time.Minute}
+			},
+		},
+		{
+			name:    "unknown field in file",
+			args:    []string{"--config", invalidFile},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			args:    []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid config",
+			args:    []string{"--threadiness=0"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("provisioner", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			cfg, err := loadConfig(fs, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := defaultConfig()
+			want.NodeName = "env-node"
+			want.PVDir = "/var/hpvolumes"
+			want.UseNamingPrefix = true
+			tt.want(want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("loadConfig() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
 }
@@ -0,0 +1,177 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"kubevirt.io/hostpath-provisioner/controller"
+)
+
+const (
+	// pathPatternParameter is the StorageClass parameter with the pattern of
+	// the directory created for a volume, relative to PV_DIR.
+	pathPatternParameter = "pathPattern"
+	// pvMarkerSuffix is the suffix of the hidden file next to a directory
+	// named by a path pattern, recording which PV owns the directory.
+	pvMarkerSuffix = ".pv"
+
+	pvcNamespaceVariable   = ".PVC.namespace"
+	pvcNameVariable        = ".PVC.name"
+	pvcAnnotationsVariable = ".PVC.annotations."
+	pvNameVariable         = ".PV.name"
+)
+
+var (
+	pathPatternVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+	unsafePathCharacter = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// expandPathPattern replaces the ${.PVC.namespace}, ${.PVC.name},
+// ${.PVC.annotations.<key>} and ${.PV.name} variables in pattern. The values
+// are sanitised so they cannot add directories, and the resulting path must
+// stay relative without going up.
+func expandPathPattern(pattern string, options controller.ProvisionOptions) (string, error) {
+	var expandErr error
+	expanded := pathPatternVariable.ReplaceAllStringFunc(pattern, func(match string) string {
+		variable := pathPatternVariable.FindStringSubmatch(match)[1]
+		var value string
+		switch {
+		case variable == pvcNamespaceVariable:
+			value = options.PVC.Namespace
+		case variable == pvcNameVariable:
+			value = options.PVC.Name
+		case variable == pvNameVariable:
+			value = options.PVName
+		case strings.HasPrefix(variable, pvcAnnotationsVariable):
+			key := strings.TrimPrefix(variable, pvcAnnotationsVariable)
+			annotation, ok := options.PVC.Annotations[key]
+			if !ok {
+				expandErr = fmt.Errorf("claim has no annotation %s for %s %s", key, pathPatternParameter, pattern)
+			}
+			value = annotation
+		default:
+			expandErr = fmt.Errorf("unknown variable %s in %s %s", match, pathPatternParameter, pattern)
+		}
+		return sanitizePathElement(value)
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	if path.IsAbs(expanded) {
+		return "", fmt.Errorf("%s %s must be relative", pathPatternParameter, pattern)
+	}
+	for _, element := range strings.Split(expanded, "/") {
+		if element == "" || element == "." || element == ".." {
+			return "", fmt.Errorf("%s %s expands to invalid path %q", pathPatternParameter, pattern, expanded)
+		}
+	}
+	return expanded, nil
+}
+
+// sanitizePathElement replaces the characters not safe in a directory name,
+// including the path separator, by dashes.
+func sanitizePathElement(value string) string {
+	return unsafePathCharacter.ReplaceAllString(value, "-")
+}
+
+// pvMarkerPath returns the path of the file recording the PV owning the
+// directory at vPath. It is kept next to the directory rather than in it, so
+// the volume starts empty.
+func pvMarkerPath(vPath string) string {
+	return filepath.Join(filepath.Dir(vPath), "."+filepath.Base(vPath)+pvMarkerSuffix)
+}
+
+// claimVolumeDirectory creates the directory at vPath for the PV, and records
+// the PV in a marker file so a pattern expanding to the same path for another
+// claim is rejected instead of sharing the data. The directory must not exist
+// yet, and must not be inside or contain one of volumePaths, the directories
+// of the other PVs. Retrying for the same PV succeeds.
+func claimVolumeDirectory(vPath, pvName string, volumePaths []string) error {
+	for _, volumePath := range volumePaths {
+		if isPathWithin(vPath, volumePath) || isPathWithin(volumePath, vPath) {
+			return fmt.Errorf("path %s overlaps the directory %s of another PV", vPath, volumePath)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(vPath), 0777); err != nil {
+		return err
+	}
+	marker := pvMarkerPath(vPath)
+	f, err := os.OpenFile(marker, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		// Provisioned before, or another claim expanding to the same path
+		// got there first.
+		if err := checkVolumeDirectoryOwner(vPath, pvName); err != nil {
+			return err
+		}
+		return os.MkdirAll(vPath, 0777)
+	} else if err != nil {
+		return err
+	}
+	_, err = f.WriteString(pvName)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = checkVolumeDirectoryMissing(vPath)
+	}
+	if err == nil {
+		err = os.MkdirAll(vPath, 0777)
+	}
+	if err != nil {
+		os.Remove(marker)
+		return err
+	}
+	return nil
+}
+
+// checkVolumeDirectoryMissing fails when vPath already exists, even empty, as
+// it was not created for the PV and may be used by something else.
+func checkVolumeDirectoryMissing(vPath string) error {
+	if _, err := os.Lstat(vPath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return fmt.Errorf("path %s already exists", vPath)
+}
+
+func checkVolumeDirectoryOwner(vPath, pvName string) error {
+	owner, err := os.ReadFile(pvMarkerPath(vPath))
+	if err != nil {
+		return err
+	}
+	if string(owner) != pvName {
+		return fmt.Errorf("path %s is already used by PV %s", vPath, string(owner))
+	}
+	return nil
+}
+
+// releaseVolumeDirectory removes the record of the PV owning the directory at
+// vPath, if it was named by a path pattern.
+func releaseVolumeDirectory(vPath string) error {
+	if err := os.Remove(pvMarkerPath(vPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
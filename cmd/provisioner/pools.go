@@ -0,0 +1,88 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	storage "k8s.io/api/storage/v1"
+
+	"kubevirt.io/hostpath-provisioner/pkg/hostpath"
+)
+
+const (
+	// storagePoolParameter is the StorageClass parameter selecting the pool
+	// the volumes are created in, like with the CSI driver.
+	storagePoolParameter = "storagePool"
+	// legacyPoolName is the name of the pool in PV_DIR.
+	legacyPoolName = "legacy"
+)
+
+// parseStoragePools returns the paths of the storage pools by name, and the
+// name of the pool used when the storage class does not select one. pvDir is
+// the legacy pool, and poolsJSON a list of pools in the format of the datadir
+// of the CSI driver. The legacy pool is the default when set, otherwise the
+// first pool of the list.
+func parseStoragePools(pvDir, poolsJSON string) (map[string]string, string, error) {
+	pools := make(map[string]string)
+	defaultPool := ""
+	if pvDir != "" {
+		pools[legacyPoolName] = pvDir
+		defaultPool = legacyPoolName
+	}
+	if poolsJSON != "" {
+		storagePools := make([]hostpath.StoragePoolInfo, 0)
+		if err := json.Unmarshal([]byte(poolsJSON), &storagePools); err != nil {
+			return nil, "", fmt.Errorf("unable to parse storage pools: %w", err)
+		}
+		for _, pool := range storagePools {
+			if pool.Name == "" {
+				return nil, "", fmt.Errorf("storage pool with path %s has no name", pool.Path)
+			}
+			if !filepath.IsAbs(pool.Path) {
+				return nil, "", fmt.Errorf("path %q of storage pool %s must be absolute", pool.Path, pool.Name)
+			}
+			if _, ok := pools[pool.Name]; ok {
+				return nil, "", fmt.Errorf("duplicate storage pool %s", pool.Name)
+			}
+			pools[pool.Name] = pool.Path
+			if defaultPool == "" {
+				defaultPool = pool.Name
+			}
+		}
+	}
+	if len(pools) == 0 {
+		return nil, "", errors.New("no storage pool configured")
+	}
+	return pools, defaultPool, nil
+}
+
+// poolPath returns the path of the pool selected by the storage class.
+func (p *hostPathProvisioner) poolPath(class *storage.StorageClass) (string, error) {
+	name := p.defaultPool
+	if class != nil && class.Parameters[storagePoolParameter] != "" {
+		name = class.Parameters[storagePoolParameter]
+	}
+	path, ok := p.pools[name]
+	if !ok {
+		return "", fmt.Errorf("unknown storage pool %s", name)
+	}
+	return path, nil
+}
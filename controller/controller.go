@@ -65,7 +65,11 @@ const annClass = "volume.beta.kubernetes.io/storage-class"
 // recognize dynamically provisioned PVs in its decisions).
 const annDynamicallyProvisioned = "pv.kubernetes.io/provisioned-by"
 
-const annStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
+// These annotations are added to a PVC to be dynamically provisioned by
+// Kubernetes, the beta one by older versions and both by newer versions. Their
+// value is the name of the provisioner.
+const annBetaStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
+const annStorageProvisioner = "volume.kubernetes.io/storage-provisioner"
 
 // This annotation is added to a PVC that has been triggered by scheduler to
 // be dynamically provisioned. Its value is the name of the selected node.
@@ -114,8 +118,13 @@ type ProvisionController struct {
 	// To determine if the informer is internal or external
 	customClaimInformer, customVolumeInformer, customClassInformer bool
 
-	claimQueue  workqueue.RateLimitingInterface
-	volumeQueue workqueue.RateLimitingInterface
+	// Filters of the claims and volumes the controller processes, all of them
+	// when nil.
+	claimFilter  func(*v1.PersistentVolumeClaim) bool
+	volumeFilter func(*v1.PersistentVolume) bool
+
+	claimQueue  workqueue.TypedRateLimitingInterface[string]
+	volumeQueue workqueue.TypedRateLimitingInterface[string]
 
 	// Identity of this controller, generated at creation time and not persisted
 	// across restarts. Useful only for debugging, for seeing the source of
@@ -127,14 +136,14 @@ type ProvisionController struct {
 
 	resyncPeriod time.Duration
 
-	rateLimiter               workqueue.RateLimiter
+	rateLimiter               workqueue.TypedRateLimiter[string]
 	exponentialBackOffOnError bool
 	threadiness               int
 
 	createProvisionedPVBackoff    *wait.Backoff
 	createProvisionedPVRetryCount int
 	createProvisionedPVInterval   time.Duration
-	createProvisionerPVLimiter    workqueue.RateLimiter
+	createProvisionerPVLimiter    workqueue.TypedRateLimiter[string]
 
 	failedProvisionThreshold, failedDeleteThreshold int
 
@@ -230,9 +239,9 @@ func Threadiness(threadiness int) func(*ProvisionController) error {
 	}
 }
 
-// RateLimiter is the workqueue.RateLimiter to use for the provisioning and
+// RateLimiter is the workqueue.TypedRateLimiter to use for the provisioning and
 // deleting work queues. If set, ExponentialBackOffOnError is ignored.
-func RateLimiter(rateLimiter workqueue.RateLimiter) func(*ProvisionController) error {
+func RateLimiter(rateLimiter workqueue.TypedRateLimiter[string]) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
@@ -330,7 +339,7 @@ func CreateProvisionedPVBackoff(backoff wait.Backoff) func(*ProvisionController)
 // and the controller continues saving PV to API server indefinitely.
 // This option cannot be used with CreateProvisionedPVBackoff or CreateProvisionedPVInterval
 // or CreateProvisionedPVRetryCount.
-func CreateProvisionedPVLimiter(limiter workqueue.RateLimiter) func(*ProvisionController) error {
+func CreateProvisionedPVLimiter(limiter workqueue.TypedRateLimiter[string]) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
@@ -476,6 +485,33 @@ func ClassesInformer(informer cache.SharedInformer) func(*ProvisionController) e
 	}
 }
 
+// ClaimFilter sets a filter of the claims the controller queues for
+// provisioning, for instance the claims of the node when every node runs its
+// own provisioner. Claims are queued when they start matching the filter.
+// The filter only applies to the queue, the controller still watches and
+// caches all the claims.
+func ClaimFilter(filter func(*v1.PersistentVolumeClaim) bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.claimFilter = filter
+		return nil
+	}
+}
+
+// VolumeFilter sets a filter of the volumes the controller queues for
+// deletion. Like the claim filter, it does not limit the watch of the volumes.
+func VolumeFilter(filter func(*v1.PersistentVolume) bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.volumeFilter = filter
+		return nil
+	}
+}
+
 // MetricsPort sets the port that metrics server serves on. Default: 0, set to non-zero to enable.
 func MetricsPort(metricsPort int32) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
@@ -596,23 +632,23 @@ func NewProvisionController(
 		}
 	}
 
-	var rateLimiter workqueue.RateLimiter
+	var rateLimiter workqueue.TypedRateLimiter[string]
 	if controller.rateLimiter != nil {
 		// rateLimiter set via parameter takes precedence
 		rateLimiter = controller.rateLimiter
 	} else if controller.exponentialBackOffOnError {
-		rateLimiter = workqueue.NewMaxOfRateLimiter(
-			workqueue.NewItemExponentialFailureRateLimiter(15*time.Second, 1000*time.Second),
-			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		rateLimiter = workqueue.NewTypedMaxOfRateLimiter(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](15*time.Second, 1000*time.Second),
+			&workqueue.TypedBucketRateLimiter[string]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
 		)
 	} else {
-		rateLimiter = workqueue.NewMaxOfRateLimiter(
-			workqueue.NewItemExponentialFailureRateLimiter(15*time.Second, 15*time.Second),
-			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		rateLimiter = workqueue.NewTypedMaxOfRateLimiter(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](15*time.Second, 15*time.Second),
+			&workqueue.TypedBucketRateLimiter[string]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
 		)
 	}
-	controller.claimQueue = workqueue.NewNamedRateLimitingQueue(rateLimiter, "claims")
-	controller.volumeQueue = workqueue.NewNamedRateLimitingQueue(rateLimiter, "volumes")
+	controller.claimQueue = workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter, workqueue.TypedRateLimitingQueueConfig[string]{Name: "claims", MetricsProvider: queueMetricsProvider{}})
+	controller.volumeQueue = workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter, workqueue.TypedRateLimitingQueueConfig[string]{Name: "volumes", MetricsProvider: queueMetricsProvider{}})
 
 	if controller.createProvisionerPVLimiter != nil {
 		glog.V(2).Infof("Using saving PVs to API server in background")
@@ -642,7 +678,7 @@ func NewProvisionController(
 	// ----------------------
 	// PersistentVolumeClaims
 
-	claimHandler := cache.ResourceEventHandlerFuncs{
+	var claimHandler cache.ResourceEventHandler = cache.ResourceEventHandlerFuncs{
 		AddFunc:    func(obj interface{}) { controller.enqueueClaim(obj) },
 		UpdateFunc: func(oldObj, newObj interface{}) { controller.enqueueClaim(newObj) },
 		DeleteFunc: func(obj interface{}) {
@@ -650,6 +686,15 @@ func NewProvisionController(
 			// or it's not in claimsInProgress and then we don't care
 		},
 	}
+	if controller.claimFilter != nil {
+		claimHandler = cache.FilteringResourceEventHandler{
+			FilterFunc: func(obj interface{}) bool {
+				claim, ok := deletedFinalStateObject(obj).(*v1.PersistentVolumeClaim)
+				return ok && controller.claimFilter(claim)
+			},
+			Handler: claimHandler,
+		}
+	}
 
 	if controller.claimInformer != nil {
 		controller.claimInformer.AddEventHandlerWithResyncPeriod(claimHandler, controller.resyncPeriod)
@@ -669,11 +714,20 @@ func NewProvisionController(
 	// -----------------
 	// PersistentVolumes
 
-	volumeHandler := cache.ResourceEventHandlerFuncs{
+	var volumeHandler cache.ResourceEventHandler = cache.ResourceEventHandlerFuncs{
 		AddFunc:    func(obj interface{}) { controller.enqueueVolume(obj) },
 		UpdateFunc: func(oldObj, newObj interface{}) { controller.enqueueVolume(newObj) },
 		DeleteFunc: func(obj interface{}) { controller.forgetVolume(obj) },
 	}
+	if controller.volumeFilter != nil {
+		volumeHandler = cache.FilteringResourceEventHandler{
+			FilterFunc: func(obj interface{}) bool {
+				volume, ok := deletedFinalStateObject(obj).(*v1.PersistentVolume)
+				return ok && controller.volumeFilter(volume)
+			},
+			Handler: volumeHandler,
+		}
+	}
 
 	if controller.volumeInformer != nil {
 		controller.volumeInformer.AddEventHandlerWithResyncPeriod(volumeHandler, controller.resyncPeriod)
@@ -698,6 +752,14 @@ func NewProvisionController(
 	return controller
 }
 
+// deletedFinalStateObject returns the object of a tombstone, or obj.
+func deletedFinalStateObject(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
+
 func getObjectUID(obj interface{}) (string, error) {
 	var object metav1.Object
 	var ok bool
@@ -755,18 +817,19 @@ func (ctrl *ProvisionController) forgetVolume(obj interface{}) {
 	ctrl.volumeQueue.Done(key)
 }
 
-// Run starts all of this controller's control loops
-func (ctrl *ProvisionController) Run(_ <-chan struct{}) {
-	// TODO: arg is as of 1.12 unused. Nothing can ever be cancelled. Should
-	// accept a context instead and use it instead of context.TODO(), but would
-	// break API. Not urgent: realistically, users are simply passing in
-	// wait.NeverStop() anyway.
+// Run starts all of this controller's control loops, and blocks until ctx is
+// cancelled and they have stopped.
+func (ctrl *ProvisionController) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	// Shutting down the queues stops the workers once they are done with
+	// their current item.
+	defer ctrl.claimQueue.ShutDown()
+	defer ctrl.volumeQueue.ShutDown()
 
 	run := func(ctx context.Context) {
 		glog.Infof("Starting provisioner controller %s!", ctrl.component)
 		defer utilruntime.HandleCrash()
-		defer ctrl.claimQueue.ShutDown()
-		defer ctrl.volumeQueue.ShutDown()
 
 		ctrl.hasRunLock.Lock()
 		ctrl.hasRun = true
@@ -774,14 +837,21 @@ func (ctrl *ProvisionController) Run(_ <-chan struct{}) {
 
 		// If a external SharedInformer has been passed in, this controller
 		// should not call Run again
-		if !ctrl.customClaimInformer {
-			go ctrl.claimInformer.Run(ctx.Done())
-		}
-		if !ctrl.customVolumeInformer {
-			go ctrl.volumeInformer.Run(ctx.Done())
-		}
-		if !ctrl.customClassInformer {
-			go ctrl.classInformer.Run(ctx.Done())
+		for _, informer := range []struct {
+			informer cache.SharedInformer
+			custom   bool
+		}{
+			{ctrl.claimInformer, ctrl.customClaimInformer},
+			{ctrl.volumeInformer, ctrl.customVolumeInformer},
+			{ctrl.classInformer, ctrl.customClassInformer},
+		} {
+			if !informer.custom {
+				wg.Add(1)
+				go func(informer cache.SharedInformer) {
+					defer wg.Done()
+					informer.Run(ctx.Done())
+				}(informer.informer)
+			}
 		}
 
 		if !cache.WaitForCacheSync(ctx.Done(), ctrl.claimInformer.HasSynced, ctrl.volumeInformer.HasSynced, ctrl.classInformer.HasSynced) {
@@ -789,23 +859,39 @@ func (ctrl *ProvisionController) Run(_ <-chan struct{}) {
 		}
 
 		for i := 0; i < ctrl.threadiness; i++ {
-			go wait.Until(ctrl.runClaimWorker, time.Second, context.TODO().Done())
-			go wait.Until(ctrl.runVolumeWorker, time.Second, context.TODO().Done())
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				wait.UntilWithContext(ctx, ctrl.runClaimWorker, time.Second)
+			}()
+			go func() {
+				defer wg.Done()
+				wait.UntilWithContext(ctx, ctrl.runVolumeWorker, time.Second)
+			}()
 		}
 
 		glog.Infof("Started provisioner controller %s!", ctrl.component)
 
-		select {}
+		<-ctx.Done()
+		glog.Infof("Stopping provisioner controller %s!", ctrl.component)
 	}
 
-	go ctrl.volumeStore.Run(context.TODO(), DefaultThreadiness)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctrl.volumeStore.Run(ctx, DefaultThreadiness)
+	}()
+
+	if ctrl.metricsPort > 0 {
+		ctrl.runMetricsServer(ctx, &wg)
+	}
 
 	if ctrl.leaderElection {
-		rl, err := resourcelock.New("endpoints",
+		rl, err := resourcelock.New(resourcelock.LeasesResourceLock,
 			ctrl.leaderElectionNamespace,
 			strings.Replace(ctrl.provisionerName, "/", "-", -1),
 			ctrl.client.CoreV1(),
-			nil,
+			ctrl.client.CoordinationV1(),
 			resourcelock.ResourceLockConfig{
 				Identity:      ctrl.id,
 				EventRecorder: ctrl.eventRecorder,
@@ -814,52 +900,67 @@ func (ctrl *ProvisionController) Run(_ <-chan struct{}) {
 			glog.Fatalf("Error creating lock: %v", err)
 		}
 
-		leaderelection.RunOrDie(context.TODO(), leaderelection.LeaderElectionConfig{
-			Lock:          rl,
-			LeaseDuration: ctrl.leaseDuration,
-			RenewDeadline: ctrl.renewDeadline,
-			RetryPeriod:   ctrl.retryPeriod,
+		// The controller may start leading while RunOrDie returns, so only
+		// run it when Run is not returning already.
+		var leadingLock sync.Mutex
+		stopped := false
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            rl,
+			LeaseDuration:   ctrl.leaseDuration,
+			RenewDeadline:   ctrl.renewDeadline,
+			RetryPeriod:     ctrl.retryPeriod,
+			ReleaseOnCancel: true,
 			Callbacks: leaderelection.LeaderCallbacks{
-				OnStartedLeading: run,
+				OnStartedLeading: func(ctx context.Context) {
+					leadingLock.Lock()
+					if stopped {
+						leadingLock.Unlock()
+						return
+					}
+					wg.Add(1)
+					leadingLock.Unlock()
+					defer wg.Done()
+					run(ctx)
+				},
 				OnStoppedLeading: func() {
-					glog.Fatalf("leaderelection lost")
+					if ctx.Err() == nil {
+						glog.Fatalf("leaderelection lost")
+					}
+					glog.Infof("Stopped leading as %s", ctrl.id)
 				},
 			},
 		})
-		panic("unreachable")
+		leadingLock.Lock()
+		stopped = true
+		leadingLock.Unlock()
 	} else {
-		run(context.TODO())
+		run(ctx)
 	}
 }
 
-func (ctrl *ProvisionController) runClaimWorker() {
-	for ctrl.processNextClaimWorkItem() {
+func (ctrl *ProvisionController) runClaimWorker(ctx context.Context) {
+	for ctrl.processNextClaimWorkItem(ctx) {
 	}
 }
 
-func (ctrl *ProvisionController) runVolumeWorker() {
-	for ctrl.processNextVolumeWorkItem() {
+func (ctrl *ProvisionController) runVolumeWorker(ctx context.Context) {
+	for ctrl.processNextVolumeWorkItem(ctx) {
 	}
 }
 
 // processNextClaimWorkItem processes items from claimQueue
-func (ctrl *ProvisionController) processNextClaimWorkItem() bool {
+func (ctrl *ProvisionController) processNextClaimWorkItem(ctx context.Context) bool {
 	obj, shutdown := ctrl.claimQueue.Get()
 
 	if shutdown {
 		return false
 	}
 
-	err := func(obj interface{}) error {
-		defer ctrl.claimQueue.Done(obj)
-		var key string
-		var ok bool
-		if key, ok = obj.(string); !ok {
-			ctrl.claimQueue.Forget(obj)
-			return fmt.Errorf("expected string in workqueue but got %#v", obj)
-		}
+	err := func(key string) error {
+		defer ctrl.claimQueue.Done(key)
+		obj := key
 
-		if _, err := ctrl.syncClaimHandler(key); err != nil {
+		if _, err := ctrl.syncClaimHandler(ctx, key); err != nil {
 			if ctrl.failedProvisionThreshold == 0 {
 				glog.Warningf("Retrying syncing claim %q, failure %v", key, ctrl.claimQueue.NumRequeues(obj))
 				ctrl.claimQueue.AddRateLimited(obj)
@@ -891,23 +992,18 @@ func (ctrl *ProvisionController) processNextClaimWorkItem() bool {
 }
 
 // processNextVolumeWorkItem processes items from volumeQueue
-func (ctrl *ProvisionController) processNextVolumeWorkItem() bool {
+func (ctrl *ProvisionController) processNextVolumeWorkItem(ctx context.Context) bool {
 	obj, shutdown := ctrl.volumeQueue.Get()
 
 	if shutdown {
 		return false
 	}
 
-	err := func(obj interface{}) error {
-		defer ctrl.volumeQueue.Done(obj)
-		var key string
-		var ok bool
-		if key, ok = obj.(string); !ok {
-			ctrl.volumeQueue.Forget(obj)
-			return fmt.Errorf("expected string in workqueue but got %#v", obj)
-		}
+	err := func(key string) error {
+		defer ctrl.volumeQueue.Done(key)
+		obj := key
 
-		if err := ctrl.syncVolumeHandler(key); err != nil {
+		if err := ctrl.syncVolumeHandler(ctx, key); err != nil {
 			if ctrl.failedDeleteThreshold == 0 {
 				glog.Warningf("Retrying syncing volume %q, failure %v", key, ctrl.volumeQueue.NumRequeues(obj))
 				ctrl.volumeQueue.AddRateLimited(obj)
@@ -935,7 +1031,7 @@ func (ctrl *ProvisionController) processNextVolumeWorkItem() bool {
 }
 
 // syncClaimHandler gets the claim from informer's cache then calls syncClaim
-func (ctrl *ProvisionController) syncClaimHandler(key string) (ProvisioningState, error) {
+func (ctrl *ProvisionController) syncClaimHandler(ctx context.Context, key string) (ProvisioningState, error) {
 	objs, err := ctrl.claimsIndexer.ByIndex(uidIndex, key)
 	if err != nil {
 		return ProvisioningFinished, err
@@ -951,7 +1047,7 @@ func (ctrl *ProvisionController) syncClaimHandler(key string) (ProvisioningState
 		}
 		claimObj = obj
 	}
-	status, err := ctrl.syncClaim(claimObj)
+	status, err := ctrl.syncClaim(ctx, claimObj)
 	if err == nil || status == ProvisioningFinished {
 		// Provisioning is 100% finished / not in progress.
 		glog.V(2).Infof("Final error received, removing PVC %s from claims in progress", key)
@@ -972,7 +1068,7 @@ func (ctrl *ProvisionController) syncClaimHandler(key string) (ProvisioningState
 }
 
 // syncVolumeHandler gets the volume from informer's cache then calls syncVolume
-func (ctrl *ProvisionController) syncVolumeHandler(key string) error {
+func (ctrl *ProvisionController) syncVolumeHandler(ctx context.Context, key string) error {
 	volumeObj, exists, err := ctrl.volumes.GetByKey(key)
 	if err != nil {
 		return err
@@ -982,12 +1078,12 @@ func (ctrl *ProvisionController) syncVolumeHandler(key string) error {
 		return nil
 	}
 
-	return ctrl.syncVolume(volumeObj)
+	return ctrl.syncVolume(ctx, volumeObj)
 }
 
 // syncClaim checks if the claim should have a volume provisioned for it and
 // provisions one if so.
-func (ctrl *ProvisionController) syncClaim(obj interface{}) (ProvisioningState, error) {
+func (ctrl *ProvisionController) syncClaim(ctx context.Context, obj interface{}) (ProvisioningState, error) {
 	claim, ok := obj.(*v1.PersistentVolumeClaim)
 	if !ok {
 		return ProvisioningFinished, fmt.Errorf("expected claim but got %+v", obj)
@@ -999,21 +1095,21 @@ func (ctrl *ProvisionController) syncClaim(obj interface{}) (ProvisioningState,
 	} else if should {
 		var status ProvisioningState
 		var err error
-		status, err = ctrl.provisionClaimOperation(claim)
+		status, err = ctrl.provisionClaimOperation(ctx, claim)
 		return status, err
 	}
 	return ProvisioningFinished, nil
 }
 
 // syncVolume checks if the volume should be deleted and deletes if so
-func (ctrl *ProvisionController) syncVolume(obj interface{}) error {
+func (ctrl *ProvisionController) syncVolume(ctx context.Context, obj interface{}) error {
 	volume, ok := obj.(*v1.PersistentVolume)
 	if !ok {
 		return fmt.Errorf("expected volume but got %+v", obj)
 	}
 
 	if ctrl.shouldDelete(volume) {
-		err := ctrl.deleteVolumeOperation(volume)
+		err := ctrl.deleteVolumeOperation(ctx, volume)
 		return err
 	}
 	return nil
@@ -1047,15 +1143,17 @@ func (ctrl *ProvisionController) shouldProvision(claim *v1.PersistentVolumeClaim
 	}
 
 	if qualifier, ok := ctrl.provisioner.(Qualifier); ok {
-		if !qualifier.ShouldProvision(claim, class.VolumeBindingMode) {
+		if !qualifier.ShouldProvision(claim, class) {
 			return false, nil
 		}
 	}
-	// Kubernetes 1.5 provisioning with annStorageProvisioner
+	// Kubernetes 1.5 provisioning with annBetaStorageProvisioner, and since 1.23 annStorageProvisioner
 	if ctrl.kubeVersion.AtLeast(utilversion.MustParseSemantic("v1.5.0")) {
-		if provisioner, found := claim.Annotations[annStorageProvisioner]; found {
-			if ctrl.knownProvisioner(provisioner) {
-				return true, nil
+		for _, ann := range []string{annStorageProvisioner, annBetaStorageProvisioner} {
+			if provisioner, found := claim.Annotations[ann]; found {
+				if ctrl.knownProvisioner(provisioner) {
+					return true, nil
+				}
 			}
 		}
 	} else {
@@ -1138,7 +1236,7 @@ func (ctrl *ProvisionController) checkFinalizer(volume *v1.PersistentVolume, fin
 // provisionClaimOperation attempts to provision a volume for the given claim.
 // Returns error, which indicates whether provisioning should be retried
 // (requeue the claim) or not
-func (ctrl *ProvisionController) provisionClaimOperation(claim *v1.PersistentVolumeClaim) (ProvisioningState, error) {
+func (ctrl *ProvisionController) provisionClaimOperation(ctx context.Context, claim *v1.PersistentVolumeClaim) (ProvisioningState, error) {
 	// Most code here is identical to that found in controller.go of kube's PV controller...
 	claimClass := util.GetPersistentVolumeClaimClass(claim)
 	operation := fmt.Sprintf("provision %q class %q", claimToClaimKey(claim), claimClass)
@@ -1148,7 +1246,7 @@ func (ctrl *ProvisionController) provisionClaimOperation(claim *v1.PersistentVol
 	//  the locks. Check that PV (with deterministic name) hasn't been provisioned
 	//  yet.
 	pvName := ctrl.getProvisionedVolumeNameForClaim(claim)
-	volume, err := ctrl.client.CoreV1().PersistentVolumes().Get(context.TODO(), pvName, metav1.GetOptions{})
+	volume, err := ctrl.client.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
 	if err == nil && volume != nil {
 		// Volume has been already provisioned, nothing to do.
 		glog.Info(logOperation(operation, "persistentvolume %q already exists, skipping", pvName))
@@ -1199,7 +1297,7 @@ func (ctrl *ProvisionController) provisionClaimOperation(claim *v1.PersistentVol
 	if ctrl.kubeVersion.AtLeast(utilversion.MustParseSemantic("v1.11.0")) {
 		// Get SelectedNode
 		if nodeName, ok := claim.Annotations[annSelectedNode]; ok {
-			selectedNode, err = ctrl.client.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{}) // TODO (verult) cache Nodes
+			selectedNode, err = ctrl.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{}) // TODO (verult) cache Nodes
 			if err != nil {
 				err = fmt.Errorf("failed to get target node: %v", err)
 				ctrl.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
@@ -1218,17 +1316,24 @@ func (ctrl *ProvisionController) provisionClaimOperation(claim *v1.PersistentVol
 	ctrl.eventRecorder.Event(claim, v1.EventTypeNormal, "Provisioning", fmt.Sprintf("External provisioner is provisioning volume for claim %q", claimToClaimKey(claim)))
 
 	result := ProvisioningFinished
+	start := time.Now()
 	if p, ok := ctrl.provisioner.(ProvisionerExt); ok {
 		volume, result, err = p.ProvisionExt(options)
 	} else {
 		volume, err = ctrl.provisioner.Provision(options)
 	}
+	observeOperation(provisionOperation, claimClass, operationOutcome(result, err), start)
 	if err != nil {
 		if ierr, ok := err.(*IgnoredError); ok {
 			// Provision ignored, do nothing and hope another provisioner will provision it.
 			glog.Info(logOperation(operation, "volume provision ignored: %v", ierr))
 			return ProvisioningFinished, nil
 		}
+		if result == ProvisioningInBackground {
+			// Not a failure, the claim is retried until provisioning finishes.
+			ctrl.eventRecorder.Event(claim, v1.EventTypeNormal, "ProvisioningInBackground", err.Error())
+			return result, err
+		}
 		err = fmt.Errorf("failed to provision volume with StorageClass %q: %v", claimClass, err)
 		ctrl.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
 		return result, err
@@ -1262,7 +1367,7 @@ func (ctrl *ProvisionController) provisionClaimOperation(claim *v1.PersistentVol
 // deleteVolumeOperation attempts to delete the volume backing the given
 // volume. Returns error, which indicates whether deletion should be retried
 // (requeue the volume) or not
-func (ctrl *ProvisionController) deleteVolumeOperation(volume *v1.PersistentVolume) error {
+func (ctrl *ProvisionController) deleteVolumeOperation(ctx context.Context, volume *v1.PersistentVolume) error {
 	operation := fmt.Sprintf("delete %q", volume.Name)
 	glog.Info(logOperation(operation, "started"))
 
@@ -1270,7 +1375,7 @@ func (ctrl *ProvisionController) deleteVolumeOperation(volume *v1.PersistentVolu
 	// Our check does not have to be as sophisticated as PV controller's, we can
 	// trust that the PV controller has set the PV to Released/Failed and it's
 	// ours to delete
-	newVolume, err := ctrl.client.CoreV1().PersistentVolumes().Get(context.TODO(), volume.Name, metav1.GetOptions{})
+	newVolume, err := ctrl.client.CoreV1().PersistentVolumes().Get(ctx, volume.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil
 	}
@@ -1279,7 +1384,9 @@ func (ctrl *ProvisionController) deleteVolumeOperation(volume *v1.PersistentVolu
 		return nil
 	}
 
+	start := time.Now()
 	err = ctrl.provisioner.Delete(volume)
+	observeOperation(deleteOperation, volume.Spec.StorageClassName, operationOutcome(ProvisioningFinished, err), start)
 	if err != nil {
 		if ierr, ok := err.(*IgnoredError); ok {
 			// Delete ignored, do nothing and hope another provisioner will delete it.
@@ -1295,7 +1402,7 @@ func (ctrl *ProvisionController) deleteVolumeOperation(volume *v1.PersistentVolu
 	glog.Info(logOperation(operation, "volume deleted"))
 
 	// Delete the volume
-	if err = ctrl.client.CoreV1().PersistentVolumes().Delete(context.TODO(), volume.Name, metav1.DeleteOptions{}); err != nil {
+	if err = ctrl.client.CoreV1().PersistentVolumes().Delete(ctx, volume.Name, metav1.DeleteOptions{}); err != nil {
 		// Oops, could not delete the volume and therefore the controller will
 		// try to delete the volume again on next update.
 		glog.Info(logOperation(operation, "failed to delete persistentvolume: %v", err))
@@ -1307,7 +1414,7 @@ func (ctrl *ProvisionController) deleteVolumeOperation(volume *v1.PersistentVolu
 			// Remove external-provisioner finalizer
 
 			// need to get the pv again because the delete has updated the object with a deletion timestamp
-			newVolume, err := ctrl.client.CoreV1().PersistentVolumes().Get(context.TODO(), volume.Name, metav1.GetOptions{})
+			newVolume, err := ctrl.client.CoreV1().PersistentVolumes().Get(ctx, volume.Name, metav1.GetOptions{})
 			if err != nil {
 				// If the volume is not found return, otherwise error
 				if !apierrs.IsNotFound(err) {
@@ -1326,7 +1433,7 @@ func (ctrl *ProvisionController) deleteVolumeOperation(volume *v1.PersistentVolu
 			// Only update the finalizers if we actually removed something
 			if len(finalizers) != len(newVolume.ObjectMeta.Finalizers) {
 				newVolume.ObjectMeta.Finalizers = finalizers
-				if _, err = ctrl.client.CoreV1().PersistentVolumes().Update(context.TODO(), newVolume, metav1.UpdateOptions{}); err != nil {
+				if _, err = ctrl.client.CoreV1().PersistentVolumes().Update(ctx, newVolume, metav1.UpdateOptions{}); err != nil {
 					if !apierrs.IsNotFound(err) {
 						// Couldn't remove finalizer and the object still exists, the controller may
 						// try to remove the finalizer again on the next update
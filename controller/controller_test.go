@@ -0,0 +1,418 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+const testProvisionerName = "test-provisioner"
+
+type testProvisioner struct{}
+
+func (p *testProvisioner) Provision(options ProvisionOptions) (*v1.PersistentVolume, error) {
+	return &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: options.PVName}}, nil
+}
+
+func (p *testProvisioner) Delete(volume *v1.PersistentVolume) error {
+	return nil
+}
+
+func createClaim(i int, nodeName string) *v1.PersistentVolumeClaim {
+	class := "test-class"
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("claim-%d", i),
+			Namespace: "default",
+			UID:       types.UID(fmt.Sprintf("uid-%d", i)),
+			Annotations: map[string]string{
+				annSelectedNode:       nodeName,
+				annStorageProvisioner: testProvisionerName,
+			},
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			StorageClassName: &class,
+		},
+	}
+}
+
+func claimForNode(nodeName string) func(*v1.PersistentVolumeClaim) bool {
+	return func(claim *v1.PersistentVolumeClaim) bool {
+		return claim.Annotations[annSelectedNode] == nodeName
+	}
+}
+
+func Test_ClaimFilterScale(t *testing.T) {
+	const (
+		claims = 5000
+		nodes  = 10
+	)
+	objects := make([]runtime.Object, 0, claims)
+	for i := 0; i < claims; i++ {
+		objects = append(objects, createClaim(i, fmt.Sprintf("node-%d", i%nodes)))
+	}
+	client := fake.NewSimpleClientset(objects...)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	claimInformer := factory.Core().V1().PersistentVolumeClaims().Informer()
+	ctrl := NewProvisionController(client, testProvisionerName, &testProvisioner{}, "v1.30.0",
+		ClaimsInformer(claimInformer),
+		ClaimFilter(claimForNode("node-3")),
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, claimInformer.HasSynced) {
+		t.Fatal("claim informer did not sync")
+	}
+
+	// Only the claims of the node are queued.
+	want := claims / nodes
+	err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		return ctrl.claimQueue.Len() >= want, nil
+	})
+	if err != nil {
+		t.Fatalf("claims of the node were not queued, queue length %d, want %d", ctrl.claimQueue.Len(), want)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ctrl.claimQueue.Len() != want {
+		t.Errorf("queue length = %d, want %d", ctrl.claimQueue.Len(), want)
+	}
+	for ctrl.claimQueue.Len() > 0 {
+		item, _ := ctrl.claimQueue.Get()
+		ctrl.claimQueue.Done(item)
+		ctrl.claimQueue.Forget(item)
+	}
+
+	// A claim is queued once it is scheduled to the node.
+	claim := createClaim(claims, "")
+	if _, err := client.CoreV1().PersistentVolumeClaims("default").Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	claim.Annotations[annSelectedNode] = "node-3"
+	if _, err := client.CoreV1().PersistentVolumeClaims("default").Update(context.TODO(), claim, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		return ctrl.claimQueue.Len() == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("scheduled claim was not queued")
+	}
+	if item, _ := ctrl.claimQueue.Get(); item != string(claim.UID) {
+		t.Errorf("queued %v, want %s", item, claim.UID)
+	}
+}
+
+func Test_shouldProvisionStorageProvisionerAnnotations(t *testing.T) {
+	class := &storage.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-class"},
+		Provisioner: testProvisionerName,
+	}
+	client := fake.NewSimpleClientset()
+	ctrl := NewProvisionController(client, testProvisionerName, &testProvisioner{}, "v1.30.0")
+	if err := ctrl.classes.Add(class); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{
+			name:        "beta annotation",
+			annotations: map[string]string{annBetaStorageProvisioner: testProvisionerName},
+			want:        true,
+		},
+		{
+			name:        "annotation",
+			annotations: map[string]string{annStorageProvisioner: testProvisionerName},
+			want:        true,
+		},
+		{
+			name:        "other provisioner",
+			annotations: map[string]string{annStorageProvisioner: "other"},
+			want:        false,
+		},
+		{
+			name:        "no annotation",
+			annotations: map[string]string{},
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := createClaim(0, "node")
+			claim.Annotations = tt.annotations
+			got, err := ctrl.shouldProvision(claim)
+			if err != nil {
+				t.Fatalf("shouldProvision() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("shouldProvision() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// resultProvisioner returns the configured result from every call.
+type resultProvisioner struct {
+	state ProvisioningState
+	err   error
+}
+
+func (p *resultProvisioner) Provision(options ProvisionOptions) (*v1.PersistentVolume, error) {
+	volume, _, err := p.ProvisionExt(options)
+	return volume, err
+}
+
+func (p *resultProvisioner) ProvisionExt(options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	if p.err != nil {
+		return nil, p.state, p.err
+	}
+	return &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: options.PVName}}, p.state, nil
+}
+
+func (p *resultProvisioner) Delete(volume *v1.PersistentVolume) error {
+	return p.err
+}
+
+func Test_OperationMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		provisioner *resultProvisioner
+		outcome     string
+	}{
+		{
+			name:        "success",
+			provisioner: &resultProvisioner{state: ProvisioningFinished},
+			outcome:     outcomeSuccess,
+		},
+		{
+			name:        "failure",
+			provisioner: &resultProvisioner{state: ProvisioningFinished, err: errors.New("no space left")},
+			outcome:     outcomeFailure,
+		},
+		{
+			name:        "ignored",
+			provisioner: &resultProvisioner{state: ProvisioningFinished, err: &IgnoredError{Reason: "other node"}},
+			outcome:     outcomeIgnored,
+		},
+		{
+			name:        "background",
+			provisioner: &resultProvisioner{state: ProvisioningInBackground, err: errors.New("copying")},
+			outcome:     outcomeBackground,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			className := "class-" + tt.name
+			class := &storage.StorageClass{
+				ObjectMeta:  metav1.ObjectMeta{Name: className},
+				Provisioner: testProvisionerName,
+			}
+			ctrl := NewProvisionController(fake.NewSimpleClientset(), testProvisionerName, tt.provisioner, "v1.30.0")
+			if err := ctrl.classes.Add(class); err != nil {
+				t.Fatal(err)
+			}
+			claim := createClaim(0, "")
+			delete(claim.Annotations, annSelectedNode)
+			claim.Spec.StorageClassName = &className
+
+			state, err := ctrl.provisionClaimOperation(context.Background(), claim)
+			if tt.outcome == outcomeBackground && state != ProvisioningInBackground {
+				t.Errorf("provisionClaimOperation() state = %s, want %s, error %v", state, ProvisioningInBackground, err)
+			}
+			if got := metrics.GetProvisionerOperations(provisionOperation, className, tt.outcome); got != 1 {
+				t.Errorf("provision operations with outcome %s = %v, want 1", tt.outcome, got)
+			}
+			if got := metrics.GetProvisionerOperationDurationCount(provisionOperation, className, tt.outcome); got != 1 {
+				t.Errorf("provision operation durations with outcome %s = %v, want 1", tt.outcome, got)
+			}
+			if tt.outcome == outcomeBackground {
+				return
+			}
+
+			volume := &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "pv-" + tt.name,
+					Annotations: map[string]string{annDynamicallyProvisioned: testProvisionerName},
+				},
+				Spec: v1.PersistentVolumeSpec{
+					StorageClassName:              className,
+					PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete,
+				},
+				Status: v1.PersistentVolumeStatus{Phase: v1.VolumeReleased},
+			}
+			if _, err := ctrl.client.CoreV1().PersistentVolumes().Create(context.TODO(), volume, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			_ = ctrl.deleteVolumeOperation(context.Background(), volume)
+			if got := metrics.GetProvisionerOperations(deleteOperation, className, tt.outcome); got != 1 {
+				t.Errorf("delete operations with outcome %s = %v, want 1", tt.outcome, got)
+			}
+		})
+	}
+}
+
+func Test_QueueDepthMetrics(t *testing.T) {
+	ctrl := NewProvisionController(fake.NewSimpleClientset(), testProvisionerName, &testProvisioner{}, "v1.30.0")
+	defer ctrl.claimQueue.ShutDown()
+	depth := metrics.GetProvisionerQueueDepth("claims")
+	ctrl.claimQueue.Add("uid-1")
+	ctrl.claimQueue.Add("uid-2")
+	if got := metrics.GetProvisionerQueueDepth("claims"); got != depth+2 {
+		t.Errorf("claims queue depth = %v, want %v", got, depth+2)
+	}
+	item, _ := ctrl.claimQueue.Get()
+	if got := metrics.GetProvisionerQueueDepth("claims"); got != depth+1 {
+		t.Errorf("claims queue depth = %v, want %v", got, depth+1)
+	}
+	ctrl.claimQueue.Done(item)
+}
+
+// runController runs the controller until the returned function is called,
+// which returns once Run returned.
+func runController(t *testing.T, ctrl *ProvisionController) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ctrl.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		select {
+		case <-stopped:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Run did not return after the context was cancelled")
+		}
+	}
+}
+
+func waitForVolume(t *testing.T, client *fake.Clientset, name string) {
+	err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume %s was not provisioned", name)
+	}
+}
+
+func Test_Run(t *testing.T) {
+	class := &storage.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-class"},
+		Provisioner: testProvisionerName,
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	claim := createClaim(0, node.Name)
+	client := fake.NewSimpleClientset(class, node, claim)
+	ctrl := NewProvisionController(client, testProvisionerName, &testProvisioner{}, "v1.30.0")
+
+	stop := runController(t, ctrl)
+	waitForVolume(t, client, "pvc-"+string(claim.UID))
+	stop()
+
+	if !ctrl.claimQueue.ShuttingDown() || !ctrl.volumeQueue.ShuttingDown() {
+		t.Errorf("work queues were not shut down")
+	}
+}
+
+func Test_RunLeaderElection(t *testing.T) {
+	class := &storage.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-class"},
+		Provisioner: testProvisionerName,
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	claim := createClaim(0, node.Name)
+	client := fake.NewSimpleClientset(class, node, claim)
+	ctrl := NewProvisionController(client, testProvisionerName, &testProvisioner{}, "v1.30.0",
+		LeaderElection(true),
+		LeaderElectionNamespace("default"),
+		RetryPeriod(100*time.Millisecond),
+	)
+
+	stop := runController(t, ctrl)
+	waitForVolume(t, client, "pvc-"+string(claim.UID))
+	lease, err := client.CoordinationV1().Leases("default").Get(context.TODO(), testProvisionerName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != ctrl.id {
+		t.Errorf("lease holder = %v, want %s", lease.Spec.HolderIdentity, ctrl.id)
+	}
+	stop()
+
+	// The lease is released when the controller stops.
+	lease, err = client.CoordinationV1().Leases("default").Get(context.TODO(), testProvisionerName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" {
+		t.Errorf("lease is still held by %s", *lease.Spec.HolderIdentity)
+	}
+	if !ctrl.claimQueue.ShuttingDown() || !ctrl.volumeQueue.ShuttingDown() {
+		t.Errorf("work queues were not shut down")
+	}
+}
+
+func Test_RunNotLeading(t *testing.T) {
+	holder := "other"
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: testProvisionerName, Namespace: "default"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: ptr.To[int32](3600),
+			AcquireTime:          &metav1.MicroTime{Time: time.Now()},
+			RenewTime:            &metav1.MicroTime{Time: time.Now()},
+		},
+	}
+	client := fake.NewSimpleClientset(lease)
+	ctrl := NewProvisionController(client, testProvisionerName, &testProvisioner{}, "v1.30.0",
+		LeaderElection(true),
+		LeaderElectionNamespace("default"),
+		RetryPeriod(100*time.Millisecond),
+	)
+
+	// Run returns while waiting for the lease held by another controller.
+	stop := runController(t, ctrl)
+	time.Sleep(300 * time.Millisecond)
+	stop()
+
+	if ctrl.HasRun() {
+		t.Errorf("controller ran without holding the lease")
+	}
+}
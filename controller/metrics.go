@@ -0,0 +1,132 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	glog "k8s.io/klog/v2"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+const (
+	provisionOperation = "provision"
+	deleteOperation    = "delete"
+
+	outcomeSuccess    = "success"
+	outcomeFailure    = "failure"
+	outcomeIgnored    = "ignored"
+	outcomeBackground = "background"
+)
+
+// observeOperation records an operation of the provisioner started at start.
+func observeOperation(operation, class, outcome string, start time.Time) {
+	metrics.ObserveProvisionerOperation(operation, class, outcome, time.Since(start))
+}
+
+// operationOutcome returns the outcome of a provision or delete call of the
+// provisioner.
+func operationOutcome(state ProvisioningState, err error) string {
+	if err == nil {
+		return outcomeSuccess
+	}
+	if _, ok := err.(*IgnoredError); ok {
+		return outcomeIgnored
+	}
+	if state == ProvisioningInBackground {
+		return outcomeBackground
+	}
+	return outcomeFailure
+}
+
+// queueMetricsProvider exports the depth of the work queues, and drops their
+// other metrics.
+type queueMetricsProvider struct{}
+
+type noopQueueMetric struct{}
+
+func (noopQueueMetric) Inc()            {}
+func (noopQueueMetric) Dec()            {}
+func (noopQueueMetric) Set(float64)     {}
+func (noopQueueMetric) Observe(float64) {}
+
+func (queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return metrics.ProvisionerQueueDepth(name)
+}
+
+func (queueMetricsProvider) NewAddsMetric(string) workqueue.CounterMetric {
+	return noopQueueMetric{}
+}
+
+func (queueMetricsProvider) NewLatencyMetric(string) workqueue.HistogramMetric {
+	return noopQueueMetric{}
+}
+
+func (queueMetricsProvider) NewWorkDurationMetric(string) workqueue.HistogramMetric {
+	return noopQueueMetric{}
+}
+
+func (queueMetricsProvider) NewUnfinishedWorkSecondsMetric(string) workqueue.SettableGaugeMetric {
+	return noopQueueMetric{}
+}
+
+func (queueMetricsProvider) NewLongestRunningProcessorSecondsMetric(string) workqueue.SettableGaugeMetric {
+	return noopQueueMetric{}
+}
+
+func (queueMetricsProvider) NewRetriesMetric(string) workqueue.CounterMetric {
+	return noopQueueMetric{}
+}
+
+// runMetricsServer serves the metrics of the provisioner on the metrics
+// address and port until ctx is cancelled, restarting the server when it
+// fails.
+func (ctrl *ProvisionController) runMetricsServer(ctx context.Context, wg *sync.WaitGroup) {
+	if err := metrics.SetupProvisionerMetrics(); err != nil {
+		glog.Errorf("Failed to register metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(ctrl.metricsPath, promhttp.Handler())
+	address := net.JoinHostPort(ctrl.metricsAddress, strconv.FormatInt(int64(ctrl.metricsPort), 10))
+	glog.Infof("Starting metrics server at %s", address)
+	server := &http.Server{Addr: address, Handler: mux}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				glog.Errorf("Failed to listen on %s: %v", address, err)
+			}
+		}, 5*time.Second)
+	}()
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		if err := server.Close(); err != nil {
+			glog.Errorf("Failed to stop metrics server: %v", err)
+		}
+	}()
+}
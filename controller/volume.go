@@ -43,9 +43,9 @@ type Provisioner interface {
 // whether a claim should be provisioned as early as possible (e.g. prior to
 // leader election).
 type Qualifier interface {
-	// ShouldProvision returns whether provisioning for the claim should
-	// be attempted.
-	ShouldProvision(*v1.PersistentVolumeClaim, *storageapis.VolumeBindingMode) bool
+	// ShouldProvision returns whether provisioning for the claim with the
+	// storage class should be attempted.
+	ShouldProvision(*v1.PersistentVolumeClaim, *storageapis.StorageClass) bool
 }
 
 // DeletionGuard is an optional interface implemented by provisioners to determine
@@ -58,7 +58,7 @@ type VolumeStore interface {
 // After failed save, volume is re-qeueued with exponential backoff.
 type queueStore struct {
 	client kubernetes.Interface
-	queue  workqueue.RateLimitingInterface
+	queue  workqueue.TypedRateLimitingInterface[string]
 
 	volumes sync.Map
 }
@@ -68,12 +68,12 @@ var _ VolumeStore = &queueStore{}
 // NewVolumeStoreQueue returns VolumeStore that uses asynchronous workqueue to save PVs.
 func NewVolumeStoreQueue(
 	client kubernetes.Interface,
-	limiter workqueue.RateLimiter,
+	limiter workqueue.TypedRateLimiter[string],
 ) VolumeStore {
 
 	return &queueStore{
 		client: client,
-		queue:  workqueue.NewNamedRateLimitingQueue(limiter, "unsavedpvs"),
+		queue:  workqueue.NewTypedRateLimitingQueueWithConfig(limiter, workqueue.TypedRateLimitingQueueConfig[string]{Name: "unsavedpvs"}),
 	}
 }
 
@@ -89,12 +89,17 @@ func (q *queueStore) StoreVolume(_ *v1.PersistentVolumeClaim, volume *v1.Persist
 
 func (q *queueStore) Run(ctx context.Context, threadiness int) {
 	klog.Infof("Starting save volume queue")
-	defer q.queue.ShutDown()
-
+	var wg sync.WaitGroup
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(q.saveVolumeWorker, time.Second, ctx.Done())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(q.saveVolumeWorker, time.Second, ctx.Done())
+		}()
 	}
 	<-ctx.Done()
+	q.queue.ShutDown()
+	wg.Wait()
 	klog.Infof("Stopped save volume queue")
 }
 
@@ -104,21 +109,13 @@ func (q *queueStore) saveVolumeWorker() {
 }
 
 func (q *queueStore) processNextWorkItem() bool {
-	obj, shutdown := q.queue.Get()
-	defer q.queue.Done(obj)
+	volumeName, shutdown := q.queue.Get()
+	defer q.queue.Done(volumeName)
 
 	if shutdown {
 		return false
 	}
 
-	var volumeName string
-	var ok bool
-	if volumeName, ok = obj.(string); !ok {
-		q.queue.Forget(obj)
-		utilruntime.HandleError(fmt.Errorf("expected string in save workqueue but got %#v", obj))
-		return true
-	}
-
 	volumeObj, found := q.volumes.Load(volumeName)
 	if !found {
 		q.queue.Forget(volumeName)
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"sync"
 
@@ -28,19 +29,36 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/keymutex"
 )
 
 const (
 	deviceID = "deviceID"
+	// idLockBuckets is the number of locks the volume and snapshot IDs are
+	// hashed to, large enough for unrelated IDs to rarely share a lock.
+	idLockBuckets = 1024
 )
 
 type hostPathController struct {
 	csi.UnimplementedControllerServer
 	cfg               *Config
 	snapshotproviders map[string]SnapshotProvider
-	snapMutex         sync.Mutex
+	// idLocks serializes the calls changing the same volume.
+	idLocks keymutex.KeyMutex
+	// snapshotLocks serializes the calls creating, deleting or restoring the
+	// same snapshot, so a snapshot is never removed while a volume is restored
+	// from it. A restore locks its volume before its snapshot.
+	snapshotLocks keymutex.KeyMutex
+	// creatingSnapshots are the IDs of the snapshots being copied, which are
+	// left out of the lists. snapshotsLock guards it, and is held for reading
+	// while listing.
+	snapshotsLock     sync.RWMutex
+	creatingSnapshots map[string]bool
+	snapshotLimiter   *operationLimiter
+	deleteLimiter     *operationLimiter
 }
 
 func NewHostPathController(config *Config) *hostPathController {
@@ -63,6 +81,11 @@ func NewHostPathController(config *Config) *hostPathController {
 	return &hostPathController{
 		cfg:               config,
 		snapshotproviders: snapshotProviders,
+		idLocks:           keymutex.NewHashed(idLockBuckets),
+		snapshotLocks:     keymutex.NewHashed(idLockBuckets),
+		creatingSnapshots: make(map[string]bool),
+		snapshotLimiter:   newOperationLimiter(snapshotOperation, config.MaxConcurrentSnapshots, config.OperationQueueTimeout),
+		deleteLimiter:     newOperationLimiter(deleteOperation, config.MaxConcurrentDeletes, config.OperationQueueTimeout),
 	}
 }
 
@@ -111,8 +134,9 @@ func (hpc *hostPathController) validateCreateVolumeRequestTopology(req *csi.Crea
 }
 
 func (hpc *hostPathController) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (resp *csi.CreateVolumeResponse, finalErr error) {
+	logger := klog.FromContext(ctx)
 	if req != nil {
-		klog.V(3).Infof("Create Volume Request: %+v", req)
+		logger.V(3).Info("Create volume request", "request", protosanitizer.StripSecrets(req))
 	}
 
 	if err := hpc.validateCreateVolumeRequest(req); err != nil {
@@ -123,6 +147,19 @@ func (hpc *hostPathController) CreateVolume(ctx context.Context, req *csi.Create
 		return nil, err
 	}
 
+	// The I/O limits of the storage class are persisted with the mutable
+	// parameters, which override them, so the node can apply them again.
+	attributes := volumeIOLimits(req.GetParameters())
+	if err := validateMutableParameters(attributes); err != nil {
+		return nil, err
+	}
+	if err := validateMutableParameters(req.GetMutableParameters()); err != nil {
+		return nil, err
+	}
+	for key, value := range req.GetMutableParameters() {
+		attributes[key] = value
+	}
+
 	storagePoolName := getStoragePoolNameFromMap(req.GetParameters())
 	if _, ok := hpc.cfg.StoragePoolInfo[storagePoolName]; !ok {
 		return nil, fmt.Errorf("unable to locate path for storage pool %s", storagePoolName)
@@ -138,13 +175,17 @@ func (hpc *hostPathController) CreateVolume(ctx context.Context, req *csi.Create
 		topologies = append(topologies, &csi.Topology{Segments: map[string]string{TopologyKeyNode: hpc.cfg.NodeID}})
 	}
 
-	if exists, err := checkPathExist(filepath.Join(hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetName())); err != nil {
+	volumePath, err := resolveBeneath(hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := checkPathExist(volumePath); err != nil {
 		return nil, err
 	} else if !exists {
-		if err := CreateVolumeDirectory(hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetName()); err != nil {
+		if err := CreateVolumeDirectory(ctx, hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetName()); err != nil {
 			return nil, fmt.Errorf("failed to create volume %v: %w", req.GetName(), err)
 		}
-		klog.V(4).Infof("created volume %s at path %s", req.GetName(), filepath.Join(hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetName()))
+		logger.V(4).Info("Created volume", "path", volumePath)
 	}
 
 	if req.GetVolumeContentSource() != nil {
@@ -152,8 +193,9 @@ func (hpc *hostPathController) CreateVolume(ctx context.Context, req *csi.Create
 		switch source.Type.(type) {
 		case *csi.VolumeContentSource_Snapshot:
 			if snapshot := source.GetSnapshot(); snapshot != nil {
-				if err := hpc.restoreFromSnapshot(snapshot.GetSnapshotId(), storagePoolName, req.GetName()); err != nil {
-					if err := DeleteVolume(hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetName()); err != nil {
+				if err := hpc.restoreFromSnapshot(ctx, snapshot.GetSnapshotId(), storagePoolName, req.GetName()); err != nil {
+					logger.Error(err, "Failed to restore snapshot, deleting volume", "snapshotID", snapshot.GetSnapshotId())
+					if err := DeleteVolume(ctx, hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetName()); err != nil {
 						return nil, fmt.Errorf("failed to delete restore %v: %w", req.GetName(), err)
 					}
 					return nil, err
@@ -161,6 +203,11 @@ func (hpc *hostPathController) CreateVolume(ctx context.Context, req *csi.Create
 			}
 		}
 	}
+	if len(attributes) > 0 {
+		if err := modifyVolume(ctx, volumePath, attributes); err != nil {
+			return nil, err
+		}
+	}
 	return &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
 			VolumeId:           req.Name,
@@ -198,7 +245,7 @@ func (hpc *hostPathController) DeleteVolume(ctx context.Context, req *csi.Delete
 	if err := hpc.validateDeleteVolumeRequest(req); err != nil {
 		return nil, err
 	}
-	volumeDirs, err := hpc.getVolumeDirectories()
+	volumeDirs, err := hpc.getVolumeDirectories(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -209,10 +256,20 @@ func (hpc *hostPathController) DeleteVolume(ctx context.Context, req *csi.Delete
 		}
 	}
 	if volumePath != "" {
-		if err := DeleteVolume(filepath.Dir(volumePath), req.GetVolumeId()); err != nil {
+		release, err := hpc.deleteLimiter.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		hpc.idLocks.LockKey(req.GetVolumeId())
+		defer hpc.idLocks.UnlockKey(req.GetVolumeId())
+		if err := DeleteVolume(ctx, filepath.Dir(volumePath), req.GetVolumeId()); err != nil {
 			return nil, fmt.Errorf("failed to delete volume %s: %v", req.GetVolumeId(), err)
 		}
-		klog.V(4).Infof("volume %v successfully deleted", req.GetVolumeId())
+		if err := removeVolumeAttributes(filepath.Dir(volumePath), req.GetVolumeId()); err != nil {
+			return nil, fmt.Errorf("failed to delete parameters of volume %s: %v", req.GetVolumeId(), err)
+		}
+		klog.FromContext(ctx).V(4).Info("Volume successfully deleted", "path", volumePath)
 	}
 
 	return &csi.DeleteVolumeResponse{}, nil
@@ -239,7 +296,15 @@ func (hpc *hostPathController) ValidateVolumeCapabilities(ctx context.Context, r
 		}
 	}
 	storagePoolName := getStoragePoolNameFromMap(req.GetParameters())
-	if exists, err := checkPathExist(filepath.Join(hpc.cfg.StoragePoolInfo[storagePoolName].Path, req.GetVolumeId())); err != nil {
+	storagePool, ok := hpc.cfg.StoragePoolInfo[storagePoolName]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %s not found, unknown storage pool %s", req.GetVolumeId(), storagePoolName)
+	}
+	volumePath, err := resolveBeneath(storagePool.Path, req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := checkPathExist(volumePath); err != nil {
 		return nil, err
 	} else if !exists {
 		return nil, status.Errorf(codes.NotFound, "volume %s not found", req.GetVolumeId())
@@ -267,7 +332,7 @@ func (hpc *hostPathController) GetCapacity(ctx context.Context, req *csi.GetCapa
 		return nil, status.Error(codes.InvalidArgument, "missing request")
 	}
 	storagePoolName := getStoragePoolNameFromMap(req.GetParameters())
-	klog.V(3).Infof("Checking capacity for storage pool %s", storagePoolName)
+	klog.FromContext(ctx).V(3).Info("Checking capacity for storage pool", "pool", storagePoolName)
 	if _, ok := hpc.cfg.StoragePoolInfo[storagePoolName]; !ok {
 		return nil, fmt.Errorf("unable to locate path for storage pool %s", storagePoolName)
 	}
@@ -282,8 +347,8 @@ func (hpc *hostPathController) GetCapacity(ctx context.Context, req *csi.GetCapa
 	}, nil
 }
 
-func (hpc *hostPathController) getVolumeDirectories() ([]string, error) {
-	return getStoragePoolDataDirectories(hpc.cfg.StoragePoolInfo)
+func (hpc *hostPathController) getVolumeDirectories(ctx context.Context) ([]string, error) {
+	return getStoragePoolDataDirectories(ctx, hpc.cfg.StoragePoolInfo)
 }
 
 func (hpc *hostPathController) validateListVolumesRequest(req *csi.ListVolumesRequest) error {
@@ -300,6 +365,7 @@ func (hpc *hostPathController) ListVolumes(ctx context.Context, req *csi.ListVol
 	if err := hpc.validateListVolumesRequest(req); err != nil {
 		return nil, err
 	}
+	logger := klog.FromContext(ctx)
 
 	volumeRes := &csi.ListVolumesResponse{
 		Entries: []*csi.ListVolumesResponse_Entry{},
@@ -314,7 +380,7 @@ func (hpc *hostPathController) ListVolumes(ctx context.Context, req *csi.ListVol
 		capacityMap[info.Path] = capacity
 	}
 
-	volumeDirs, err := hpc.getVolumeDirectories()
+	volumeDirs, err := hpc.getVolumeDirectories(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -348,8 +414,8 @@ func (hpc *hostPathController) ListVolumes(ctx context.Context, req *csi.ListVol
 		}
 
 		for _, volumeId := range volumeDirs[start:end] {
-			healthy, msg := doHealthCheckInControllerSide(volumeId)
-			klog.V(3).Infof("Healthy state: %s Volume: %t", volumeId, healthy)
+			healthy, msg := doHealthCheckInControllerSide(ctx, volumeId)
+			logger.V(3).Info("Volume health", "path", volumeId, "healthy", healthy)
 			volumeRes.Entries = append(volumeRes.Entries, &csi.ListVolumesResponse_Entry{
 				Volume: &csi.Volume{
 					VolumeId:      filepath.Base(volumeId),
@@ -391,7 +457,7 @@ func (hpc *hostPathController) ControllerGetVolume(ctx context.Context, req *csi
 		}
 		capacityMap[info.Path] = capacity
 	}
-	volumeDirs, err := hpc.getVolumeDirectories()
+	volumeDirs, err := hpc.getVolumeDirectories(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -405,12 +471,21 @@ func (hpc *hostPathController) ControllerGetVolume(ctx context.Context, req *csi
 	if volumePath == "" {
 		return nil, status.Errorf(codes.NotFound, "volume %s not found", req.GetVolumeId())
 	}
-	healthy, msg := doHealthCheckInControllerSide(volumePath)
-	klog.V(3).Infof("Healthy state: %s Volume: %t", req.GetVolumeId(), healthy)
+	healthy, msg := doHealthCheckInControllerSide(ctx, volumePath)
+	klog.FromContext(ctx).V(3).Info("Volume health", "path", volumePath, "healthy", healthy)
+	attributes, err := readVolumeAttributes(filepath.Dir(volumePath), req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	var volumeContext map[string]string
+	if len(attributes) > 0 {
+		volumeContext = attributes
+	}
 	return &csi.ControllerGetVolumeResponse{
 		Volume: &csi.Volume{
 			VolumeId:      req.GetVolumeId(),
 			CapacityBytes: capacityMap[filepath.Dir(volumePath)],
+			VolumeContext: volumeContext,
 		},
 		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
 			PublishedNodeIds: []string{hpc.cfg.NodeID},
@@ -449,18 +524,23 @@ func (hpc *hostPathController) CreateSnapshot(ctx context.Context, req *csi.Crea
 	if hpc.snapshotproviders[storagePoolName] == nil {
 		return nil, fmt.Errorf("snapshot provider not set for storage pool %s", storagePoolName)
 	}
-	hpc.snapMutex.Lock()
-	defer hpc.snapMutex.Unlock()
+	release, err := hpc.snapshotLimiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	hpc.snapshotLocks.LockKey(req.GetName())
+	defer hpc.snapshotLocks.UnlockKey(req.GetName())
 	if exists, err := checkPathExist(*hpc.cfg.StoragePoolInfo[storagePoolName].SnapshotPath); err != nil {
 		return nil, err
 	} else if !exists {
-		if err := hpc.snapshotproviders[storagePoolName].Initialize(); err != nil {
+		if err := hpc.snapshotproviders[storagePoolName].Initialize(ctx); err != nil {
 			return nil, fmt.Errorf("failed to initialize snapshot storage pool %v", err)
 		}
-		klog.V(4).Info("Initialized snapshot provider")
+		klog.FromContext(ctx).V(4).Info("Initialized snapshot provider")
 	}
 	// Check if a snapshot with the id already exists.
-	snapshot, err := hpc.snapshotproviders[storagePoolName].GetSnapshotById(req.GetName())
+	snapshot, err := hpc.snapshotproviders[storagePoolName].GetSnapshotById(ctx, req.GetName())
 	if err != nil {
 		return nil, fmt.Errorf("getsnapshot by id failed, %v", err)
 	}
@@ -475,7 +555,9 @@ func (hpc *hostPathController) CreateSnapshot(ctx context.Context, req *csi.Crea
 		}
 	}
 	// Snapshot not found, create it.
-	snapshot, err = hpc.snapshotproviders[storagePoolName].CreateSnapshot(req.GetName(), req.GetSourceVolumeId())
+	hpc.setCreatingSnapshot(req.GetName(), true)
+	defer hpc.setCreatingSnapshot(req.GetName(), false)
+	snapshot, err = hpc.snapshotproviders[storagePoolName].CreateSnapshot(ctx, req.GetName(), req.GetSourceVolumeId())
 	if err != nil {
 		return nil, err
 	}
@@ -484,6 +566,17 @@ func (hpc *hostPathController) CreateSnapshot(ctx context.Context, req *csi.Crea
 	}, err
 }
 
+// setCreatingSnapshot records whether the snapshot is being copied.
+func (hpc *hostPathController) setCreatingSnapshot(snapshotId string, creating bool) {
+	hpc.snapshotsLock.Lock()
+	defer hpc.snapshotsLock.Unlock()
+	if creating {
+		hpc.creatingSnapshots[snapshotId] = true
+	} else {
+		delete(hpc.creatingSnapshots, snapshotId)
+	}
+}
+
 func (hpc *hostPathController) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
 	if req == nil {
 		return nil, status.Error(codes.InvalidArgument, "missing request")
@@ -491,10 +584,15 @@ func (hpc *hostPathController) DeleteSnapshot(ctx context.Context, req *csi.Dele
 	if len(req.GetSnapshotId()) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "snapshot id missing in request")
 	}
-	hpc.snapMutex.Lock()
-	defer hpc.snapMutex.Unlock()
+	release, err := hpc.deleteLimiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	hpc.snapshotLocks.LockKey(req.GetSnapshotId())
+	defer hpc.snapshotLocks.UnlockKey(req.GetSnapshotId())
 	for _, snapshotProvider := range hpc.snapshotproviders {
-		if err := snapshotProvider.DeleteSnapshot(req.GetSnapshotId()); err != nil {
+		if err := snapshotProvider.DeleteSnapshot(ctx, req.GetSnapshotId()); err != nil {
 			return nil, err
 		}
 	}
@@ -505,13 +603,13 @@ func (hpc *hostPathController) ListSnapshots(ctx context.Context, req *csi.ListS
 	if req == nil {
 		return nil, status.Error(codes.InvalidArgument, "missing request")
 	}
-	hpc.snapMutex.Lock()
-	defer hpc.snapMutex.Unlock()
+	hpc.snapshotsLock.RLock()
+	defer hpc.snapshotsLock.RUnlock()
 
 	var snapshots []csi.Snapshot
 	for _, snapshotProvider := range hpc.snapshotproviders {
 		if len(req.GetSnapshotId()) != 0 {
-			snapshot, err := snapshotProvider.GetSnapshotById(req.GetSnapshotId())
+			snapshot, err := snapshotProvider.GetSnapshotById(ctx, req.GetSnapshotId())
 			if err != nil {
 				return nil, err
 			}
@@ -519,19 +617,24 @@ func (hpc *hostPathController) ListSnapshots(ctx context.Context, req *csi.ListS
 				snapshots = append(snapshots, *snapshot)
 			}
 		} else if len(req.GetSourceVolumeId()) != 0 {
-			snapshotsByVolume, err := snapshotProvider.GetSnapshotsByVolumeSourceId(req.GetSourceVolumeId())
+			snapshotsByVolume, err := snapshotProvider.GetSnapshotsByVolumeSourceId(ctx, req.GetSourceVolumeId())
 			if err != nil {
 				return nil, err
 			}
 			snapshots = append(snapshots, snapshotsByVolume...)
 		} else {
-			allProviderSnapshots, err := snapshotProvider.GetAllSnapshots()
+			allProviderSnapshots, err := snapshotProvider.GetAllSnapshots(ctx)
 			if err != nil {
 				return nil, err
 			}
 			snapshots = append(snapshots, allProviderSnapshots...)
 		}
 	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if hpc.creatingSnapshots[snapshots[i].GetSnapshotId()] {
+			snapshots = slices.Delete(snapshots, i, i+1)
+		}
+	}
 	snapshotRes := &csi.ListSnapshotsResponse{}
 	if len(snapshots) > 0 {
 		snapshotRes.Entries = []*csi.ListSnapshotsResponse_Entry{}
@@ -572,24 +675,73 @@ func (hpc *hostPathController) ListSnapshots(ctx context.Context, req *csi.ListS
 	return snapshotRes, nil
 }
 
-func (hpc *hostPathController) restoreFromSnapshot(snapshotId, storagePoolName, targetVolume string) error {
-	hpc.snapMutex.Lock()
-	defer hpc.snapMutex.Unlock()
-
+func (hpc *hostPathController) restoreFromSnapshot(ctx context.Context, snapshotId, storagePoolName, targetVolume string) error {
 	if _, ok := hpc.snapshotproviders[storagePoolName]; !ok {
 		return fmt.Errorf("unable to restore snapshot because unable to locate snapshot provider for storage pool %s", storagePoolName)
 	}
-	targetPath := filepath.Join(hpc.cfg.StoragePoolInfo[storagePoolName].Path, targetVolume)
-	return hpc.snapshotproviders[storagePoolName].RestoreSnapshot(snapshotId, targetPath)
+	targetPath, err := resolveBeneath(hpc.cfg.StoragePoolInfo[storagePoolName].Path, targetVolume)
+	if err != nil {
+		return err
+	}
+	release, err := hpc.snapshotLimiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	hpc.idLocks.LockKey(targetVolume)
+	defer hpc.idLocks.UnlockKey(targetVolume)
+	hpc.snapshotLocks.LockKey(snapshotId)
+	defer hpc.snapshotLocks.UnlockKey(snapshotId)
+	return hpc.snapshotproviders[storagePoolName].RestoreSnapshot(ctx, snapshotId, targetPath)
 }
 
 func (hpc *hostPathController) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "controllerExpandVolume is not supported")
 }
 
-// ControllerModifyVolume implements csi.ControllerServer.
-func (*hostPathController) ControllerModifyVolume(context.Context, *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "controllerModifyVolume is not supported")
+// ControllerModifyVolume changes the mutable parameters of a volume, set by
+// its VolumeAttributesClass. The parameters are persisted next to the volume,
+// and reported by ControllerGetVolume.
+func (hpc *hostPathController) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	if !hpc.cfg.EnableModifyVolume {
+		return nil, status.Error(codes.Unimplemented, "controllerModifyVolume is not enabled")
+	}
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing request")
+	}
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID not provided")
+	}
+	klog.FromContext(ctx).V(3).Info("Modify volume request", "request", protosanitizer.StripSecrets(req))
+	if err := validateMutableParameters(req.GetMutableParameters()); err != nil {
+		return nil, err
+	}
+
+	hpc.idLocks.LockKey(req.GetVolumeId())
+	defer hpc.idLocks.UnlockKey(req.GetVolumeId())
+	volumeDirs, err := hpc.getVolumeDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumePath := ""
+	for _, volumeDir := range volumeDirs {
+		if filepath.Base(volumeDir) == req.GetVolumeId() {
+			volumePath = volumeDir
+		}
+	}
+	if volumePath == "" {
+		return nil, status.Errorf(codes.NotFound, "volume %s not found", req.GetVolumeId())
+	}
+	if err := modifyVolume(ctx, volumePath, req.GetMutableParameters()); err != nil {
+		return nil, err
+	}
+	if len(volumeIOLimits(req.GetMutableParameters())) > 0 {
+		// The volume may be published on this node already.
+		if err := reapplyIOLimits(ctx, hpc.cfg.StoragePoolInfo, req.GetVolumeId()); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to limit I/O of volume %s: %v", req.GetVolumeId(), err)
+		}
+	}
+	return &csi.ControllerModifyVolumeResponse{}, nil
 }
 
 func (hpc *hostPathController) getControllerServiceCapabilities() []*csi.ControllerServiceCapability {
@@ -602,6 +754,9 @@ func (hpc *hostPathController) getControllerServiceCapabilities() []*csi.Control
 		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
 		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
 	}
+	if hpc.cfg.EnableModifyVolume {
+		cl = append(cl, csi.ControllerServiceCapability_RPC_MODIFY_VOLUME)
+	}
 
 	var csc []*csi.ControllerServiceCapability
 
@@ -415,6 +415,20 @@ func Test_ControllerGetCapabilities(t *testing.T) {
 			},
 		},
 	}))
+	modifyVolume := &csi.ControllerServiceCapability{
+		Type: &csi.ControllerServiceCapability_Rpc{
+			Rpc: &csi.ControllerServiceCapability_RPC{
+				Type: csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+			},
+		},
+	}
+	Expect(caps).ToNot(ContainElement(modifyVolume))
+
+	controller.cfg.EnableModifyVolume = true
+	resp, err = controller.ControllerGetCapabilities(context.TODO(), &csi.ControllerGetCapabilitiesRequest{})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp.Capabilities).To(HaveLen(8))
+	Expect(resp.Capabilities).To(ContainElement(modifyVolume))
 }
 
 func Test_ValidateVolumeCapabilities(t *testing.T) {
@@ -490,6 +504,22 @@ func Test_ValidateVolumeCapabilities(t *testing.T) {
 			},
 		}))
 	})
+	t.Run("unknown storage pool", func(t *testing.T) {
+		_, err := controller.ValidateVolumeCapabilities(context.TODO(), &csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId: validVolId,
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+				},
+			},
+			Parameters: map[string]string{
+				storagePoolName: "unknown",
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
 	t.Run("valid request, not found", func(t *testing.T) {
 		_, err := controller.ValidateVolumeCapabilities(context.TODO(), &csi.ValidateVolumeCapabilitiesRequest{
 			VolumeId: invalidVolId,
@@ -578,7 +608,7 @@ func Test_GetCapacityRequestPVStatError(t *testing.T) {
 func Test_getVolumeDirectoriesFail(t *testing.T) {
 	RegisterTestingT(t)
 	controller := createControllerServer("/dev/null")
-	_, err := controller.getVolumeDirectories()
+	_, err := controller.getVolumeDirectories(context.TODO())
 	Expect(err).To(HaveOccurred())
 }
 
@@ -589,7 +619,7 @@ func Test_getVolumeDirectories(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 	controller := createControllerServer(tempDir)
 	t.Run("no volumes", func(t *testing.T) {
-		res, err := controller.getVolumeDirectories()
+		res, err := controller.getVolumeDirectories(context.TODO())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(len(res)).To(Equal(0))
 	})
@@ -599,7 +629,7 @@ func Test_getVolumeDirectories(t *testing.T) {
 		Expect(err).ToNot(HaveOccurred())
 		err = os.Mkdir(filepath.Join(tempDir, invalidVolId), 0666)
 		Expect(err).ToNot(HaveOccurred())
-		res, err := controller.getVolumeDirectories()
+		res, err := controller.getVolumeDirectories(context.TODO())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(len(res)).To(Equal(2))
 		Expect(res[0]).To(Equal(filepath.Join(tempDir, invalidVolId)))
@@ -609,7 +639,7 @@ func Test_getVolumeDirectories(t *testing.T) {
 	t.Run("adding single file", func(t *testing.T) {
 		_, err = os.Create(filepath.Join(tempDir, "filename"))
 		Expect(err).ToNot(HaveOccurred())
-		res, err := controller.getVolumeDirectories()
+		res, err := controller.getVolumeDirectories(context.TODO())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(len(res)).To(Equal(2))
 		Expect(res[0]).To(Equal(filepath.Join(tempDir, invalidVolId)))
@@ -932,7 +962,7 @@ func Test_CreateSnapshotSourceNotFound(t *testing.T) {
 		CreateVolumeDirectory = oldCreateVolumeDirectoryFunc
 	}()
 	req := createTestSnapshotRequestWithArgs("test", invalidVolId)
-	CreateVolumeDirectory = func(base, volume string) error {
+	CreateVolumeDirectory = func(ctx context.Context, base, volume string) error {
 		Expect(base).To(Equal(filepath.Join(tempDir, "snap")))
 		Expect(volume).To(Equal(req.GetName()))
 		return errors.New("test fail")
@@ -960,10 +990,10 @@ func Test_CreateSnapshotCheckPathIsEmptyNotEmptyOther(t *testing.T) {
 	_, err = f.WriteString(fileContent)
 	Expect(err).ToNot(HaveOccurred())
 
-	err = controller.snapshotproviders[legacyStoragePoolName].Initialize()
+	err = controller.snapshotproviders[legacyStoragePoolName].Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 
-	_, err = controller.snapshotproviders[legacyStoragePoolName].CreateSnapshot(validSnapshotName, invalidVolId)
+	_, err = controller.snapshotproviders[legacyStoragePoolName].CreateSnapshot(context.TODO(), validSnapshotName, invalidVolId)
 	Expect(err).ToNot(HaveOccurred())
 
 	_, err = controller.CreateSnapshot(context.TODO(), createTestSnapshotRequest())
@@ -1025,7 +1055,7 @@ func Test_DeleteSnapshotNotThere(t *testing.T) {
 	Expect(err).ToNot(HaveOccurred())
 	defer os.RemoveAll(tempDir)
 	controller := createControllerServer(tempDir)
-	err = controller.snapshotproviders[legacyStoragePoolName].Initialize()
+	err = controller.snapshotproviders[legacyStoragePoolName].Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 
 	res, err := controller.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{
@@ -1313,6 +1343,146 @@ func Test_ControllerExpandVolume(t *testing.T) {
 	Expect(err).To(BeEquivalentTo(status.Error(codes.Unimplemented, "controllerExpandVolume is not supported")))
 }
 
+func Test_ControllerModifyVolume(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir, err := os.MkdirTemp(os.TempDir(), "")
+	Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(tempDir)
+	controller := createControllerServer(tempDir)
+	volumePath := filepath.Join(tempDir, validVolId)
+	err = os.Mkdir(volumePath, 0777)
+	Expect(err).ToNot(HaveOccurred())
+
+	t.Run("not enabled", func(t *testing.T) {
+		_, err := controller.ControllerModifyVolume(context.TODO(), &csi.ControllerModifyVolumeRequest{VolumeId: validVolId})
+		Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+	})
+	controller.cfg.EnableModifyVolume = true
+
+	t.Run("missing request", func(t *testing.T) {
+		_, err := controller.ControllerModifyVolume(context.TODO(), nil)
+		Expect(err).To(BeEquivalentTo(status.Error(codes.InvalidArgument, "missing request")))
+	})
+	t.Run("missing volume ID", func(t *testing.T) {
+		_, err := controller.ControllerModifyVolume(context.TODO(), &csi.ControllerModifyVolumeRequest{})
+		Expect(err).To(BeEquivalentTo(status.Error(codes.InvalidArgument, "volume ID not provided")))
+	})
+	t.Run("parameter not in allow-list", func(t *testing.T) {
+		_, err := controller.ControllerModifyVolume(context.TODO(), &csi.ControllerModifyVolumeRequest{
+			VolumeId:          validVolId,
+			MutableParameters: map[string]string{"storagePool": "fast"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+	t.Run("invalid value", func(t *testing.T) {
+		_, err := controller.ControllerModifyVolume(context.TODO(), &csi.ControllerModifyVolumeRequest{
+			VolumeId:          validVolId,
+			MutableParameters: map[string]string{attributeMode: "rwx"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+	t.Run("volume not found", func(t *testing.T) {
+		_, err := controller.ControllerModifyVolume(context.TODO(), &csi.ControllerModifyVolumeRequest{
+			VolumeId:          "missing",
+			MutableParameters: map[string]string{attributeMode: "0750"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+	t.Run("valid request", func(t *testing.T) {
+		uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+		_, err := controller.ControllerModifyVolume(context.TODO(), &csi.ControllerModifyVolumeRequest{
+			VolumeId: validVolId,
+			MutableParameters: map[string]string{
+				attributeMode:     "2750",
+				attributeUID:      uid,
+				attributeGID:      gid,
+				attributeReadIOPS: "100",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		info, err := os.Stat(volumePath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode() & (os.ModePerm | os.ModeSetgid)).To(Equal(os.FileMode(0750) | os.ModeSetgid))
+
+		// The parameters are merged with the ones set before.
+		_, err = controller.ControllerModifyVolume(context.TODO(), &csi.ControllerModifyVolumeRequest{
+			VolumeId:          validVolId,
+			MutableParameters: map[string]string{attributeReadIOPS: "200", attributeWriteIOPS: "50"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		resp, err := controller.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{
+			VolumeId: validVolId,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.GetVolume().GetVolumeContext()).To(Equal(map[string]string{
+			attributeMode:      "2750",
+			attributeUID:       uid,
+			attributeGID:       gid,
+			attributeReadIOPS:  "200",
+			attributeWriteIOPS: "50",
+		}))
+	})
+	t.Run("attributes are not listed as volumes", func(t *testing.T) {
+		dirs, err := controller.getVolumeDirectories(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dirs).To(Equal([]string{volumePath}))
+	})
+	t.Run("delete removes the attributes", func(t *testing.T) {
+		_, err := controller.DeleteVolume(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: validVolId})
+		Expect(err).ToNot(HaveOccurred())
+		entries, err := os.ReadDir(tempDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+}
+
+func Test_CreateVolumeMutableParameters(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir, err := os.MkdirTemp(os.TempDir(), "")
+	Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(tempDir)
+	controller := createControllerServer(tempDir)
+
+	req := createTestRequest()
+	req.MutableParameters = map[string]string{attributeMode: "0700", "trashRetention": "7d"}
+	_, err = controller.CreateVolume(context.TODO(), req)
+	Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	_, err = os.Stat(filepath.Join(tempDir, "testname"))
+	Expect(os.IsNotExist(err)).To(BeTrue())
+
+	req.MutableParameters = map[string]string{attributeMode: "0700", attributeWriteBPS: "1048576"}
+	_, err = controller.CreateVolume(context.TODO(), req)
+	Expect(err).ToNot(HaveOccurred())
+	info, err := os.Stat(filepath.Join(tempDir, "testname"))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+	attributes, err := readVolumeAttributes(tempDir, "testname")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(attributes).To(Equal(req.MutableParameters))
+}
+
+func Test_CreateVolumeIOLimitParameters(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir, err := os.MkdirTemp(os.TempDir(), "")
+	Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(tempDir)
+	controller := createControllerServer(tempDir)
+
+	req := createTestRequest()
+	req.Parameters = map[string]string{attributeReadIOPS: "many"}
+	_, err = controller.CreateVolume(context.TODO(), req)
+	Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+	req.Parameters = map[string]string{attributeReadIOPS: "1000", attributeWriteIOPS: "500"}
+	req.MutableParameters = map[string]string{attributeWriteIOPS: "100"}
+	resp, err := controller.CreateVolume(context.TODO(), req)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp.GetVolume().GetVolumeContext()).To(Equal(req.Parameters))
+	attributes, err := readVolumeAttributes(tempDir, "testname")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(attributes).To(Equal(map[string]string{attributeReadIOPS: "1000", attributeWriteIOPS: "100"}))
+}
+
 func createTestRequest() *csi.CreateVolumeRequest {
 	return &csi.CreateVolumeRequest{
 		Name: "testname",
@@ -1362,13 +1532,13 @@ type mockSnapshotprovider struct {
 	sourceVolumes []string
 }
 
-func (m *mockSnapshotprovider) Initialize() error {
+func (m *mockSnapshotprovider) Initialize(_ context.Context) error {
 	m.sourceVolumes = append(m.sourceVolumes, validVolId)
 
 	return nil
 }
 
-func (m *mockSnapshotprovider) GetSnapshotById(snapshotId string) (*csi.Snapshot, error) {
+func (m *mockSnapshotprovider) GetSnapshotById(_ context.Context, snapshotId string) (*csi.Snapshot, error) {
 	for _, snap := range m.snapshots {
 		if snap.GetSnapshotId() == snapshotId {
 			return &snap, nil
@@ -1377,7 +1547,7 @@ func (m *mockSnapshotprovider) GetSnapshotById(snapshotId string) (*csi.Snapshot
 	return nil, nil
 }
 
-func (m *mockSnapshotprovider) GetSnapshotsByVolumeSourceId(volumeSourceId string) ([]csi.Snapshot, error) {
+func (m *mockSnapshotprovider) GetSnapshotsByVolumeSourceId(_ context.Context, volumeSourceId string) ([]csi.Snapshot, error) {
 	res := make([]csi.Snapshot, 0)
 	for _, snap := range m.snapshots {
 		if snap.GetSourceVolumeId() == volumeSourceId {
@@ -1387,11 +1557,11 @@ func (m *mockSnapshotprovider) GetSnapshotsByVolumeSourceId(volumeSourceId strin
 	return res, nil
 }
 
-func (m *mockSnapshotprovider) GetAllSnapshots() ([]csi.Snapshot, error) {
+func (m *mockSnapshotprovider) GetAllSnapshots(_ context.Context) ([]csi.Snapshot, error) {
 	return m.snapshots, nil
 }
 
-func (m *mockSnapshotprovider) CreateSnapshot(snapshotId, sourceVolumeId string) (*csi.Snapshot, error) {
+func (m *mockSnapshotprovider) CreateSnapshot(_ context.Context, snapshotId, sourceVolumeId string) (*csi.Snapshot, error) {
 	sourceFound := false
 	for _, source := range m.sourceVolumes {
 		if source == sourceVolumeId {
@@ -1412,7 +1582,7 @@ func (m *mockSnapshotprovider) CreateSnapshot(snapshotId, sourceVolumeId string)
 	return &snapshot, nil
 }
 
-func (m *mockSnapshotprovider) DeleteSnapshot(snapshotId string) error {
+func (m *mockSnapshotprovider) DeleteSnapshot(_ context.Context, snapshotId string) error {
 	res := make([]csi.Snapshot, 0)
 	for _, snap := range m.snapshots {
 		if snap.GetSnapshotId() != snapshotId {
@@ -1423,6 +1593,6 @@ func (m *mockSnapshotprovider) DeleteSnapshot(snapshotId string) error {
 	return nil
 }
 
-func (m *mockSnapshotprovider) RestoreSnapshot(snapshotId, targetPath string) error {
+func (m *mockSnapshotprovider) RestoreSnapshot(_ context.Context, snapshotId, targetPath string) error {
 	return nil
 }
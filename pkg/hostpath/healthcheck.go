@@ -17,6 +17,7 @@ limitations under the License.
 package hostpath
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -57,8 +58,8 @@ func parseMountInfo(originalMountInfo []byte) ([]MountPointInfo, error) {
 	return fs.Filsystem, nil
 }
 
-func checkMountPointExist(volumePath string) (bool, error) {
-	mountInfos, err := getMountInfos(volumePath)
+func checkMountPointExist(ctx context.Context, volumePath string) (bool, error) {
+	mountInfos, err := getMountInfos(ctx, volumePath)
 	if err != nil {
 		return false, err
 	}
@@ -101,17 +102,17 @@ func getPVStats(volumePath string) (available int64, capacity int64, used int64,
 	return fsInfo(volumePath)
 }
 
-func checkPVUsage(volumePath string) (int64, int64, error) {
+func checkPVUsage(ctx context.Context, volumePath string) (int64, int64, error) {
 	fsavailable, capacity, _, _, inodesFree, _, err := getPVStatsFunc(volumePath)
 	if err != nil {
 		return fsavailable, inodesFree, err
 	}
 
-	klog.V(3).Infof("fs available: %+v, total capacity: %d, percentage available: %.2f, number of free inodes: %d", fsavailable, capacity, float64(fsavailable)/float64(capacity)*100, inodesFree)
+	klog.FromContext(ctx).V(3).Info("Checked volume usage", "available", fsavailable, "capacity", capacity, "percentAvailable", float64(fsavailable)/float64(capacity)*100, "inodesFree", inodesFree)
 	return fsavailable, inodesFree, nil
 }
 
-func doHealthCheckInControllerSide(volumePath string) (bool, string) {
+func doHealthCheckInControllerSide(ctx context.Context, volumePath string) (bool, string) {
 	spExist, err := checkPathExist(volumePath)
 	if err != nil {
 		return false, err.Error()
@@ -121,11 +122,11 @@ func doHealthCheckInControllerSide(volumePath string) (bool, string) {
 		return false, "The source path of the volume doesn't exist"
 	}
 
-	return checkIfSpaceAvailable(volumePath)
+	return checkIfSpaceAvailable(ctx, volumePath)
 }
 
-func doHealthCheckInNodeSide(volumePath string) (bool, string) {
-	mpExist, err := checkMountPointExistsFunc(volumePath)
+func doHealthCheckInNodeSide(ctx context.Context, volumePath string) (bool, string) {
+	mpExist, err := checkMountPointExistsFunc(ctx, volumePath)
 	if err != nil {
 		return false, err.Error()
 	}
@@ -134,11 +135,11 @@ func doHealthCheckInNodeSide(volumePath string) (bool, string) {
 		return false, "The volume isn't mounted"
 	}
 
-	return checkIfSpaceAvailable(volumePath)
+	return checkIfSpaceAvailable(ctx, volumePath)
 }
 
-func checkIfSpaceAvailable(volumePath string) (bool, string) {
-	fsAvailable, inodesFree, err := checkPVUsage(volumePath)
+func checkIfSpaceAvailable(ctx context.Context, volumePath string) (bool, string) {
+	fsAvailable, inodesFree, err := checkPVUsage(ctx, volumePath)
 	if err != nil {
 		return false, err.Error()
 	}
@@ -17,6 +17,7 @@ limitations under the License.
 package hostpath
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -39,7 +40,7 @@ func Test_checkAvailableSpace(t *testing.T) {
 		getPVStatsFunc = func(volumePath string) (int64, int64, int64, int64, int64, int64, error) {
 			return 0, 0, 0, 0, 0, 0, nil
 		}
-		res, msg := checkIfSpaceAvailable("/test")
+		res, msg := checkIfSpaceAvailable(context.TODO(), "/test")
 		Expect(res).To(BeFalse())
 		Expect(msg).To(Equal("No space left on device"))
 	})
@@ -48,7 +49,7 @@ func Test_checkAvailableSpace(t *testing.T) {
 		getPVStatsFunc = func(volumePath string) (int64, int64, int64, int64, int64, int64, error) {
 			return 1000, 0, 0, 0, 0, 0, nil
 		}
-		res, msg := checkIfSpaceAvailable("/test")
+		res, msg := checkIfSpaceAvailable(context.TODO(), "/test")
 		Expect(res).To(BeFalse())
 		Expect(msg).To(Equal("No inodes remaining on device"))
 	})
@@ -56,7 +57,7 @@ func Test_checkAvailableSpace(t *testing.T) {
 		getPVStatsFunc = func(volumePath string) (int64, int64, int64, int64, int64, int64, error) {
 			return 1000, 0, 0, 0, 100, 0, fmt.Errorf("pv stats error")
 		}
-		res, msg := checkIfSpaceAvailable("/test")
+		res, msg := checkIfSpaceAvailable(context.TODO(), "/test")
 		Expect(res).To(BeFalse())
 		Expect(msg).To(ContainSubstring("pv stats error"))
 	})
@@ -64,7 +65,7 @@ func Test_checkAvailableSpace(t *testing.T) {
 		getPVStatsFunc = func(volumePath string) (int64, int64, int64, int64, int64, int64, error) {
 			return 1000, 0, 0, 0, 100, 0, nil
 		}
-		res, msg := checkIfSpaceAvailable("/test")
+		res, msg := checkIfSpaceAvailable(context.TODO(), "/test")
 		Expect(res).To(BeTrue())
 		Expect(msg).To(BeEmpty())
 	})
@@ -84,11 +85,11 @@ func Test_doHealthCheckInControllerSide(t *testing.T) {
 		return 1000, 0, 0, 0, 100, 0, nil
 	}
 	t.Run("valid health check", func(t *testing.T) {
-		res, _ := doHealthCheckInControllerSide(tempDir)
+		res, _ := doHealthCheckInControllerSide(context.TODO(), tempDir)
 		Expect(res).To(BeTrue())
 	})
 	t.Run("missing source path", func(t *testing.T) {
-		res, msg := doHealthCheckInControllerSide("/invalid")
+		res, msg := doHealthCheckInControllerSide(context.TODO(), "/invalid")
 		Expect(res).To(BeFalse())
 		Expect(msg).To(Equal("The source path of the volume doesn't exist"))
 	})
@@ -16,6 +16,7 @@ limitations under the License.
 package hostpath
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,6 +24,7 @@ import (
 	"time"
 
 	"golang.org/x/net/context"
+	"k8s.io/client-go/tools/record"
 	klog "k8s.io/klog/v2"
 	"k8s.io/utils/mount"
 )
@@ -44,6 +46,26 @@ type Config struct {
 	DefaultStoragePoolName string
 	Version                string
 	Mounter                mount.Interface
+	// TLS certificate, key and client CA files of the gRPC server, only
+	// supported with tcp endpoints.
+	GRPCCertFile     string
+	GRPCKeyFile      string
+	GRPCClientCAFile string
+	// Time to wait for in flight calls to complete when shutting down.
+	ShutdownTimeout time.Duration
+	// Maximum number of snapshots and restores, and of volume and snapshot
+	// deletes, running at once. Not limited when 0.
+	MaxConcurrentSnapshots int
+	MaxConcurrentDeletes   int
+	// Time an operation over its limit waits for a slot before it is rejected
+	// with ResourceExhausted.
+	OperationQueueTimeout time.Duration
+	// Advertise the MODIFY_VOLUME capability, so the volumes can be modified
+	// by a VolumeAttributesClass.
+	EnableModifyVolume bool
+	// Records events on the pods, like the volumes published without their
+	// I/O limits. No events are recorded when nil.
+	EventRecorder record.EventRecorder
 }
 
 type hostPath struct {
@@ -68,6 +90,12 @@ func NewHostPathDriver(ctx context.Context, cfg *Config, dataDir string) (*hostP
 	if cfg.Version == "" {
 		return nil, errors.New("no version provided")
 	}
+	if err := validateGRPCTLSConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.MaxConcurrentSnapshots < 0 || cfg.MaxConcurrentDeletes < 0 || cfg.OperationQueueTimeout < 0 {
+		return nil, errors.New("concurrency limits and operation queue timeout must not be negative")
+	}
 	if cfg.Mounter == nil {
 		cfg.Mounter = mount.New("")
 	}
@@ -98,11 +126,13 @@ func NewHostPathDriver(ctx context.Context, cfg *Config, dataDir string) (*hostP
 
 	go func() {
 		evaluateSharedPathMetric(cfg.StoragePoolInfo)
+		evaluatePoolMetrics(cfg.StoragePoolInfo)
 		// Run this every minute so we catch the current state in metric (imagine people remounting on their own)
 		for {
 			select {
 			case <-time.After(1 * time.Minute):
 				evaluateSharedPathMetric(cfg.StoragePoolInfo)
+				evaluatePoolMetrics(cfg.StoragePoolInfo)
 			case <-ctx.Done():
 				return
 			}
@@ -120,10 +150,56 @@ func NewHostPathDriver(ctx context.Context, cfg *Config, dataDir string) (*hostP
 	return hp, nil
 }
 
-func (hp *hostPath) Run() error {
+// Run serves the CSI services until the context is cancelled. On cancellation
+// it stops accepting new calls, and waits up to the configured shutdown timeout
+// for the calls in flight to complete.
+func (hp *hostPath) Run(ctx context.Context) error {
+	var tlsConfig *tls.Config
+	if hp.cfg.GRPCCertFile != "" {
+		var err error
+		tlsConfig, err = newGRPCServerTLSConfig(hp.cfg.GRPCCertFile, hp.cfg.GRPCKeyFile, hp.cfg.GRPCClientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+	// Apply the I/O limits of the published volumes again, they may have been
+	// modified while the driver was down.
+	if err := reapplyIOLimits(ctx, hp.cfg.StoragePoolInfo, ""); err != nil {
+		klog.Errorf("Failed to apply the I/O limits of the published volumes: %v", err)
+	}
 	s := NewNonBlockingGRPCServer()
-	s.Start(hp.cfg.Endpoint, hp.identity, hp.controller, hp.node)
-	s.Wait()
+	if err := s.Start(hp.cfg.Endpoint, tlsConfig, hp.identity, hp.controller, hp.node); err != nil {
+		return err
+	}
 
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		klog.V(1).Infof("Shutting down, waiting up to %s for in flight calls to complete", hp.cfg.ShutdownTimeout)
+		s.Stop(hp.cfg.ShutdownTimeout)
+		<-done
+		return nil
+	}
+}
+
+func validateGRPCTLSConfig(cfg *Config) error {
+	if cfg.GRPCCertFile == "" && cfg.GRPCKeyFile == "" && cfg.GRPCClientCAFile == "" {
+		return nil
+	}
+	if cfg.GRPCCertFile == "" || cfg.GRPCKeyFile == "" {
+		return errors.New("both a gRPC TLS certificate and key must be provided")
+	}
+	proto, _, err := parse(cfg.Endpoint)
+	if err != nil {
+		return err
+	}
+	if proto != "tcp" {
+		return errors.New("gRPC TLS is only supported with tcp endpoints")
+	}
 	return nil
 }
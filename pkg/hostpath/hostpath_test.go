@@ -84,6 +84,18 @@ func Test_NewHostPathDriver(t *testing.T) {
 		Expect(err).To(BeEquivalentTo(errors.New("no version provided")))
 	})
 
+	t.Run("negative concurrency limit", func(t *testing.T) {
+		cfg := &Config{
+			DriverName:           "test_driver",
+			NodeID:               "test_nodeid",
+			Endpoint:             "unix://test.sock",
+			Version:              "test_version",
+			MaxConcurrentDeletes: -1,
+		}
+		_, err = NewHostPathDriver(context.TODO(), cfg, fmt.Sprintf(TestDatadirValue, tempDir))
+		Expect(err).To(MatchError(ContainSubstring("must not be negative")))
+	})
+
 	t.Run("valid config", func(t *testing.T) {
 		cfg := &Config{
 			DriverName: "test_driver",
@@ -132,3 +144,78 @@ func Test_NewHostPathDriver(t *testing.T) {
 		Expect(int(metrics.GetPoolPathSharedWithOs())).To(BeEquivalentTo(1))
 	})
 }
+
+func Test_validateGRPCTLSConfig(t *testing.T) {
+	RegisterTestingT(t)
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr bool
+	}{
+		{
+			name: "no TLS",
+			cfg:  &Config{Endpoint: "unix://test.sock"},
+		},
+		{
+			name: "TLS with tcp endpoint",
+			cfg:  &Config{Endpoint: "tcp://127.0.0.1:10000", GRPCCertFile: "tls.crt", GRPCKeyFile: "tls.key", GRPCClientCAFile: "ca.crt"},
+		},
+		{
+			name:    "TLS with unix endpoint",
+			cfg:     &Config{Endpoint: "unix://test.sock", GRPCCertFile: "tls.crt", GRPCKeyFile: "tls.key"},
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			cfg:     &Config{Endpoint: "tcp://127.0.0.1:10000", GRPCCertFile: "tls.crt"},
+			wantErr: true,
+		},
+		{
+			name:    "client CA without certificate",
+			cfg:     &Config{Endpoint: "tcp://127.0.0.1:10000", GRPCClientCAFile: "ca.crt"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGRPCTLSConfig(tt.cfg)
+			if tt.wantErr {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func Test_Run(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	socket := filepath.Join(tempDir, "csi.sock")
+	cfg := &Config{
+		DriverName:      "test_driver",
+		NodeID:          "test_nodeid",
+		Endpoint:        "unix:/" + socket,
+		Version:         "test_version",
+		Mounter:         mount.NewFakeMounter([]mount.MountPoint{}),
+		ShutdownTimeout: time.Second,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	drv, err := NewHostPathDriver(ctx, cfg, fmt.Sprintf(TestDatadirValue, filepath.Join(tempDir, "testdatadir")))
+	Expect(err).ToNot(HaveOccurred())
+
+	result := make(chan error, 1)
+	go func() {
+		result <- drv.Run(ctx)
+	}()
+	Eventually(func() error {
+		_, err := os.Stat(socket)
+		return err
+	}).Should(Succeed())
+
+	cancel()
+	Eventually(result).Should(Receive(BeNil()))
+	_, err = os.Stat(socket)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
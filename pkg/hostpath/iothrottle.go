@@ -0,0 +1,377 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// cgroupRoot is the mount point of the cgroup v2 hierarchy of the node.
+	cgroupRoot = "/sys/fs/cgroup"
+	// sysDevBlockPath has the sysfs directories of the block devices by
+	// major:minor number.
+	sysDevBlockPath = "/sys/dev/block"
+	// deviceNumberFunc and getMountInfosFunc are variables so the devices and
+	// mounts can be faked in the tests.
+	deviceNumberFunc  = deviceNumber
+	getMountInfosFunc = getMountInfos
+
+	// podUIDRegexp matches the pod UID in the target path of a volume, like
+	// /var/lib/kubelet/pods/<uid>/volumes/kubernetes.io~csi/<pv>/mount.
+	podUIDRegexp = regexp.MustCompile(`/pods/([^/]+)/volumes/`)
+)
+
+// ioLimitKeys are the attributes of the I/O limits, with their key in io.max.
+var ioLimitKeys = []struct {
+	attribute string
+	key       string
+}{
+	{attributeReadBPS, "rbps"},
+	{attributeWriteBPS, "wbps"},
+	{attributeReadIOPS, "riops"},
+	{attributeWriteIOPS, "wiops"},
+}
+
+// volumeIOLimits returns the I/O limits in params.
+func volumeIOLimits(params map[string]string) map[string]string {
+	limits := make(map[string]string)
+	for _, limit := range ioLimitKeys {
+		if value, ok := params[limit.attribute]; ok {
+			limits[limit.attribute] = value
+		}
+	}
+	return limits
+}
+
+// ioMaxLine returns the io.max line limiting the I/O to device to limits,
+// with no limit for the missing ones.
+func ioMaxLine(device string, limits map[string]string) string {
+	var b strings.Builder
+	b.WriteString(device)
+	for _, limit := range ioLimitKeys {
+		value, ok := limits[limit.attribute]
+		if !ok {
+			value = "max"
+		}
+		fmt.Fprintf(&b, " %s=%s", limit.key, value)
+	}
+	return b.String()
+}
+
+// applyIOLimits limits the I/O of the pod owning targetPath to the block
+// device of the storage pool at poolPath, through the io.max file of the pod
+// cgroup. io.max has a single line per device, so the limits of the other
+// volumes of the pod on the same device, in pools, are added to limits.
+func applyIOLimits(ctx context.Context, pools map[string]StoragePoolInfo, poolPath, targetPath string, limits map[string]string) error {
+	match := podUIDRegexp.FindStringSubmatch(targetPath)
+	if match == nil {
+		return fmt.Errorf("unable to find the pod of target path %s", targetPath)
+	}
+	podCgroup, err := podCgroupPath(match[1])
+	if err != nil {
+		return err
+	}
+	device, err := poolDevice(ctx, poolPath)
+	if err != nil {
+		return err
+	}
+	volumeLimits, err := podDeviceIOLimits(ctx, pools, match[1], device, targetPath)
+	if err != nil {
+		return err
+	}
+	limits, err = sumIOLimits(append(volumeLimits, limits))
+	if err != nil {
+		return err
+	}
+	line := ioMaxLine(device, limits)
+	if err := writeCgroupFile(filepath.Join(podCgroup, "io.max"), line); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("the io controller is not enabled in %s", podCgroup)
+		}
+		return fmt.Errorf("unable to set io.max of %s: %w", podCgroup, err)
+	}
+	klog.FromContext(ctx).V(3).Info("Limited I/O of pod", "cgroup", podCgroup, "ioMax", line)
+	return nil
+}
+
+// releaseIOLimits sets the io.max of the pod owning targetPath again once the
+// volume volID was unpublished from it, to the limits of its other volumes on
+// the same device. The pods without a cgroup or an io.max file, and the
+// volumes not on a block device, were never limited and are left alone.
+func releaseIOLimits(ctx context.Context, pools map[string]StoragePoolInfo, volID, targetPath string) error {
+	match := podUIDRegexp.FindStringSubmatch(targetPath)
+	if match == nil {
+		return nil
+	}
+	podCgroup, err := podCgroupPath(match[1])
+	if err != nil {
+		return nil
+	}
+	ioMax := filepath.Join(podCgroup, "io.max")
+	if _, err := os.Stat(ioMax); err != nil {
+		return nil
+	}
+	for _, pool := range pools {
+		if exists, err := checkPathExist(filepath.Join(pool.Path, volID)); err != nil || !exists {
+			continue
+		}
+		device, err := poolDevice(ctx, pool.Path)
+		if err != nil {
+			return nil
+		}
+		volumeLimits, err := podDeviceIOLimits(ctx, pools, match[1], device, targetPath)
+		if err != nil {
+			return err
+		}
+		limits, err := sumIOLimits(volumeLimits)
+		if err != nil {
+			return err
+		}
+		line := ioMaxLine(device, limits)
+		if err := writeCgroupFile(ioMax, line); err != nil {
+			return fmt.Errorf("unable to set io.max of %s: %w", podCgroup, err)
+		}
+		klog.FromContext(ctx).V(3).Info("Released I/O limits of volume", "volumeID", volID, "cgroup", podCgroup, "ioMax", line)
+		return nil
+	}
+	return nil
+}
+
+// podDeviceIOLimits returns the persisted I/O limits of the volumes in pools
+// published to the pod with the UID on device, other than the one at
+// targetPath. The volumes without limits are left out.
+func podDeviceIOLimits(ctx context.Context, pools map[string]StoragePoolInfo, podUID, device, targetPath string) ([]map[string]string, error) {
+	mountInfos, err := getMountInfosFunc(ctx, "--list")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the mounts: %w", err)
+	}
+	var volumeLimits []map[string]string
+	poolDevices := make(map[string]string)
+	for _, mountInfo := range mountInfos {
+		match := podUIDRegexp.FindStringSubmatch(mountInfo.Target)
+		if match == nil || match[1] != podUID || mountInfo.Target == targetPath {
+			continue
+		}
+		volID, ok := publishedVolumeID(mountInfo)
+		if !ok {
+			continue
+		}
+		for _, pool := range pools {
+			if exists, err := checkPathExist(filepath.Join(pool.Path, volID)); err != nil || !exists {
+				continue
+			}
+			if _, ok := poolDevices[pool.Path]; !ok {
+				// A pool not on a block device is on no device.
+				poolDevices[pool.Path], _ = poolDevice(ctx, pool.Path)
+			}
+			if poolDevices[pool.Path] != device {
+				continue
+			}
+			attributes, err := readVolumeAttributes(pool.Path, volID)
+			if err != nil {
+				return nil, err
+			}
+			if limits := volumeIOLimits(attributes); len(limits) > 0 {
+				volumeLimits = append(volumeLimits, limits)
+			}
+		}
+	}
+	return volumeLimits, nil
+}
+
+// sumIOLimits returns the limits letting all the volumes use their own limits
+// at once: the sum of the limits, and no limit for the keys one of the
+// volumes does not limit.
+func sumIOLimits(volumeLimits []map[string]string) (map[string]string, error) {
+	sum := make(map[string]string)
+	for _, limit := range ioLimitKeys {
+		var total uint64
+		limited := true
+		for _, limits := range volumeLimits {
+			value, ok := limits[limit.attribute]
+			if !ok {
+				limited = false
+				break
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s limit %q: %w", limit.attribute, value, err)
+			}
+			total += n
+		}
+		if limited && len(volumeLimits) > 0 {
+			sum[limit.attribute] = strconv.FormatUint(total, 10)
+		}
+	}
+	return sum, nil
+}
+
+// publishedVolumeID returns the ID of the volume bind mounted by mountInfo,
+// whose source is the device with the directory of the volume in brackets.
+func publishedVolumeID(mountInfo MountPointInfo) (string, bool) {
+	start, end := strings.Index(mountInfo.Source, "["), strings.LastIndex(mountInfo.Source, "]")
+	if start < 0 || end < start {
+		return "", false
+	}
+	volID := filepath.Base(mountInfo.Source[start+1 : end])
+	return volID, isPathElement(volID)
+}
+
+// writeCgroupFile writes content to the existing cgroup interface file at path.
+func writeCgroupFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// podCgroupPath returns the cgroup of the pod with the UID, named like
+// pod<uid> by the cgroupfs driver of the kubelet, and like
+// kubepods-<qos>-pod<uid>.slice with the dashes of the UID replaced by
+// underscores by the systemd driver.
+func podCgroupPath(uid string) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is required to limit I/O, %s is not a cgroup v2 hierarchy", cgroupRoot)
+	}
+	cgroupfsName := "pod" + uid
+	systemdSuffix := "-pod" + strings.ReplaceAll(uid, "-", "_") + ".slice"
+	found := ""
+	err := filepath.WalkDir(cgroupRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if name := d.Name(); name == cgroupfsName || strings.HasSuffix(name, systemdSuffix) {
+			found = path
+			return filepath.SkipAll
+		}
+		// The pods are at most in kubepods/<qos>/, below the cgroup of the
+		// kubelet when it runs in a container.
+		if strings.Count(strings.TrimPrefix(path, cgroupRoot), "/") >= 4 {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("cgroup of pod %s not found in %s", uid, cgroupRoot)
+	}
+	return found, nil
+}
+
+// poolDevice returns the major:minor number of the disk the storage pool at
+// poolPath is on.
+func poolDevice(ctx context.Context, poolPath string) (string, error) {
+	mountInfos, err := getMountInfosFunc(ctx, "-T", poolPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to find the mount of %s: %w", poolPath, err)
+	}
+	if len(mountInfos) != 1 {
+		return "", fmt.Errorf("unable to find the mount of %s", poolPath)
+	}
+	device := extractDeviceFromMountInfoSource(mountInfos[0].Source)
+	if !strings.HasPrefix(device, "/dev/") {
+		return "", fmt.Errorf("storage pool %s is on %s, which is not a block device", poolPath, device)
+	}
+	major, minor, err := deviceNumberFunc(device)
+	if err != nil {
+		return "", err
+	}
+	return wholeDisk(fmt.Sprintf("%d:%d", major, minor)), nil
+}
+
+func deviceNumber(device string) (uint32, uint32, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(device, &stat); err != nil {
+		return 0, 0, fmt.Errorf("unable to stat %s: %w", device, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", device)
+	}
+	return unix.Major(stat.Rdev), unix.Minor(stat.Rdev), nil
+}
+
+// wholeDisk returns the disk of the partition with the major:minor number,
+// since io.max only accepts disks. Other devices are returned as is.
+func wholeDisk(device string) string {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysDevBlockPath, device))
+	if err != nil {
+		return device
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err != nil {
+		return device
+	}
+	disk, err := os.ReadFile(filepath.Join(filepath.Dir(dir), "dev"))
+	if err != nil {
+		return device
+	}
+	return strings.TrimSpace(string(disk))
+}
+
+// reapplyIOLimits applies the persisted I/O limits of the published volumes
+// again, after the driver restarted or the limits of a volume were modified.
+// Only the volume with volumeID is updated when it is set.
+func reapplyIOLimits(ctx context.Context, pools map[string]StoragePoolInfo, volumeID string) error {
+	mountInfos, err := getMountInfosFunc(ctx, "--list")
+	if err != nil {
+		return fmt.Errorf("unable to list the mounts: %w", err)
+	}
+	var errs []error
+	for _, mountInfo := range mountInfos {
+		if !podUIDRegexp.MatchString(mountInfo.Target) {
+			continue
+		}
+		volID, ok := publishedVolumeID(mountInfo)
+		if !ok || (volumeID != "" && volID != volumeID) {
+			continue
+		}
+		for _, pool := range pools {
+			if exists, err := checkPathExist(filepath.Join(pool.Path, volID)); err != nil || !exists {
+				continue
+			}
+			attributes, err := readVolumeAttributes(pool.Path, volID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if limits := volumeIOLimits(attributes); len(limits) > 0 {
+				if err := applyIOLimits(ctx, pools, pool.Path, mountInfo.Target, limits); err != nil {
+					errs = append(errs, fmt.Errorf("volume %s: %w", volID, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
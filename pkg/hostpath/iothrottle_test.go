@@ -0,0 +1,371 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/mount"
+)
+
+const (
+	testPodUID      = "1234-5678"
+	testOtherPodUID = "8765-4321"
+)
+
+// fakeNode is a fake cgroupfs and sysfs tree, with the storage pools mounted
+// from the devices in mounts.
+type fakeNode struct {
+	cgroupRoot string
+	// mounts maps the paths to the source of their mount.
+	mounts map[string]string
+}
+
+// setupFakeNode creates a cgroup v2 hierarchy with a pod cgroup created by
+// the systemd driver and one by the cgroupfs driver, and a sysfs with the disk
+// sda and its partition sda1.
+func setupFakeNode(t *testing.T) *fakeNode {
+	RegisterTestingT(t)
+	dir := t.TempDir()
+	node := &fakeNode{cgroupRoot: filepath.Join(dir, "cgroup"), mounts: map[string]string{}}
+	for _, path := range []string{
+		"cgroup.controllers",
+		"kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice/io.max",
+		"kubepods/besteffort/pod" + testOtherPodUID + "/io.max",
+	} {
+		writeTestFile(filepath.Join(node.cgroupRoot, path), "")
+	}
+	writeTestFile(filepath.Join(dir, "sys/devices/sda/dev"), "8:0\n")
+	writeTestFile(filepath.Join(dir, "sys/devices/sda/sda1/dev"), "8:1\n")
+	writeTestFile(filepath.Join(dir, "sys/devices/sda/sda1/partition"), "1\n")
+	Expect(os.MkdirAll(filepath.Join(dir, "sys/dev/block"), 0755)).To(Succeed())
+	Expect(os.Symlink("../../devices/sda", filepath.Join(dir, "sys/dev/block/8:0"))).To(Succeed())
+	Expect(os.Symlink("../../devices/sda/sda1", filepath.Join(dir, "sys/dev/block/8:1"))).To(Succeed())
+
+	origCgroupRoot, origSysDevBlockPath := cgroupRoot, sysDevBlockPath
+	origDeviceNumberFunc, origGetMountInfosFunc := deviceNumberFunc, getMountInfosFunc
+	t.Cleanup(func() {
+		cgroupRoot, sysDevBlockPath = origCgroupRoot, origSysDevBlockPath
+		deviceNumberFunc, getMountInfosFunc = origDeviceNumberFunc, origGetMountInfosFunc
+	})
+	cgroupRoot = node.cgroupRoot
+	sysDevBlockPath = filepath.Join(dir, "sys/dev/block")
+	deviceNumberFunc = func(device string) (uint32, uint32, error) {
+		switch device {
+		case "/dev/sda":
+			return 8, 0, nil
+		case "/dev/sda1":
+			return 8, 1, nil
+		case "/dev/vdb":
+			return 252, 16, nil
+		}
+		return 0, 0, fmt.Errorf("%s is not a block device", device)
+	}
+	getMountInfosFunc = func(_ context.Context, args ...string) ([]MountPointInfo, error) {
+		if len(args) == 2 && args[0] == "-T" {
+			if source, ok := node.mounts[args[1]]; ok {
+				return []MountPointInfo{{Target: args[1], Source: source}}, nil
+			}
+			return nil, fmt.Errorf("%s not found", args[1])
+		}
+		mountInfos := []MountPointInfo{}
+		for target, source := range node.mounts {
+			mountInfos = append(mountInfos, MountPointInfo{Target: target, Source: source})
+		}
+		return mountInfos, nil
+	}
+	return node
+}
+
+func (n *fakeNode) ioMax(path string) string {
+	data, err := os.ReadFile(filepath.Join(n.cgroupRoot, path, "io.max"))
+	Expect(err).ToNot(HaveOccurred())
+	return string(data)
+}
+
+func writeTestFile(path, content string) {
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+}
+
+func testTargetPath(base, podUID string) string {
+	return filepath.Join(base, "pods", podUID, "volumes/kubernetes.io~csi/pvc-1/mount")
+}
+
+func Test_ioMaxLine(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(ioMaxLine("8:0", nil)).To(Equal("8:0 rbps=max wbps=max riops=max wiops=max"))
+	Expect(ioMaxLine("8:0", map[string]string{
+		attributeReadBPS:   "1048576",
+		attributeWriteIOPS: "100",
+	})).To(Equal("8:0 rbps=1048576 wbps=max riops=max wiops=100"))
+}
+
+func Test_applyIOLimits(t *testing.T) {
+	limits := map[string]string{attributeReadIOPS: "1000", attributeWriteBPS: "1048576"}
+	tests := []struct {
+		name       string
+		source     string
+		targetPath string
+		setup      func(node *fakeNode)
+		cgroup     string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "systemd driver",
+			source:     "/dev/vdb",
+			targetPath: testTargetPath("/var/lib/kubelet", testPodUID),
+			cgroup:     "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice",
+			want:       "252:16 rbps=max wbps=1048576 riops=1000 wiops=max",
+		},
+		{
+			name:       "cgroupfs driver",
+			source:     "/dev/vdb",
+			targetPath: testTargetPath("/var/lib/kubelet", testOtherPodUID),
+			cgroup:     "kubepods/besteffort/pod" + testOtherPodUID,
+			want:       "252:16 rbps=max wbps=1048576 riops=1000 wiops=max",
+		},
+		{
+			name:       "partition",
+			source:     "/dev/sda1[/hpvolumes]",
+			targetPath: testTargetPath("/var/lib/kubelet", testPodUID),
+			cgroup:     "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice",
+			want:       "8:0 rbps=max wbps=1048576 riops=1000 wiops=max",
+		},
+		{
+			name:       "not a pod volume",
+			source:     "/dev/vdb",
+			targetPath: "/mnt/volume",
+			wantErr:    true,
+		},
+		{
+			name:       "unknown pod",
+			source:     "/dev/vdb",
+			targetPath: testTargetPath("/var/lib/kubelet", "0000"),
+			wantErr:    true,
+		},
+		{
+			name:       "not a block device",
+			source:     "tmpfs",
+			targetPath: testTargetPath("/var/lib/kubelet", testPodUID),
+			wantErr:    true,
+		},
+		{
+			name:       "io controller not enabled",
+			source:     "/dev/vdb",
+			targetPath: testTargetPath("/var/lib/kubelet", testOtherPodUID),
+			setup: func(node *fakeNode) {
+				Expect(os.Remove(filepath.Join(node.cgroupRoot, "kubepods/besteffort/pod"+testOtherPodUID, "io.max"))).To(Succeed())
+			},
+			wantErr: true,
+		},
+		{
+			name:       "cgroup v1",
+			source:     "/dev/vdb",
+			targetPath: testTargetPath("/var/lib/kubelet", testPodUID),
+			setup: func(node *fakeNode) {
+				Expect(os.Remove(filepath.Join(node.cgroupRoot, "cgroup.controllers"))).To(Succeed())
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := setupFakeNode(t)
+			node.mounts["/var/hpvolumes"] = tt.source
+			if tt.setup != nil {
+				tt.setup(node)
+			}
+			err := applyIOLimits(context.TODO(), nil, "/var/hpvolumes", tt.targetPath, limits)
+			if tt.wantErr {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node.ioMax(tt.cgroup)).To(Equal(tt.want))
+		})
+	}
+}
+
+func Test_sumIOLimits(t *testing.T) {
+	RegisterTestingT(t)
+	limits, err := sumIOLimits(nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(limits).To(BeEmpty())
+	limits, err = sumIOLimits([]map[string]string{
+		{attributeReadBPS: "100", attributeWriteBPS: "10"},
+		{attributeReadBPS: "50", attributeReadIOPS: "5"},
+	})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(limits).To(Equal(map[string]string{attributeReadBPS: "150"}))
+	_, err = sumIOLimits([]map[string]string{{attributeReadBPS: "fast"}})
+	Expect(err).To(HaveOccurred())
+}
+
+func Test_applyIOLimitsOtherVolumesOfPod(t *testing.T) {
+	node := setupFakeNode(t)
+	poolDir := t.TempDir()
+	otherPoolDir := t.TempDir()
+	for _, volID := range []string{"pvc-1", "pvc-2", "pvc-3"} {
+		Expect(os.Mkdir(filepath.Join(poolDir, volID), 0755)).To(Succeed())
+	}
+	Expect(os.Mkdir(filepath.Join(otherPoolDir, "pvc-4"), 0755)).To(Succeed())
+	Expect(writeVolumeAttributes(poolDir, "pvc-1", map[string]string{attributeReadBPS: "100", attributeWriteIOPS: "10"})).To(Succeed())
+	Expect(writeVolumeAttributes(poolDir, "pvc-2", map[string]string{attributeReadBPS: "1000"})).To(Succeed())
+	Expect(writeVolumeAttributes(otherPoolDir, "pvc-4", map[string]string{attributeReadBPS: "10000"})).To(Succeed())
+	pools := map[string]StoragePoolInfo{
+		"local": {Name: "local", Path: poolDir},
+		"other": {Name: "other", Path: otherPoolDir},
+	}
+	node.mounts[poolDir] = "/dev/sda1"
+	node.mounts[otherPoolDir] = "/dev/vdb"
+	podVolumes := "/var/lib/kubelet/pods/" + testPodUID + "/volumes/kubernetes.io~csi/"
+	// pvc-1 is published to the pod, pvc-2 to another pod, pvc-3 without
+	// limits and pvc-4 on another disk.
+	node.mounts[podVolumes+"pvc-1/mount"] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-1") + "]"
+	node.mounts[testTargetPath("/var/lib/kubelet", testOtherPodUID)] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-2") + "]"
+	node.mounts[podVolumes+"pvc-3/mount"] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-3") + "]"
+	node.mounts[podVolumes+"pvc-4/mount"] = "/dev/vdb[" + filepath.Join(otherPoolDir, "pvc-4") + "]"
+	cgroup := "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice"
+
+	// Publishing another volume to the pod keeps the limits of pvc-1.
+	Expect(applyIOLimits(context.TODO(), pools, poolDir, podVolumes+"pvc-5/mount", map[string]string{
+		attributeReadBPS:   "50",
+		attributeWriteIOPS: "20",
+	})).To(Succeed())
+	Expect(node.ioMax(cgroup)).To(Equal("8:0 rbps=150 wbps=max riops=max wiops=30"))
+
+	// Publishing pvc-1 again does not count its persisted limits twice.
+	Expect(applyIOLimits(context.TODO(), pools, poolDir, podVolumes+"pvc-1/mount", map[string]string{
+		attributeReadBPS: "100",
+	})).To(Succeed())
+	Expect(node.ioMax(cgroup)).To(Equal("8:0 rbps=100 wbps=max riops=max wiops=max"))
+}
+
+func Test_reapplyIOLimits(t *testing.T) {
+	node := setupFakeNode(t)
+	poolDir := t.TempDir()
+	for _, volID := range []string{"pvc-1", "pvc-2"} {
+		Expect(os.Mkdir(filepath.Join(poolDir, volID), 0755)).To(Succeed())
+	}
+	Expect(writeVolumeAttributes(poolDir, "pvc-1", map[string]string{attributeReadIOPS: "100", attributeMode: "0750"})).To(Succeed())
+	Expect(writeVolumeAttributes(poolDir, "pvc-2", map[string]string{attributeWriteIOPS: "200"})).To(Succeed())
+	pools := map[string]StoragePoolInfo{"local": {Name: "local", Path: poolDir}}
+	node.mounts[poolDir] = "/dev/sda1"
+	node.mounts[testTargetPath("/var/lib/kubelet", testPodUID)] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-1") + "]"
+	node.mounts[testTargetPath("/var/lib/kubelet", testOtherPodUID)] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-2") + "]"
+	node.mounts["/var/lib/kubelet/pods/0000/volumes/kubernetes.io~csi/pvc-3/mount"] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-3") + "]"
+
+	Expect(reapplyIOLimits(context.TODO(), pools, "pvc-2")).To(Succeed())
+	Expect(node.ioMax("kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice")).To(BeEmpty())
+	Expect(node.ioMax("kubepods/besteffort/pod" + testOtherPodUID)).To(Equal("8:0 rbps=max wbps=max riops=max wiops=200"))
+
+	Expect(reapplyIOLimits(context.TODO(), pools, "")).To(Succeed())
+	Expect(node.ioMax("kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice")).To(Equal("8:0 rbps=max wbps=max riops=100 wiops=max"))
+}
+
+func Test_NodePublishVolumeIOLimits(t *testing.T) {
+	node := setupFakeNode(t)
+	poolDir := t.TempDir()
+	kubeletDir := t.TempDir()
+	node.mounts[poolDir] = "/dev/vdb"
+	targetPath := testTargetPath(kubeletDir, testPodUID)
+	Expect(os.MkdirAll(filepath.Dir(targetPath), 0755)).To(Succeed())
+	Expect(os.Mkdir(filepath.Join(poolDir, "pvc-1"), 0755)).To(Succeed())
+	Expect(writeVolumeAttributes(poolDir, "pvc-1", map[string]string{attributeWriteIOPS: "100"})).To(Succeed())
+
+	nodeServer := createNodeServer(testNode)
+	nodeServer.cfg.StoragePoolInfo = map[string]StoragePoolInfo{"local": {Name: "local", Path: poolDir}}
+	fakeMounter := mount.NewFakeMounter([]mount.MountPoint{})
+	nodeServer.cfg.Mounter = fakeMounter
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:   "pvc-1",
+		TargetPath: targetPath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+		},
+		VolumeContext: map[string]string{
+			"storagePool":      "local",
+			attributeReadIOPS:  "1000",
+			attributeWriteIOPS: "500",
+		},
+	}
+	_, err := nodeServer.NodePublishVolume(context.TODO(), req)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(fakeMounter.GetLog()).To(HaveLen(1))
+	cgroup := "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice"
+	Expect(node.ioMax(cgroup)).To(Equal("252:16 rbps=max wbps=max riops=1000 wiops=100"))
+
+	req.VolumeContext[attributeReadIOPS] = "0"
+	_, err = nodeServer.NodePublishVolume(context.TODO(), req)
+	Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+	// The volume is published without limits when the node cannot set them,
+	// with an event on the pod.
+	recorder := record.NewFakeRecorder(1)
+	nodeServer.cfg.EventRecorder = recorder
+	delete(req.VolumeContext, attributeReadIOPS)
+	req.VolumeContext[podNameContextKey] = "vm"
+	req.VolumeContext[podNamespaceContextKey] = "vms"
+	req.VolumeContext[podUIDContextKey] = testPodUID
+	Expect(os.Remove(filepath.Join(node.cgroupRoot, cgroup, "io.max"))).To(Succeed())
+	_, err = nodeServer.NodePublishVolume(context.TODO(), req)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(recorder.Events).To(Receive(HavePrefix(corev1.EventTypeWarning + " " + ioLimitsNotAppliedReason)))
+}
+
+func Test_releaseIOLimits(t *testing.T) {
+	node := setupFakeNode(t)
+	poolDir := t.TempDir()
+	for _, volID := range []string{"pvc-1", "pvc-2"} {
+		Expect(os.Mkdir(filepath.Join(poolDir, volID), 0755)).To(Succeed())
+	}
+	Expect(writeVolumeAttributes(poolDir, "pvc-1", map[string]string{attributeReadBPS: "100"})).To(Succeed())
+	Expect(writeVolumeAttributes(poolDir, "pvc-2", map[string]string{attributeReadBPS: "1000"})).To(Succeed())
+	pools := map[string]StoragePoolInfo{"local": {Name: "local", Path: poolDir}}
+	node.mounts[poolDir] = "/dev/sda1"
+	podVolumes := "/var/lib/kubelet/pods/" + testPodUID + "/volumes/kubernetes.io~csi/"
+	node.mounts[podVolumes+"pvc-1/mount"] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-1") + "]"
+	node.mounts[podVolumes+"pvc-2/mount"] = "/dev/sda1[" + filepath.Join(poolDir, "pvc-2") + "]"
+	cgroup := "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice"
+	Expect(applyIOLimits(context.TODO(), pools, poolDir, podVolumes+"pvc-2/mount", map[string]string{attributeReadBPS: "1000"})).To(Succeed())
+	Expect(node.ioMax(cgroup)).To(Equal("8:0 rbps=1100 wbps=max riops=max wiops=max"))
+
+	// Unpublishing pvc-2 leaves the limits of pvc-1, and then none.
+	delete(node.mounts, podVolumes+"pvc-2/mount")
+	Expect(releaseIOLimits(context.TODO(), pools, "pvc-2", podVolumes+"pvc-2/mount")).To(Succeed())
+	Expect(node.ioMax(cgroup)).To(Equal("8:0 rbps=100 wbps=max riops=max wiops=max"))
+	delete(node.mounts, podVolumes+"pvc-1/mount")
+	Expect(releaseIOLimits(context.TODO(), pools, "pvc-1", podVolumes+"pvc-1/mount")).To(Succeed())
+	Expect(node.ioMax(cgroup)).To(Equal("8:0 rbps=max wbps=max riops=max wiops=max"))
+
+	// The pods without a cgroup are deleted already.
+	Expect(releaseIOLimits(context.TODO(), pools, "pvc-1", testTargetPath("/var/lib/kubelet", "0000"))).To(Succeed())
+}
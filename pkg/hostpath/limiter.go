@@ -0,0 +1,95 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	klog "k8s.io/klog/v2"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+const (
+	// snapshotOperation covers the reflink copies of snapshots and restores.
+	snapshotOperation = "snapshot"
+	// deleteOperation covers the recursive deletes of volumes and snapshots.
+	deleteOperation = "delete"
+)
+
+// operationLimiter bounds the number of operations of one type running at
+// once. Operations over the limit wait for up to the queue timeout, and are
+// then rejected with ResourceExhausted so the sidecars back off and retry.
+// A nil limiter does not limit anything.
+type operationLimiter struct {
+	operation    string
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// newOperationLimiter returns a limiter running at most limit operations at
+// once, or nil when limit is not positive.
+func newOperationLimiter(operation string, limit int, queueTimeout time.Duration) *operationLimiter {
+	if limit <= 0 {
+		metrics.SetOperationConcurrencyLimit(operation, 0)
+		return nil
+	}
+	metrics.SetOperationConcurrencyLimit(operation, limit)
+	return &operationLimiter{
+		operation:    operation,
+		slots:        make(chan struct{}, limit),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire waits for a free slot, and returns the function releasing it.
+func (l *operationLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return l.started(), nil
+	default:
+	}
+
+	metrics.AddOperationsQueued(l.operation, 1)
+	defer metrics.AddOperationsQueued(l.operation, -1)
+	klog.FromContext(ctx).V(3).Info("Waiting for concurrency limit", "operation", l.operation, "limit", cap(l.slots))
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.started(), nil
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	metrics.IncOperationsRejected(l.operation)
+	return nil, status.Errorf(codes.ResourceExhausted, "too many %s operations in progress, limit is %d", l.operation, cap(l.slots))
+}
+
+func (l *operationLimiter) started() func() {
+	metrics.AddOperationsRunning(l.operation, 1)
+	return func() {
+		metrics.AddOperationsRunning(l.operation, -1)
+		<-l.slots
+	}
+}
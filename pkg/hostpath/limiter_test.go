@@ -0,0 +1,236 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+func Test_operationLimiter(t *testing.T) {
+	RegisterTestingT(t)
+	l := newOperationLimiter("test", 2, 50*time.Millisecond)
+	Expect(metrics.GetOperationConcurrencyLimit("test")).To(BeEquivalentTo(2))
+
+	release1, err := l.acquire(context.TODO())
+	Expect(err).ToNot(HaveOccurred())
+	release2, err := l.acquire(context.TODO())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(metrics.GetOperationsRunning("test")).To(BeEquivalentTo(2))
+
+	// Over the limit, the operation is rejected once the queue timeout expires.
+	rejected := metrics.GetOperationsRejected("test")
+	_, err = l.acquire(context.TODO())
+	Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	Expect(metrics.GetOperationsRejected("test")).To(Equal(rejected + 1))
+	Expect(metrics.GetOperationsQueued("test")).To(BeEquivalentTo(0))
+
+	// A queued operation runs when a slot is released.
+	done := make(chan error)
+	go func() {
+		release, err := l.acquire(context.TODO())
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	Eventually(func() float64 {
+		return metrics.GetOperationsQueued("test")
+	}).Should(BeEquivalentTo(1))
+	release1()
+	Expect(<-done).To(Succeed())
+
+	// The context ending stops the wait too, without counting a rejection.
+	l.queueTimeout = time.Hour
+	release3, err := l.acquire(context.TODO())
+	Expect(err).ToNot(HaveOccurred())
+	rejected = metrics.GetOperationsRejected("test")
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err = l.acquire(ctx)
+	Expect(status.Code(err)).To(Equal(codes.Canceled))
+	ctx, cancel = context.WithTimeout(context.TODO(), time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx)
+	Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+	Expect(metrics.GetOperationsRejected("test")).To(Equal(rejected))
+
+	release2()
+	release3()
+	Expect(metrics.GetOperationsRunning("test")).To(BeEquivalentTo(0))
+}
+
+func Test_operationLimiterUnlimited(t *testing.T) {
+	RegisterTestingT(t)
+	l := newOperationLimiter("unlimited", 0, 0)
+	Expect(l).To(BeNil())
+	Expect(metrics.GetOperationConcurrencyLimit("unlimited")).To(BeEquivalentTo(0))
+	for i := 0; i < 10; i++ {
+		_, err := l.acquire(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+	}
+}
+
+func Test_DeleteVolumeConcurrencyLimit(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	controller := createControllerServer(tempDir)
+	controller.deleteLimiter = newOperationLimiter(deleteOperation, 1, 0)
+	Expect(os.Mkdir(filepath.Join(tempDir, validVolId), 0755)).To(Succeed())
+
+	release, err := controller.deleteLimiter.acquire(context.TODO())
+	Expect(err).ToNot(HaveOccurred())
+	_, err = controller.DeleteVolume(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: validVolId})
+	Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	Expect(filepath.Join(tempDir, validVolId)).To(BeADirectory())
+	_, err = controller.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: "snapshot"})
+	Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+
+	release()
+	_, err = controller.DeleteVolume(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: validVolId})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(filepath.Join(tempDir, validVolId)).ToNot(BeADirectory())
+}
+
+func Test_CreateSnapshotConcurrencyLimit(t *testing.T) {
+	RegisterTestingT(t)
+	controller := createControllerServer(t.TempDir())
+	controller.snapshotLimiter = newOperationLimiter(snapshotOperation, 1, 0)
+
+	release, err := controller.snapshotLimiter.acquire(context.TODO())
+	Expect(err).ToNot(HaveOccurred())
+	defer release()
+	_, err = controller.CreateSnapshot(context.TODO(), &csi.CreateSnapshotRequest{Name: "snapshot", SourceVolumeId: validVolId})
+	Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	err = controller.restoreFromSnapshot(context.TODO(), "snapshot", legacyStoragePoolName, validVolId)
+	Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+}
+
+// blockingSnapshotProvider keeps the snapshot creations and restores running
+// until unblocked.
+type blockingSnapshotProvider struct {
+	*mockSnapshotprovider
+	started chan string
+	unblock chan struct{}
+}
+
+func newBlockingSnapshotProvider() *blockingSnapshotProvider {
+	return &blockingSnapshotProvider{
+		mockSnapshotprovider: &mockSnapshotprovider{sourceVolumes: []string{validVolId}},
+		started:              make(chan string),
+		unblock:              make(chan struct{}),
+	}
+}
+
+func (b *blockingSnapshotProvider) CreateSnapshot(ctx context.Context, snapshotId, sourceVolumeId string) (*csi.Snapshot, error) {
+	snapshot, err := b.mockSnapshotprovider.CreateSnapshot(ctx, snapshotId, sourceVolumeId)
+	b.started <- snapshotId
+	<-b.unblock
+	return snapshot, err
+}
+
+func (b *blockingSnapshotProvider) RestoreSnapshot(ctx context.Context, snapshotId, targetPath string) error {
+	b.started <- snapshotId
+	<-b.unblock
+	return b.mockSnapshotprovider.RestoreSnapshot(ctx, snapshotId, targetPath)
+}
+
+func Test_DeleteSnapshotWaitsForRestore(t *testing.T) {
+	RegisterTestingT(t)
+	controller := createControllerServer(t.TempDir())
+	provider := newBlockingSnapshotProvider()
+	controller.snapshotproviders[legacyStoragePoolName] = provider
+
+	restored := make(chan error)
+	go func() {
+		restored <- controller.restoreFromSnapshot(context.TODO(), validSnapshotName, legacyStoragePoolName, "testname-fromsnap")
+	}()
+	Eventually(provider.started).Should(Receive(Equal(validSnapshotName)))
+
+	deleted := make(chan error)
+	go func() {
+		_, err := controller.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: validSnapshotName})
+		deleted <- err
+	}()
+	Consistently(deleted, 100*time.Millisecond).ShouldNot(Receive())
+
+	close(provider.unblock)
+	Eventually(restored).Should(Receive(BeNil()))
+	Eventually(deleted).Should(Receive(BeNil()))
+}
+
+func Test_QueuedDeleteSnapshotDoesNotBlockSnapshots(t *testing.T) {
+	RegisterTestingT(t)
+	controller := createControllerServer(t.TempDir())
+	controller.deleteLimiter = newOperationLimiter(deleteOperation, 1, time.Hour)
+	Expect(controller.snapshotproviders[legacyStoragePoolName].Initialize(context.TODO())).To(Succeed())
+
+	// Keep a delete waiting for the delete limiter.
+	release, err := controller.deleteLimiter.acquire(context.TODO())
+	Expect(err).ToNot(HaveOccurred())
+	deleted := make(chan error)
+	go func() {
+		_, err := controller.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: validSnapshotName})
+		deleted <- err
+	}()
+	Eventually(func() float64 {
+		return metrics.GetOperationsQueued(deleteOperation)
+	}).Should(BeEquivalentTo(1))
+
+	_, err = controller.CreateSnapshot(context.TODO(), &csi.CreateSnapshotRequest{Name: "other", SourceVolumeId: validVolId})
+	Expect(err).ToNot(HaveOccurred())
+	_, err = controller.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(controller.restoreFromSnapshot(context.TODO(), "other", legacyStoragePoolName, "testname-fromsnap")).To(Succeed())
+	Consistently(deleted).ShouldNot(Receive())
+
+	release()
+	Eventually(deleted).Should(Receive(BeNil()))
+}
+
+func Test_ListSnapshotsSkipsSnapshotsBeingCreated(t *testing.T) {
+	RegisterTestingT(t)
+	controller := createControllerServer(t.TempDir())
+	provider := newBlockingSnapshotProvider()
+	controller.snapshotproviders[legacyStoragePoolName] = provider
+
+	created := make(chan error)
+	go func() {
+		_, err := controller.CreateSnapshot(context.TODO(), &csi.CreateSnapshotRequest{Name: validSnapshotName, SourceVolumeId: validVolId})
+		created <- err
+	}()
+	Eventually(provider.started).Should(Receive(Equal(validSnapshotName)))
+	res, err := controller.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(res.GetEntries()).To(BeEmpty())
+
+	close(provider.unblock)
+	Eventually(created).Should(Receive(BeNil()))
+	res, err = controller.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(res.GetEntries()).To(HaveLen(1))
+}
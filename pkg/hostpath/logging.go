@@ -0,0 +1,56 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// LogFormatText is the default klog text format
+	LogFormatText = "text"
+	// LogFormatJSON writes one JSON object per log entry
+	LogFormatJSON = "json"
+)
+
+// SetLogFormat configures the format klog writes the logs in. verbosity is the
+// klog -v level, which also applies to the JSON output.
+func SetLogFormat(format string, verbosity int) error {
+	switch format {
+	case LogFormatText:
+		return nil
+	case LogFormatJSON:
+		klog.SetLogger(newJSONLogger(os.Stderr, verbosity))
+		return nil
+	default:
+		return fmt.Errorf("unsupported log format %q, must be %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// newJSONLogger returns a logger writing JSON to w, V(n) entries are written
+// when n is at most verbosity.
+func newJSONLogger(w io.Writer, verbosity int) logr.Logger {
+	return logr.FromSlogHandler(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: slog.Level(-verbosity),
+	}))
+}
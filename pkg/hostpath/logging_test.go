@@ -0,0 +1,48 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_newJSONLogger(t *testing.T) {
+	RegisterTestingT(t)
+	buf := &bytes.Buffer{}
+	logger := newJSONLogger(buf, 3).WithValues("requestID", "1234")
+	logger.V(3).Info("Create volume request", "volumeID", "pvc-1")
+	logger.V(4).Info("Not logged")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	Expect(lines).To(HaveLen(1))
+	entry := map[string]interface{}{}
+	Expect(json.Unmarshal([]byte(lines[0]), &entry)).To(Succeed())
+	Expect(entry).To(HaveKeyWithValue("msg", "Create volume request"))
+	Expect(entry).To(HaveKeyWithValue("requestID", "1234"))
+	Expect(entry).To(HaveKeyWithValue("volumeID", "pvc-1"))
+}
+
+func Test_SetLogFormat(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(SetLogFormat(LogFormatText, 0)).To(Succeed())
+	Expect(SetLogFormat("xml", 0)).To(MatchError(ContainSubstring("unsupported log format")))
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package hostpath
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Cache sizes and TTLs match the defaults of the delegated authentication
+	// and authorization of the kubernetes API servers.
+	authCacheSize       = 1024
+	authAllowedTTL      = 2 * time.Minute
+	authUnauthorizedTTL = 30 * time.Second
+)
+
+// metricsAuth authenticates requests to the metrics server with a TokenReview of
+// their bearer token, and authorizes them with a SubjectAccessReview for the
+// request path and method as a non-resource URL.
+type metricsAuth struct {
+	client kubernetes.Interface
+	cache  *cache.LRUExpireCache
+}
+
+func newMetricsAuth(client kubernetes.Interface) *metricsAuth {
+	return &metricsAuth{
+		client: client,
+		cache:  cache.NewLRUExpireCache(authCacheSize),
+	}
+}
+
+// withAuth wraps the handler, so only authorized requests reach it.
+func (a *metricsAuth) withAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		verb := strings.ToLower(r.Method)
+		key := cacheKey(token, verb, r.URL.Path)
+		var status int
+		if cached, ok := a.cache.Get(key); ok {
+			status = cached.(int)
+		} else {
+			var err error
+			status, err = a.authorize(r, token, verb)
+			if err != nil {
+				klog.Errorf("Failed to authorize metrics request: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			ttl := authAllowedTTL
+			if status != http.StatusOK {
+				ttl = authUnauthorizedTTL
+			}
+			a.cache.Add(key, status, ttl)
+		}
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authorize returns the HTTP status for the request, StatusOK if it is allowed.
+func (a *metricsAuth) authorize(r *http.Request, token, verb string) (int, error) {
+	tr, err := a.client.AuthenticationV1().TokenReviews().Create(r.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if !tr.Status.Authenticated {
+		klog.V(3).Infof("Metrics request with invalid token: %s", tr.Status.Error)
+		return http.StatusUnauthorized, nil
+	}
+
+	user := tr.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(r.Context(), &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: r.URL.Path,
+				Verb: verb,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if !sar.Status.Allowed {
+		klog.V(3).Infof("Metrics request of %s to %s denied: %s", user.Username, r.URL.Path, sar.Status.Reason)
+		return http.StatusForbidden, nil
+	}
+	return http.StatusOK, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return "", false
+	}
+	token := strings.TrimSpace(parts[1])
+	return token, token != ""
+}
+
+// cacheKey doesn't keep the token itself in memory.
+func cacheKey(token, verb, path string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:]) + "/" + verb + path
+}
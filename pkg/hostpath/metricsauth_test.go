@@ -0,0 +1,188 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	allowedToken = "allowed-token"
+	deniedToken  = "denied-token"
+	invalidToken = "invalid-token"
+	errorToken   = "error-token"
+)
+
+func newFakeAuthClient() (*fake.Clientset, *int, *int) {
+	client := fake.NewClientset()
+	tokenReviews, accessReviews := 0, 0
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenReviews++
+		tr := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch tr.Spec.Token {
+		case allowedToken, deniedToken:
+			tr.Status.Authenticated = true
+			tr.Status.User = authenticationv1.UserInfo{
+				Username: tr.Spec.Token,
+				Groups:   []string{"system:authenticated"},
+				Extra:    map[string]authenticationv1.ExtraValue{"scopes": {"metrics"}},
+			}
+		case errorToken:
+			return true, nil, errors.New("api server unavailable")
+		default:
+			tr.Status.Authenticated = false
+		}
+		return true, tr, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		accessReviews++
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		Expect(sar.Spec.NonResourceAttributes).ToNot(BeNil())
+		Expect(sar.Spec.Groups).To(ConsistOf("system:authenticated"))
+		Expect(sar.Spec.Extra).To(HaveKeyWithValue("scopes", authorizationv1.ExtraValue{"metrics"}))
+		sar.Status.Allowed = sar.Spec.User == allowedToken &&
+			sar.Spec.NonResourceAttributes.Path == "/metrics" &&
+			sar.Spec.NonResourceAttributes.Verb == "get"
+		return true, sar, nil
+	})
+	return client, &tokenReviews, &accessReviews
+}
+
+func Test_metricsAuth(t *testing.T) {
+	RegisterTestingT(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(auth *metricsAuth, method, path, header string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		auth.withAuth(handler).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "allowed token",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			header:     "Bearer " + allowedToken,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "lower case bearer",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			header:     "bearer " + allowedToken,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no token",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "basic auth",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			header:     "Basic dXNlcjpwYXNz",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid token",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			header:     "Bearer " + invalidToken,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "denied token",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			header:     "Bearer " + deniedToken,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "allowed token other verb",
+			method:     http.MethodPost,
+			path:       "/metrics",
+			header:     "Bearer " + allowedToken,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "allowed token other path",
+			method:     http.MethodGet,
+			path:       "/other",
+			header:     "Bearer " + allowedToken,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "review error",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			header:     "Bearer " + errorToken,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _, _ := newFakeAuthClient()
+			Expect(serve(newMetricsAuth(client), tt.method, tt.path, tt.header)).To(Equal(tt.wantStatus))
+		})
+	}
+
+	t.Run("results are cached", func(t *testing.T) {
+		client, tokenReviews, accessReviews := newFakeAuthClient()
+		auth := newMetricsAuth(client)
+		for i := 0; i < 3; i++ {
+			Expect(serve(auth, http.MethodGet, "/metrics", "Bearer "+allowedToken)).To(Equal(http.StatusOK))
+			Expect(serve(auth, http.MethodGet, "/metrics", "Bearer "+deniedToken)).To(Equal(http.StatusForbidden))
+			Expect(serve(auth, http.MethodGet, "/metrics", "Bearer "+invalidToken)).To(Equal(http.StatusUnauthorized))
+		}
+		Expect(*tokenReviews).To(Equal(3))
+		Expect(*accessReviews).To(Equal(2))
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		client, tokenReviews, _ := newFakeAuthClient()
+		auth := newMetricsAuth(client)
+		for i := 0; i < 2; i++ {
+			Expect(serve(auth, http.MethodGet, "/metrics", "Bearer "+errorToken)).To(Equal(http.StatusInternalServerError))
+		}
+		Expect(*tokenReviews).To(Equal(2))
+	})
+}
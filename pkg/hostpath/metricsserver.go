@@ -0,0 +1,350 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package hostpath
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+const defaultMetricsPath = "/metrics"
+
+// selfSignedCertRenewBefore is how long before it expires the self-signed
+// certificate of the metrics server is generated again.
+var selfSignedCertRenewBefore = 30 * 24 * time.Hour
+
+// MetricsServerConfig is the configuration of the prometheus metrics server.
+type MetricsServerConfig struct {
+	// Address the server listens on, in host:port form.
+	Address string
+	// Path the metrics are served on, defaults to /metrics.
+	Path string
+	// InsecureAddress is an optional loopback address, in host:port form, on
+	// which the metrics are served over plain HTTP without authentication for
+	// sidecars in the same pod.
+	InsecureAddress string
+	// EnablePprof serves the /debug/pprof handlers next to the metrics, behind
+	// the same authentication and authorization. It requires AuthClient or
+	// ClientCAFile, so the profiles are never served to anyone.
+	EnablePprof bool
+	// CertFile and KeyFile are the serving certificate and key. They are reloaded
+	// when they change on disk. When not set, a self-signed certificate is generated,
+	// and generated again before it expires.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS, clients have to present a certificate
+	// signed by one of the CAs in this file. It is read again when it changes.
+	ClientCAFile string
+	// TLSVersion should be "VersionTLS10", "VersionTLS11", "VersionTLS12", or "VersionTLS13" (default: "VersionTLS13").
+	TLSVersion string
+	// CipherSuites are the names of the allowed cipher suites, the crypto/tls
+	// defaults are used when empty. Not configurable for TLS 1.3.
+	CipherSuites []string
+	// AuthClient enables authentication and authorization of the requests
+	// with TokenReviews and SubjectAccessReviews when set.
+	AuthClient kubernetes.Interface
+}
+
+// PrometheusServer serves the metrics until it is stopped.
+type PrometheusServer struct {
+	servers []*http.Server
+}
+
+// RunPrometheusServer runs a prometheus server for metrics with TLS support.
+// If a certificate and key file are provided, they will be used for TLS and
+// reloaded until the context is cancelled.
+// Otherwise, a self-signed certificate will be generated automatically.
+func RunPrometheusServer(ctx context.Context, cfg MetricsServerConfig) (*PrometheusServer, error) {
+	err := metrics.SetupMetrics()
+	if err != nil {
+		klog.Error(err, "Failed to Setup Prometheus metrics")
+	}
+	if cfg.Path == "" {
+		cfg.Path = defaultMetricsPath
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return nil, fmt.Errorf("metrics path %q must start with /", cfg.Path)
+	}
+	if cfg.EnablePprof && cfg.AuthClient == nil && cfg.ClientCAFile == "" {
+		return nil, errors.New("pprof handlers require authentication or a client CA file for the metrics server")
+	}
+	if cfg.InsecureAddress != "" {
+		if err := validateLoopbackAddress(cfg.InsecureAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := newMetricsTLSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := func(handler http.Handler) http.Handler {
+		return handler
+	}
+	if cfg.AuthClient != nil {
+		klog.V(1).Info("Enabling authentication and authorization of metrics requests")
+		filter = newMetricsAuth(cfg.AuthClient).withAuth
+	}
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, filter(promhttp.Handler()))
+	if cfg.EnablePprof {
+		klog.V(1).Info("Enabling pprof handlers on the metrics server")
+		mux.Handle("/debug/pprof/", filter(http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", filter(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", filter(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", filter(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", filter(http.HandlerFunc(pprof.Trace)))
+	}
+
+	ps := &PrometheusServer{}
+	listener, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics address %s: %w", cfg.Address, err)
+	}
+	server := &http.Server{
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+	ps.servers = append(ps.servers, server)
+	// The certificates are provided by the TLSConfig
+	go ps.serve(server, listener, true)
+	klog.V(1).Infof("Serving metrics on https://%s%s", listener.Addr(), cfg.Path)
+
+	if cfg.InsecureAddress != "" {
+		insecureListener, err := net.Listen("tcp", cfg.InsecureAddress)
+		if err != nil {
+			ps.Stop(0)
+			return nil, fmt.Errorf("failed to listen on insecure metrics address %s: %w", cfg.InsecureAddress, err)
+		}
+		insecureMux := http.NewServeMux()
+		insecureMux.Handle(cfg.Path, promhttp.Handler())
+		insecureServer := &http.Server{
+			Handler: insecureMux,
+		}
+		ps.servers = append(ps.servers, insecureServer)
+		go ps.serve(insecureServer, insecureListener, false)
+		klog.V(1).Infof("Serving metrics on http://%s%s", insecureListener.Addr(), cfg.Path)
+	}
+	return ps, nil
+}
+
+func (ps *PrometheusServer) serve(server *http.Server, listener net.Listener, secure bool) {
+	var err error
+	if secure {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		klog.Error(err, "Failed to run Prometheus metrics endpoint server")
+	}
+}
+
+// Stop stops the prometheus server, waiting up to timeout for the scrapes in
+// progress to complete.
+func (ps *PrometheusServer) Stop(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, server := range ps.servers {
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Error(err, "Failed to stop Prometheus metrics endpoint server")
+		}
+	}
+}
+
+// validateLoopbackAddress makes sure the address only accepts connections from the node itself.
+func validateLoopbackAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid insecure metrics address %q: %w", address, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("insecure metrics address %q must be a loopback address", address)
+}
+
+func newMetricsTLSConfig(ctx context.Context, cfg MetricsServerConfig) (*tls.Config, error) {
+	// Validate certificate configuration
+	certProvided := cfg.CertFile != ""
+	keyProvided := cfg.KeyFile != ""
+	if certProvided != keyProvided {
+		klog.Warningf("Partial TLS certificate configuration: cert=%q, key=%q. Both --metrics-cert-file and --metrics-key-file must be provided together. Falling back to self-signed certificate.", cfg.CertFile, cfg.KeyFile)
+	}
+
+	// Parse TLS version (maps string name to crypto/tls MinVersion constant)
+	minTLSVersion := getTLSVersion(cfg.TLSVersion)
+	if minTLSVersion == nil {
+		klog.Warningf("Invalid TLS version '%s', defaulting to TLS 1.3", cfg.TLSVersion)
+		defaultVersion := uint16(tls.VersionTLS13)
+		minTLSVersion = &defaultVersion
+	}
+
+	cipherSuites, err := getCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure TLS
+	tlsConfig := &tls.Config{
+		MinVersion:   *minTLSVersion,
+		CipherSuites: cipherSuites,
+	}
+
+	// If cert and key files are provided, use them and pick up rotations
+	if certProvided && keyProvided {
+		klog.V(1).Infof("Using provided certificates for metrics server: cert=%s, key=%s", cfg.CertFile, cfg.KeyFile)
+		watcher, err := certwatcher.New(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load metrics server certificate: %w", err)
+		}
+		go func() {
+			if err := watcher.Start(ctx); err != nil {
+				klog.Error(err, "Failed to watch metrics server certificate")
+			}
+		}()
+		tlsConfig.GetCertificate = watcher.GetCertificate
+	} else {
+		// Generate self-signed certificate
+		klog.V(1).Info("Generating self-signed certificate for metrics server")
+		cert, err := newSelfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetCertificate = cert.getCertificate
+	}
+
+	if cfg.ClientCAFile != "" {
+		clientCAs, err := newClientCAPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = clientCAs.pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		// Verify the clients with the CAs currently in the file
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := tlsConfig.Clone()
+			config.ClientCAs = clientCAs.get()
+			return config, nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// selfSignedCertificate is a self-signed certificate that is generated again
+// before it expires.
+type selfSignedCertificate struct {
+	mutex sync.Mutex
+	cert  *tls.Certificate
+}
+
+func newSelfSignedCertificate() (*selfSignedCertificate, error) {
+	cert, err := generateSelfSignedCert()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate self-signed certificate for metrics server: %w", err)
+	}
+	return &selfSignedCertificate{cert: &cert}, nil
+}
+
+func (c *selfSignedCertificate) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Now().After(c.cert.Leaf.NotAfter.Add(-selfSignedCertRenewBefore)) {
+		klog.V(1).Info("Renewing self-signed certificate for metrics server", "notAfter", c.cert.Leaf.NotAfter)
+		cert, err := generateSelfSignedCert()
+		if err != nil {
+			// Keep serving the current certificate, and try again on the next connection
+			klog.Error(err, "Failed to renew self-signed certificate for metrics server")
+		} else {
+			c.cert = &cert
+		}
+	}
+	return c.cert, nil
+}
+
+// clientCAPool holds the CAs of a client CA file, the file is read again when
+// it changes.
+type clientCAPool struct {
+	file    string
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	pool    *x509.CertPool
+}
+
+func newClientCAPool(file string) (*clientCAPool, error) {
+	c := &clientCAPool{file: file}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// get returns the CAs in the file, or the last ones that could be read when
+// the file is missing or invalid.
+func (c *clientCAPool) get() *x509.CertPool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.load(); err != nil {
+		klog.Error(err, "Failed to reload metrics client CA file, using the previous CAs")
+	}
+	return c.pool
+}
+
+func (c *clientCAPool) load() error {
+	info, err := os.Stat(c.file)
+	if err != nil {
+		return fmt.Errorf("failed to read metrics client CA file: %w", err)
+	}
+	if c.pool != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return nil
+	}
+	caPEM, err := os.ReadFile(c.file)
+	if err != nil {
+		return fmt.Errorf("failed to read metrics client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in metrics client CA file %s", c.file)
+	}
+	if c.pool != nil {
+		klog.V(1).Infof("Reloaded metrics client CA file %s", c.file)
+	}
+	c.pool, c.modTime, c.size = pool, info.ModTime(), info.Size()
+	return nil
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_newMetricsTLSConfig(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	certFile := filepath.Join(tempDir, "tls.crt")
+	keyFile := filepath.Join(tempDir, "tls.key")
+	ca, caPEM := newTestCA(t)
+	writeCert := func() *x509.Certificate {
+		cert, key := newTestCert(t, ca, x509.ExtKeyUsageServerAuth)
+		// Replace the files the way kubelet updates secret volumes
+		Expect(os.WriteFile(keyFile+".new", key, 0600)).To(Succeed())
+		Expect(os.WriteFile(certFile+".new", cert, 0600)).To(Succeed())
+		Expect(os.Rename(keyFile+".new", keyFile)).To(Succeed())
+		Expect(os.Rename(certFile+".new", certFile)).To(Succeed())
+		pair, err := tls.X509KeyPair(cert, key)
+		Expect(err).ToNot(HaveOccurred())
+		return pair.Leaf
+	}
+
+	t.Run("certificate is reloaded", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		first := writeCert()
+		tlsConfig, err := newMetricsTLSConfig(ctx, MetricsServerConfig{CertFile: certFile, KeyFile: keyFile, TLSVersion: "VersionTLS12"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tlsConfig.MinVersion).To(BeEquivalentTo(tls.VersionTLS12))
+		Expect(tlsConfig.ClientAuth).To(Equal(tls.NoClientCert))
+		cert, err := tlsConfig.GetCertificate(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.Leaf.SerialNumber).To(Equal(first.SerialNumber))
+
+		second := writeCert()
+		Eventually(func() []byte {
+			cert, err := tlsConfig.GetCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+			return cert.Certificate[0]
+		}, 15*time.Second).Should(Equal(second.Raw))
+	})
+
+	t.Run("client CA", func(t *testing.T) {
+		caFile := filepath.Join(tempDir, "ca.crt")
+		Expect(os.WriteFile(caFile, caPEM, 0600)).To(Succeed())
+		tlsConfig, err := newMetricsTLSConfig(context.Background(), MetricsServerConfig{ClientCAFile: caFile})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tlsConfig.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+		Expect(tlsConfig.ClientCAs).ToNot(BeNil())
+
+		verifyClient := func(pool *x509.CertPool, ca *tls.Certificate) error {
+			cert, key := newTestCert(t, ca, x509.ExtKeyUsageClientAuth)
+			pair, err := tls.X509KeyPair(cert, key)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = pair.Leaf.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+			return err
+		}
+		config, err := tlsConfig.GetConfigForClient(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+		Expect(verifyClient(config.ClientCAs, ca)).To(Succeed())
+
+		newCA, newCAPEM := newTestCA(t)
+		Expect(os.WriteFile(caFile, newCAPEM, 0600)).To(Succeed())
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(caFile, later, later)).To(Succeed())
+		config, err = tlsConfig.GetConfigForClient(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(verifyClient(config.ClientCAs, newCA)).To(Succeed())
+		Expect(verifyClient(config.ClientCAs, ca)).ToNot(Succeed())
+
+		// The previous CAs are used while the file is invalid
+		Expect(os.WriteFile(caFile, []byte("invalid"), 0600)).To(Succeed())
+		config, err = tlsConfig.GetConfigForClient(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(verifyClient(config.ClientCAs, newCA)).To(Succeed())
+	})
+
+	t.Run("self-signed certificate is renewed", func(t *testing.T) {
+		oldRenewBefore := selfSignedCertRenewBefore
+		defer func() {
+			selfSignedCertRenewBefore = oldRenewBefore
+		}()
+		tlsConfig, err := newMetricsTLSConfig(context.Background(), MetricsServerConfig{})
+		Expect(err).ToNot(HaveOccurred())
+		first, err := tlsConfig.GetCertificate(nil)
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := tlsConfig.GetCertificate(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.Leaf.SerialNumber).To(Equal(first.Leaf.SerialNumber))
+
+		// Expiring within the renewal period
+		selfSignedCertRenewBefore = time.Until(first.Leaf.NotAfter) + time.Hour
+		cert, err = tlsConfig.GetCertificate(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.Leaf.SerialNumber).ToNot(Equal(first.Leaf.SerialNumber))
+	})
+
+	t.Run("invalid client CA", func(t *testing.T) {
+		_, err := newMetricsTLSConfig(context.Background(), MetricsServerConfig{ClientCAFile: filepath.Join(tempDir, "missing.crt")})
+		Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("cipher suites", func(t *testing.T) {
+		tlsConfig, err := newMetricsTLSConfig(context.Background(), MetricsServerConfig{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tlsConfig.CipherSuites).To(Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}))
+
+		_, err = newMetricsTLSConfig(context.Background(), MetricsServerConfig{CipherSuites: []string{"invalid"}})
+		Expect(err).To(HaveOccurred())
+	})
+}
+
+func Test_RunPrometheusServerMutualTLS(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	ca, caPEM := newTestCA(t)
+	serverCert, serverKey := newTestCert(t, ca, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := newTestCert(t, ca, x509.ExtKeyUsageClientAuth)
+	Expect(os.WriteFile(filepath.Join(tempDir, "tls.crt"), serverCert, 0600)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(tempDir, "tls.key"), serverKey, 0600)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(tempDir, "ca.crt"), caPEM, 0600)).To(Succeed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := fmt.Sprintf("127.0.0.1:%d", getFreePort(t))
+	server, err := RunPrometheusServer(ctx, MetricsServerConfig{
+		Address:      addr,
+		CertFile:     filepath.Join(tempDir, "tls.crt"),
+		KeyFile:      filepath.Join(tempDir, "tls.key"),
+		ClientCAFile: filepath.Join(tempDir, "ca.crt"),
+		TLSVersion:   "VersionTLS13",
+	})
+	Expect(err).ToNot(HaveOccurred())
+	defer server.Stop(time.Second)
+
+	rootCAs := x509.NewCertPool()
+	Expect(rootCAs.AppendCertsFromPEM(caPEM)).To(BeTrue())
+	scrape := func(certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certs,
+		}}}
+		return client.Get("https://" + addr + "/metrics")
+	}
+
+	cert, err := tls.X509KeyPair(clientCert, clientKey)
+	Expect(err).ToNot(HaveOccurred())
+	Eventually(func() (int, error) {
+		resp, err := scrape(cert)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}).Should(Equal(http.StatusOK))
+
+	_, err = scrape()
+	Expect(err).To(HaveOccurred())
+}
+
+func Test_RunPrometheusServerPathInsecureAndPprof(t *testing.T) {
+	RegisterTestingT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := fmt.Sprintf("127.0.0.1:%d", getFreePort(t))
+	insecureAddr := fmt.Sprintf("127.0.0.1:%d", getFreePort(t))
+	authClient, _, _ := newFakeAuthClient()
+	server, err := RunPrometheusServer(ctx, MetricsServerConfig{
+		Address:         addr,
+		InsecureAddress: insecureAddr,
+		EnablePprof:     true,
+		AuthClient:      authClient,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	defer server.Stop(time.Second)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		// The server uses a self-signed certificate
+		InsecureSkipVerify: true, //nolint:gosec
+	}}}
+	get := func(url, token string) (int, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return 0, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	Expect(get("https://"+addr+"/metrics", allowedToken)).To(Equal(http.StatusOK))
+	// pprof is behind the same authentication and authorization
+	Expect(get("https://"+addr+"/debug/pprof/", "")).To(Equal(http.StatusUnauthorized))
+	Expect(get("https://"+addr+"/debug/pprof/", allowedToken)).To(Equal(http.StatusForbidden))
+	Expect(get("http://"+insecureAddr+"/metrics", "")).To(Equal(http.StatusOK))
+	// pprof is not exposed on the insecure address
+	Expect(get("http://"+insecureAddr+"/debug/pprof/", "")).To(Equal(http.StatusNotFound))
+
+	// pprof is not served without authentication
+	_, err = RunPrometheusServer(ctx, MetricsServerConfig{Address: "127.0.0.1:0", EnablePprof: true})
+	Expect(err).To(MatchError(ContainSubstring("pprof handlers require authentication")))
+}
+
+func Test_RunPrometheusServerCustomPath(t *testing.T) {
+	RegisterTestingT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := fmt.Sprintf("127.0.0.1:%d", getFreePort(t))
+	insecureAddr := fmt.Sprintf("127.0.0.1:%d", getFreePort(t))
+	server, err := RunPrometheusServer(ctx, MetricsServerConfig{
+		Address:         addr,
+		Path:            "/custom-metrics",
+		InsecureAddress: insecureAddr,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	defer server.Stop(time.Second)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		// The server uses a self-signed certificate
+		InsecureSkipVerify: true, //nolint:gosec
+	}}}
+	get := func(url string) (int, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	Expect(get("https://" + addr + "/custom-metrics")).To(Equal(http.StatusOK))
+	Expect(get("https://" + addr + "/metrics")).To(Equal(http.StatusNotFound))
+	Expect(get("https://" + addr + "/debug/pprof/")).To(Equal(http.StatusNotFound))
+	Expect(get("http://" + insecureAddr + "/custom-metrics")).To(Equal(http.StatusOK))
+}
+
+func Test_RunPrometheusServerErrors(t *testing.T) {
+	RegisterTestingT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := RunPrometheusServer(ctx, MetricsServerConfig{Address: "127.0.0.1:0", Path: "metrics"})
+	Expect(err).To(MatchError(ContainSubstring("must start with /")))
+	_, err = RunPrometheusServer(ctx, MetricsServerConfig{Address: "127.0.0.1:0", InsecureAddress: ":8080"})
+	Expect(err).To(MatchError(ContainSubstring("must be a loopback address")))
+
+	// Port conflicts are reported instead of only logged
+	addr := fmt.Sprintf("127.0.0.1:%d", getFreePort(t))
+	server, err := RunPrometheusServer(ctx, MetricsServerConfig{Address: addr})
+	Expect(err).ToNot(HaveOccurred())
+	defer server.Stop(time.Second)
+	_, err = RunPrometheusServer(ctx, MetricsServerConfig{Address: addr})
+	Expect(err).To(MatchError(ContainSubstring("failed to listen on metrics address")))
+}
+
+func Test_validateLoopbackAddress(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(validateLoopbackAddress("127.0.0.1:8080")).To(Succeed())
+	Expect(validateLoopbackAddress("[::1]:8080")).To(Succeed())
+	Expect(validateLoopbackAddress("localhost:8080")).To(Succeed())
+	Expect(validateLoopbackAddress("0.0.0.0:8080")).ToNot(Succeed())
+	Expect(validateLoopbackAddress("10.0.0.1:8080")).ToNot(Succeed())
+	Expect(validateLoopbackAddress("127.0.0.1")).ToNot(Succeed())
+}
@@ -23,8 +23,11 @@ import (
 	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/mount"
 )
@@ -32,6 +35,13 @@ import (
 const (
 	TopologyKeyNode     = "topology.hostpath.csi/node"
 	ephemeralContextKey = "csi.storage.k8s.io/ephemeral"
+	// The pod publishing the volume, in the volume context of drivers with
+	// podInfoOnMount.
+	podNameContextKey      = "csi.storage.k8s.io/pod.name"
+	podNamespaceContextKey = "csi.storage.k8s.io/pod.namespace"
+	podUIDContextKey       = "csi.storage.k8s.io/pod.uid"
+
+	ioLimitsNotAppliedReason = "IOLimitsNotApplied"
 )
 
 type hostPathNode struct {
@@ -79,8 +89,9 @@ func (hpn *hostPathNode) validateNodePublishRequest(req *csi.NodePublishVolumeRe
 }
 
 func (hpn *hostPathNode) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
 	if req != nil {
-		klog.V(3).Infof("Node Publish Request: %+v", req)
+		logger.V(3).Info("Node publish request", "request", protosanitizer.StripSecrets(req))
 	}
 	if err := hpn.validateNodePublishRequest(req); err != nil {
 		return nil, err
@@ -88,20 +99,74 @@ func (hpn *hostPathNode) NodePublishVolume(ctx context.Context, req *csi.NodePub
 
 	targetPath := req.GetTargetPath()
 
+	// Limit the I/O before checking the mount, so a retried publish applies
+	// the limits as well.
+	if err := hpn.limitVolumeIO(ctx, req); err != nil {
+		return nil, err
+	}
+
 	if canMnt, err := hpn.canMountVolume(targetPath); err != nil {
 		return nil, err
 	} else if !canMnt {
-		klog.V(3).Infof("Cannot mount to target path: %s", targetPath)
+		logger.V(3).Info("Target path is already mounted", "targetPath", targetPath)
 		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
-	if err := hpn.mountVolume(targetPath, req); err != nil {
+	if err := hpn.mountVolume(ctx, targetPath, req); err != nil {
 		return nil, err
 	}
 
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// limitVolumeIO applies the I/O limits of the storage class, overridden by the
+// ones persisted for the volume, to the pod publishing it.
+func (hpn *hostPathNode) limitVolumeIO(ctx context.Context, req *csi.NodePublishVolumeRequest) error {
+	storagePoolName := getStoragePoolNameFromMap(req.GetVolumeContext())
+	limits := volumeIOLimits(req.GetVolumeContext())
+	poolPath := hpn.cfg.StoragePoolInfo[storagePoolName].Path
+	if isEphemeralVolumeRequest(req) {
+		poolPath = hpn.getEphemeralStoragePoolPath(storagePoolName)
+	} else if poolPath != "" {
+		attributes, err := readVolumeAttributes(poolPath, req.GetVolumeId())
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read attributes of volume %s: %v", req.GetVolumeId(), err)
+		}
+		for key, value := range volumeIOLimits(attributes) {
+			limits[key] = value
+		}
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+	if err := validateMutableParameters(limits); err != nil {
+		return err
+	}
+	// The node may not support the limits, like with cgroup v1, which must
+	// not keep the pod from starting.
+	if err := applyIOLimits(ctx, hpn.cfg.StoragePoolInfo, poolPath, req.GetTargetPath(), limits); err != nil {
+		klog.Warningf("Unable to limit I/O of volume %s, publishing it without limits: %v", req.GetVolumeId(), err)
+		hpn.recordPodEvent(req.GetVolumeContext(), corev1.EventTypeWarning, ioLimitsNotAppliedReason,
+			fmt.Sprintf("Volume %s is published without its I/O limits: %v", req.GetVolumeId(), err))
+	}
+	return nil
+}
+
+// recordPodEvent records an event on the pod publishing a volume, known from
+// the pod information in the volume context of drivers with podInfoOnMount.
+func (hpn *hostPathNode) recordPodEvent(volumeContext map[string]string, eventType, reason, message string) {
+	if hpn.cfg.EventRecorder == nil || volumeContext[podNameContextKey] == "" {
+		return
+	}
+	pod := &corev1.ObjectReference{
+		Kind:      "Pod",
+		Name:      volumeContext[podNameContextKey],
+		Namespace: volumeContext[podNamespaceContextKey],
+		UID:       types.UID(volumeContext[podUIDContextKey]),
+	}
+	hpn.cfg.EventRecorder.Event(pod, eventType, reason, message)
+}
+
 func (hpn *hostPathNode) canMountVolume(targetPath string) (bool, error) {
 	notMnt, err := mount.IsNotMountPoint(hpn.cfg.Mounter, targetPath)
 	if err != nil {
@@ -118,7 +183,7 @@ func (hpn *hostPathNode) canMountVolume(targetPath string) (bool, error) {
 	return notMnt, nil
 }
 
-func (hpn *hostPathNode) mountVolume(targetPath string, req *csi.NodePublishVolumeRequest) error {
+func (hpn *hostPathNode) mountVolume(ctx context.Context, targetPath string, req *csi.NodePublishVolumeRequest) error {
 	fsType := req.GetVolumeCapability().GetMount().GetFsType()
 
 	deviceId := ""
@@ -129,8 +194,8 @@ func (hpn *hostPathNode) mountVolume(targetPath string, req *csi.NodePublishVolu
 	readOnly := req.GetReadonly()
 	volumeId := req.GetVolumeId()
 
-	klog.V(4).Infof("target %v\nfstype %v\ndevice %v\nreadonly %v\nvolumeId %v\nattributes %v\nmountflags %v\n",
-		targetPath, fsType, deviceId, readOnly, volumeId, req.GetVolumeContext(), req.GetVolumeCapability().GetMount().GetMountFlags())
+	klog.FromContext(ctx).V(4).Info("Mounting volume", "targetPath", targetPath, "fsType", fsType, "device", deviceId, "readOnly", readOnly,
+		"attributes", req.GetVolumeContext(), "mountFlags", req.GetVolumeCapability().GetMount().GetMountFlags())
 
 	options := []string{"bind"}
 	if readOnly {
@@ -139,26 +204,34 @@ func (hpn *hostPathNode) mountVolume(targetPath string, req *csi.NodePublishVolu
 	storagePoolName := getStoragePoolNameFromMap(req.GetVolumeContext())
 
 	mounter := hpn.cfg.Mounter
-	path := ""
+	poolPath := hpn.cfg.StoragePoolInfo[storagePoolName].Path
 	if isEphemeralVolumeRequest(req) {
-		path = hpn.getEphemeralVolumePath(storagePoolName, volumeId)
-		if err := CreateVolumeDirectory(filepath.Dir(path), volumeId); err != nil {
+		poolPath = hpn.getEphemeralStoragePoolPath(storagePoolName)
+		if err := CreateVolumeDirectory(ctx, poolPath, volumeId); err != nil {
 			return fmt.Errorf("failed to create ephemeral volume %v: %w", volumeId, err)
 		}
-	} else {
-		path = filepath.Join(hpn.cfg.StoragePoolInfo[storagePoolName].Path, volumeId)
 	}
+	// Mount the opened directory rather than its path, so the volume cannot
+	// be swapped for a symlink out of the storage pool once checked.
+	volume, err := openBeneath(poolPath, volumeId)
+	if os.IsNotExist(err) {
+		return status.Errorf(codes.NotFound, "volume %s not found", volumeId)
+	} else if err != nil {
+		return err
+	}
+	defer volume.Close()
+	path := volume.Name()
 
-	if err := mounter.Mount(path, targetPath, fsType, options); err != nil {
+	if err := mounter.Mount(procFdPath(volume), targetPath, fsType, options); err != nil {
 		var errList strings.Builder
 		errList.WriteString(err.Error())
-		fileInfo, err := os.Stat(targetPath)
-		if err != nil {
-			errList.WriteString(err.Error())
+		if fileInfo, err := os.Stat(targetPath); err != nil {
+			errList.WriteString(fmt.Sprintf(" :%s", err.Error()))
+		} else {
+			errList.WriteString(fmt.Sprintf(" :%v", fileInfo.Mode()))
 		}
-		errList.WriteString(fmt.Sprintf("%v", fileInfo.Mode()))
 		if isEphemeralVolumeRequest(req) {
-			if rmErr := os.RemoveAll(path); rmErr != nil && !os.IsNotExist(rmErr) {
+			if rmErr := removeAll(ctx, path); rmErr != nil && !os.IsNotExist(rmErr) {
 				errList.WriteString(fmt.Sprintf(" :%s", rmErr.Error()))
 			}
 		}
@@ -176,12 +249,12 @@ func isEphemeralVolumeId(volumeId string) bool {
 	return strings.HasPrefix(volumeId, "csi")
 }
 
-func (hpn *hostPathNode) getEphemeralVolumePath(storagePoolName, volumeId string) string {
+func (hpn *hostPathNode) getEphemeralStoragePoolPath(storagePoolName string) string {
 	storagePoolPath := hpn.cfg.StoragePoolInfo[storagePoolName].Path
 	if len(storagePoolPath) == 0 {
 		storagePoolPath = hpn.cfg.StoragePoolInfo[hpn.cfg.DefaultStoragePoolName].Path
 	}
-	return filepath.Join(storagePoolPath, volumeId)
+	return storagePoolPath
 }
 
 func (hpn *hostPathNode) validateNodeUnpublishRequest(req *csi.NodeUnpublishVolumeRequest) error {
@@ -196,45 +269,51 @@ func (hpn *hostPathNode) validateNodeUnpublishRequest(req *csi.NodeUnpublishVolu
 }
 
 func (hpn *hostPathNode) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
 	if req != nil {
-		klog.V(3).Infof("Node Unpublish Request: %+v", req)
+		logger.V(3).Info("Node unpublish request", "request", protosanitizer.StripSecrets(req))
 	}
 	if err := hpn.validateNodeUnpublishRequest(req); err != nil {
 		return nil, err
 	}
 	targetPath := req.GetTargetPath()
 
-	klog.V(3).Infof("Unmounting path: %s", targetPath)
+	logger.V(3).Info("Unmounting path", "targetPath", targetPath)
 	// Unmount only if the target path is really a mount point.
 	if notMnt, err := mount.IsNotMountPoint(hpn.cfg.Mounter, targetPath); err != nil {
 		if !os.IsNotExist(err) {
 			return nil, fmt.Errorf("check target path: %w", err)
 		}
 	} else if !notMnt {
-		klog.V(4).Info("Mount point")
+		logger.V(4).Info("Target path is a mount point", "targetPath", targetPath)
 		// Unmounting the image or filesystem.
 		err = hpn.cfg.Mounter.Unmount(targetPath)
 		if err != nil {
 			return nil, fmt.Errorf("unmount target path: %w", err)
 		}
 	}
-	klog.V(4).Infof("Deleting mount point: %s", targetPath)
+	logger.V(4).Info("Deleting mount point", "targetPath", targetPath)
 	// Delete the mount point.
 	// Does not return error for non-existent path, repeated calls OK for idempotency.
-	if err := os.RemoveAll(targetPath); err != nil {
+	if err := removeAll(ctx, targetPath); err != nil {
 		return nil, fmt.Errorf("remove target path: %w", err)
 	}
-	klog.V(4).Infof("hostpath: volume %s has been unpublished.", targetPath)
+	logger.V(4).Info("Volume has been unpublished", "targetPath", targetPath)
+	// The limits of the other volumes of the pod no longer include the ones of
+	// the volume. The pod is deleted already most of the time.
+	if err := releaseIOLimits(ctx, hpn.cfg.StoragePoolInfo, req.GetVolumeId(), targetPath); err != nil {
+		klog.Warningf("Unable to update the I/O limits of the pod of volume %s: %v", req.GetVolumeId(), err)
+	}
 	if isEphemeralVolumeId(req.GetVolumeId()) {
-		if err := hpn.removeEphemeralPath(req.GetVolumeId()); err != nil {
+		if err := hpn.removeEphemeralPath(ctx, req.GetVolumeId()); err != nil {
 			return nil, fmt.Errorf("failed to delete ephemeral volume: %s, %v", req.GetVolumeId(), err)
 		}
 	}
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
-func (hpn *hostPathNode) removeEphemeralPath(volumeId string) error {
-	volumeDirs, err := hpn.getVolumeDirectories()
+func (hpn *hostPathNode) removeEphemeralPath(ctx context.Context, volumeId string) error {
+	volumeDirs, err := hpn.getVolumeDirectories(ctx)
 	if err != nil {
 		return err
 	}
@@ -245,16 +324,16 @@ func (hpn *hostPathNode) removeEphemeralPath(volumeId string) error {
 		}
 	}
 	if volumePath != "" {
-		if err := DeleteVolume(filepath.Dir(volumePath), volumeId); err != nil {
+		if err := DeleteVolume(ctx, filepath.Dir(volumePath), volumeId); err != nil {
 			return fmt.Errorf("failed to delete ephemeral volume %s: %v", volumeId, err)
 		}
-		klog.V(4).Infof("ephemeral volume %v successfully deleted", volumeId)
+		klog.FromContext(ctx).V(4).Info("Ephemeral volume successfully deleted", "path", volumePath)
 	}
 	return nil
 }
 
-func (hpn *hostPathNode) getVolumeDirectories() ([]string, error) {
-	return getStoragePoolDataDirectories(hpn.cfg.StoragePoolInfo)
+func (hpn *hostPathNode) getVolumeDirectories(ctx context.Context) ([]string, error) {
+	return getStoragePoolDataDirectories(ctx, hpn.cfg.StoragePoolInfo)
 }
 
 func (hpn *hostPathNode) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
@@ -312,23 +391,24 @@ func (hpn *hostPathNode) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGe
 	if err := hpn.validateNodeGetVolumeStatsRequest(req); err != nil {
 		return nil, err
 	}
-	klog.V(3).Infof("Node Get Volume Stats Request: %+v", req)
+	logger := klog.FromContext(ctx)
+	logger.V(3).Info("Node get volume stats request", "request", protosanitizer.StripSecrets(req))
 
 	if _, err := os.Stat(req.GetVolumePath()); err != nil {
 		return nil, status.Errorf(codes.NotFound, "Could not get file information from %s: %+v", req.GetVolumePath(), err)
 	}
 
-	healthy, msg := doHealthCheckInNodeSide(req.GetVolumePath())
-	klog.V(3).Infof("Healthy state: %+v Volume: %+v", req.GetVolumeId(), healthy)
+	healthy, msg := doHealthCheckInNodeSide(ctx, req.GetVolumePath())
+	logger.V(3).Info("Volume health", "healthy", healthy)
 	if !healthy {
-		klog.V(1).Infof("Volume %s not healthy: %s", req.GetVolumeId(), msg)
+		logger.V(1).Info("Volume not healthy", "message", msg)
 	}
 	available, capacity, used, inodes, inodesFree, inodesUsed, err := getPVStatsFunc(req.GetVolumePath())
 	if err != nil {
 		return nil, fmt.Errorf("get volume stats failed: %w", err)
 	}
 
-	klog.V(3).Infof("Capacity: %+v Used: %+v Available: %+v Inodes: %+v Free inodes: %+v Used inodes: %+v", capacity, used, available, inodes, inodesFree, inodesUsed)
+	logger.V(3).Info("Volume stats", "capacity", capacity, "used", used, "available", available, "inodes", inodes, "inodesFree", inodesFree, "inodesUsed", inodesUsed)
 	return &csi.NodeGetVolumeStatsResponse{
 		Usage: []*csi.VolumeUsage{
 			{
@@ -74,7 +74,7 @@ func Test_NodeGetVolumeStatsHealthy(t *testing.T) {
 		checkMountPointExistsFunc = checkMountPointExist
 	}()
 
-	checkMountPointExistsFunc = func(volumePath string) (bool, error) {
+	checkMountPointExistsFunc = func(_ context.Context, volumePath string) (bool, error) {
 		// Mount point exists!
 		return true, nil
 	}
@@ -99,7 +99,7 @@ func Test_NodeGetVolumeStatsUnhealthy(t *testing.T) {
 		checkMountPointExistsFunc = checkMountPointExist
 	}()
 
-	checkMountPointExistsFunc = func(volumePath string) (bool, error) {
+	checkMountPointExistsFunc = func(_ context.Context, volumePath string) (bool, error) {
 		// Mount point missing exists!
 		return false, nil
 	}
@@ -363,6 +363,7 @@ func Test_NodePublishVolumeValidMountPoint(t *testing.T) {
 	nodeServer := createNodeServer(testNode)
 	fakeMounter := mount.NewFakeMounter([]mount.MountPoint{})
 	nodeServer.cfg.Mounter = fakeMounter
+	setLegacyStoragePool(nodeServer, tempDir, "abcd")
 	_, err = nodeServer.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
 		VolumeId:   "abcd",
 		TargetPath: filepath.Join(tempDir, validVolId),
@@ -379,7 +380,7 @@ func Test_NodePublishVolumeValidMountPoint(t *testing.T) {
 	mountAction := fakeMounter.GetLog()[0]
 	Expect(mountAction.Action).To(Equal(mount.FakeActionMount))
 	Expect(mountAction.Target).To(Equal(filepath.Join(tempDir, validVolId)))
-	Expect(mountAction.Source).To(Equal("abcd"))
+	Expect(mountAction.Source).To(HavePrefix(procFdPrefix()))
 	Expect(mountAction.FSType).To(Equal("ext4"))
 	Expect(len(fakeMounter.MountPoints)).To(Equal(1))
 	mountPoint := fakeMounter.MountPoints[0]
@@ -421,7 +422,7 @@ func Test_NodePublishVolumeEphemeral(t *testing.T) {
 	mountAction := fakeMounter.GetLog()[0]
 	Expect(mountAction.Action).To(Equal(mount.FakeActionMount))
 	Expect(mountAction.Target).To(Equal(filepath.Join(tempDir, validVolId)))
-	Expect(mountAction.Source).To(Equal(filepath.Join(tempDir, "csi-abcd")))
+	Expect(mountAction.Source).To(HavePrefix(procFdPrefix()))
 	Expect(mountAction.FSType).To(Equal("ext4"))
 	Expect(len(fakeMounter.MountPoints)).To(Equal(1))
 	mountPoint := fakeMounter.MountPoints[0]
@@ -454,6 +455,7 @@ func Test_NodePublishVolumeValidMountPointReadOnly(t *testing.T) {
 	nodeServer := createNodeServer(testNode)
 	fakeMounter := mount.NewFakeMounter([]mount.MountPoint{})
 	nodeServer.cfg.Mounter = fakeMounter
+	setLegacyStoragePool(nodeServer, tempDir, "abcd")
 	_, err = nodeServer.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
 		VolumeId:   "abcd",
 		TargetPath: filepath.Join(tempDir, validVolId),
@@ -471,7 +473,7 @@ func Test_NodePublishVolumeValidMountPointReadOnly(t *testing.T) {
 	mountAction := fakeMounter.GetLog()[0]
 	Expect(mountAction.Action).To(Equal(mount.FakeActionMount))
 	Expect(mountAction.Target).To(Equal(filepath.Join(tempDir, validVolId)))
-	Expect(mountAction.Source).To(Equal("abcd"))
+	Expect(mountAction.Source).To(HavePrefix(procFdPrefix()))
 	Expect(mountAction.FSType).To(Equal("ext4"))
 	Expect(len(fakeMounter.MountPoints)).To(Equal(1))
 	mountPoint := fakeMounter.MountPoints[0]
@@ -501,6 +503,63 @@ func Test_NodePublishVolumeInValidMountPoint(t *testing.T) {
 	Expect(err.Error()).To(ContainSubstring("check target path"))
 }
 
+// failingMounter fails to mount, and removes the target path like a
+// concurrent unpublish would.
+type failingMounter struct {
+	*mount.FakeMounter
+}
+
+func (f *failingMounter) Mount(source string, target string, fstype string, options []string) error {
+	os.RemoveAll(target)
+	return fmt.Errorf("mount failed")
+}
+
+func Test_NodePublishVolumeMountErrorMissingTarget(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	nodeServer := createNodeServer(testNode)
+	nodeServer.cfg.Mounter = &failingMounter{FakeMounter: mount.NewFakeMounter([]mount.MountPoint{})}
+	setLegacyStoragePool(nodeServer, filepath.Join(tempDir, "pool"), "abcd")
+	_, err := nodeServer.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeId:   "abcd",
+		TargetPath: filepath.Join(tempDir, validVolId),
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+		},
+	})
+	Expect(err).To(HaveOccurred())
+	Expect(err.Error()).To(ContainSubstring("mount failed"))
+	Expect(err.Error()).To(ContainSubstring("no such file or directory"))
+}
+
+func Test_NodePublishVolumeSymlinkOutOfPool(t *testing.T) {
+	RegisterTestingT(t)
+	pool, _ := createPoolWithSymlinks(t)
+	nodeServer := createNodeServer(testNode)
+	fakeMounter := mount.NewFakeMounter([]mount.MountPoint{})
+	nodeServer.cfg.Mounter = fakeMounter
+	setLegacyStoragePool(nodeServer, pool)
+	for volumeID, wantCode := range map[string]codes.Code{
+		"escape":   codes.InvalidArgument,
+		"relative": codes.InvalidArgument,
+		"pvc-2":    codes.NotFound,
+	} {
+		_, err := nodeServer.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeId:   volumeID,
+			TargetPath: filepath.Join(t.TempDir(), validVolId),
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(wantCode), volumeID)
+	}
+	Expect(fakeMounter.GetLog()).To(BeEmpty())
+}
+
 func Test_NodeGetCapabilities(t *testing.T) {
 	RegisterTestingT(t)
 	nodeServer := createNodeServer(testNode)
@@ -530,3 +589,20 @@ func createNodeServer(nodeId string) *hostPathNode {
 	}
 	return NewHostPathNode(&config)
 }
+
+// setLegacyStoragePool makes path the legacy storage pool of the node server,
+// with the volumes.
+func setLegacyStoragePool(nodeServer *hostPathNode, path string, volumes ...string) {
+	nodeServer.cfg.StoragePoolInfo = map[string]StoragePoolInfo{
+		legacyStoragePoolName: {Name: legacyStoragePoolName, Path: path},
+	}
+	for _, volume := range volumes {
+		Expect(os.MkdirAll(filepath.Join(path, volume), 0755)).To(Succeed())
+	}
+}
+
+// procFdPrefix returns the prefix of the paths of the files opened by the
+// test process.
+func procFdPrefix() string {
+	return fmt.Sprintf("/proc/%d/fd/", os.Getpid())
+}
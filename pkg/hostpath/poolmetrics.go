@@ -0,0 +1,143 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package hostpath
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"k8s.io/klog/v2"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+var (
+	getVolumeUsedBytes = volumeUsedBytesFunc
+
+	// reportedVolumes are the volumes of every pool whose used bytes are
+	// reported, so they are removed once the volumes no longer exist. It is
+	// guarded by reportedVolumesLock.
+	reportedVolumes     = make(map[string]map[string]bool)
+	reportedVolumesLock sync.Mutex
+)
+
+// evaluatePoolMetrics updates the capacity, inode, volume and snapshot metrics of
+// every storage pool, and the used bytes of every volume in those pools. The
+// used bytes of the volumes that no longer exist are removed after the others
+// are updated, so the existing volumes never stop being reported.
+func evaluatePoolMetrics(storagePoolDataDir map[string]StoragePoolInfo) {
+	reportedVolumesLock.Lock()
+	defer reportedVolumesLock.Unlock()
+	volumesByPool := make(map[string]map[string]bool)
+	for name, info := range storagePoolDataDir {
+		// Keep reporting the volumes of a pool that cannot be listed.
+		volumesByPool[name] = reportedVolumes[name]
+		available, capacity, _, inodes, inodesFree, _, err := getPVStatsFunc(info.Path)
+		if err != nil {
+			klog.V(3).Infof("unable to get filesystem stats of pool (%s, %s): %v", name, info.Path, err)
+			continue
+		}
+		stats := metrics.PoolStats{
+			CapacityBytes:   capacity,
+			AvailableBytes:  available,
+			Inodes:          inodes,
+			AvailableInodes: inodesFree,
+		}
+
+		volumes, err := listDirectories(info.Path)
+		if err != nil {
+			klog.V(3).Infof("unable to list volumes of pool (%s, %s): %v", name, info.Path, err)
+		} else {
+			volumesByPool[name] = make(map[string]bool)
+		}
+		stats.Volumes = len(volumes)
+		for _, volume := range volumes {
+			volumesByPool[name][volume] = true
+			used, err := getVolumeUsedBytes(filepath.Join(info.Path, volume))
+			if err != nil {
+				klog.V(3).Infof("unable to get used bytes of volume %s in pool %s: %v", volume, name, err)
+				continue
+			}
+			metrics.SetVolumeUsedBytes(name, volume, used)
+		}
+
+		if info.SnapshotPath != nil {
+			snapshots, err := listDirectories(*info.SnapshotPath)
+			if err != nil {
+				klog.V(3).Infof("unable to list snapshots of pool (%s, %s): %v", name, *info.SnapshotPath, err)
+			}
+			stats.Snapshots = len(snapshots)
+		}
+		metrics.SetPoolStats(name, stats)
+	}
+
+	for pool, volumes := range reportedVolumes {
+		for volume := range volumes {
+			if !volumesByPool[pool][volume] {
+				metrics.DeleteVolumeUsedBytes(pool, volume)
+			}
+		}
+	}
+	reportedVolumes = volumesByPool
+}
+
+// listDirectories returns the names of the directories directly below path.
+func listDirectories(path string) ([]string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	directories := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			directories = append(directories, entry.Name())
+		}
+	}
+	return directories, nil
+}
+
+// volumeUsedBytesFunc returns the number of bytes allocated on disk by the files
+// below path. Sparse files only count the blocks that are actually allocated.
+func volumeUsedBytesFunc(path string) (int64, error) {
+	var used int64
+	err := filepath.WalkDir(path, func(entryPath string, d fs.DirEntry, err error) error {
+		// The files removed while walking the volume are skipped.
+		if err != nil {
+			if entryPath != path && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			used += stat.Blocks * 512
+		} else {
+			used += info.Size()
+		}
+		return nil
+	})
+	return used, err
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+func Test_evaluatePoolMetrics(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	poolDir := filepath.Join(tempDir, "pool")
+	snapshotDir := filepath.Join(tempDir, "snapshots")
+	for _, dir := range []string{"vol1", "vol2"} {
+		Expect(os.MkdirAll(filepath.Join(poolDir, dir), 0755)).To(Succeed())
+	}
+	Expect(os.MkdirAll(filepath.Join(snapshotDir, "snap1"), 0755)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(poolDir, "not-a-volume"), []byte("test"), 0644)).To(Succeed())
+
+	oldGetPVStatsFunc := getPVStatsFunc
+	oldGetVolumeUsedBytes := getVolumeUsedBytes
+	defer func() {
+		getPVStatsFunc = oldGetPVStatsFunc
+		getVolumeUsedBytes = oldGetVolumeUsedBytes
+	}()
+	getPVStatsFunc = func(volumePath string) (int64, int64, int64, int64, int64, int64, error) {
+		return 4 * gib, 10 * gib, 6 * gib, 1000, 400, 600, nil
+	}
+	getVolumeUsedBytes = func(path string) (int64, error) {
+		if filepath.Base(path) == "vol1" {
+			return 2 * gib, nil
+		}
+		return 1 * mib, nil
+	}
+
+	evaluatePoolMetrics(map[string]StoragePoolInfo{
+		"pool": {
+			Name:         "pool",
+			Path:         poolDir,
+			SnapshotPath: &snapshotDir,
+		},
+	})
+	Expect(metrics.GetPoolStats("pool")).To(Equal(metrics.PoolStats{
+		CapacityBytes:   10 * gib,
+		AvailableBytes:  4 * gib,
+		Inodes:          1000,
+		AvailableInodes: 400,
+		Volumes:         2,
+		Snapshots:       1,
+	}))
+	Expect(metrics.GetVolumeUsedBytes("pool", "vol1")).To(BeEquivalentTo(2 * gib))
+	Expect(metrics.GetVolumeUsedBytes("pool", "vol2")).To(BeEquivalentTo(1 * mib))
+
+	// Removed volumes stop being reported, the others keep their last value
+	// when it cannot be updated.
+	Expect(os.Remove(filepath.Join(poolDir, "vol2"))).To(Succeed())
+	getVolumeUsedBytes = func(path string) (int64, error) {
+		return 0, errors.New("walk failed")
+	}
+	evaluatePoolMetrics(map[string]StoragePoolInfo{
+		"pool": {
+			Name:         "pool",
+			Path:         poolDir,
+			SnapshotPath: &snapshotDir,
+		},
+	})
+	Expect(metrics.GetVolumesWithUsedBytes("pool")).To(ConsistOf("vol1"))
+	Expect(metrics.GetVolumeUsedBytes("pool", "vol1")).To(BeEquivalentTo(2 * gib))
+}
+
+func Test_volumeUsedBytesFunc(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	Expect(os.MkdirAll(filepath.Join(tempDir, "sub"), 0755)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(tempDir, "sub", "file"), make([]byte, 64*kib), 0644)).To(Succeed())
+
+	used, err := volumeUsedBytesFunc(tempDir)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(used).To(BeNumerically(">=", 64*kib))
+
+	_, err = volumeUsedBytesFunc(filepath.Join(tempDir, "missing"))
+	Expect(err).To(HaveOccurred())
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package hostpath
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -26,6 +27,7 @@ import (
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -34,19 +36,19 @@ import (
 
 type SnapshotProvider interface {
 	// Initialize initialize the provider.
-	Initialize() error
+	Initialize(ctx context.Context) error
 	// GetSnapshotById gets the snapshot meta data of the specified snapshot id.
-	GetSnapshotById(snapshotId string) (*csi.Snapshot, error)
+	GetSnapshotById(ctx context.Context, snapshotId string) (*csi.Snapshot, error)
 	// GetSnapshotsByVolumeSourceId gets the snapshot meta data of the snapshots associated with the volume source id. All snapshots of a volume
-	GetSnapshotsByVolumeSourceId(volumeSourceId string) ([]csi.Snapshot, error)
+	GetSnapshotsByVolumeSourceId(ctx context.Context, volumeSourceId string) ([]csi.Snapshot, error)
 	// GetAllSnapshots gets all the snapshot meta data
-	GetAllSnapshots() ([]csi.Snapshot, error)
+	GetAllSnapshots(ctx context.Context) ([]csi.Snapshot, error)
 	// CreateSnapshot creates a snapshot.
-	CreateSnapshot(snapshotId, sourceVolumeId string) (*csi.Snapshot, error)
+	CreateSnapshot(ctx context.Context, snapshotId, sourceVolumeId string) (*csi.Snapshot, error)
 	// DeleteSnapshot removes a snapshot
-	DeleteSnapshot(snapshotId string) error
+	DeleteSnapshot(ctx context.Context, snapshotId string) error
 	// RestoreSnapshot restores the content of the snapshot into the target path
-	RestoreSnapshot(snapshotId, targetPath string) error
+	RestoreSnapshot(ctx context.Context, snapshotId, targetPath string) error
 }
 
 type Reflink struct {
@@ -71,25 +73,37 @@ func reflinkCopy(src, dst string) error {
 	return nil
 }
 
-func (r *Reflink) Initialize() error {
+// copyReflink copies src to dst with CopyReflinkFunc in a span.
+func copyReflink(ctx context.Context, src, dst string) error {
+	_, span := startSpan(ctx, "CopyReflink", attribute.String("source", src), attribute.String("target", dst))
+	err := CopyReflinkFunc(src, dst)
+	endSpan(span, err)
+	return err
+}
+
+func (r *Reflink) Initialize(ctx context.Context) error {
 	if err := ensurePathExists(r.path); err != nil {
 		return err
 	}
-	klog.V(1).Info("Successfully created reflink snapshot repo")
+	klog.FromContext(ctx).V(1).Info("Successfully created reflink snapshot repo", "path", r.path)
 	return nil
 }
 
-func (r *Reflink) GetSnapshotById(snapshotId string) (*csi.Snapshot, error) {
-	info, err := os.Stat(filepath.Join(r.path, snapshotId))
+func (r *Reflink) GetSnapshotById(ctx context.Context, snapshotId string) (*csi.Snapshot, error) {
+	snapPath, err := resolveBeneath(r.path, snapshotId)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(snapPath)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	} else if errors.Is(err, os.ErrNotExist) {
 		return nil, nil
 	}
 	if !info.IsDir() {
-		return nil, fmt.Errorf("file %s is not a directory", filepath.Join(r.path, snapshotId))
+		return nil, fmt.Errorf("file %s is not a directory", snapPath)
 	}
-	sourceVolumeId, err := r.getSourceVolumeId(snapshotId)
+	sourceVolumeId, err := r.getSourceVolumeId(snapPath, snapshotId)
 	if err != nil {
 		return nil, err
 	}
@@ -102,8 +116,8 @@ func (r *Reflink) GetSnapshotById(snapshotId string) (*csi.Snapshot, error) {
 	}, nil
 }
 
-func (r *Reflink) getSourceVolumeId(snapshotId string) (string, error) {
-	entries, err := os.ReadDir(filepath.Join(r.path, snapshotId))
+func (r *Reflink) getSourceVolumeId(snapPath, snapshotId string) (string, error) {
+	entries, err := os.ReadDir(snapPath)
 	if err != nil {
 		return "", err
 	}
@@ -117,8 +131,8 @@ func (r *Reflink) getSourceVolumeId(snapshotId string) (string, error) {
 	return "", fmt.Errorf("source volume not found for snapshot %s", snapshotId)
 }
 
-func (r *Reflink) GetSnapshotsByVolumeSourceId(volumeSourceId string) ([]csi.Snapshot, error) {
-	snapshots, err := r.GetAllSnapshots()
+func (r *Reflink) GetSnapshotsByVolumeSourceId(ctx context.Context, volumeSourceId string) ([]csi.Snapshot, error) {
+	snapshots, err := r.GetAllSnapshots(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -131,7 +145,7 @@ func (r *Reflink) GetSnapshotsByVolumeSourceId(volumeSourceId string) ([]csi.Sna
 	return res, nil
 }
 
-func (r *Reflink) GetAllSnapshots() ([]csi.Snapshot, error) {
+func (r *Reflink) GetAllSnapshots(ctx context.Context) ([]csi.Snapshot, error) {
 	entries, err := os.ReadDir(r.path)
 	if err != nil {
 		return nil, err
@@ -142,7 +156,7 @@ func (r *Reflink) GetAllSnapshots() ([]csi.Snapshot, error) {
 		if !entry.IsDir() {
 			continue
 		}
-		snapshot, err := r.GetSnapshotById(entry.Name())
+		snapshot, err := r.GetSnapshotById(ctx, entry.Name())
 		if err != nil {
 			return nil, err
 		}
@@ -151,18 +165,27 @@ func (r *Reflink) GetAllSnapshots() ([]csi.Snapshot, error) {
 	return snapshots, nil
 }
 
-func (r *Reflink) CreateSnapshot(snapshotId, sourceVolumeId string) (*csi.Snapshot, error) {
+func (r *Reflink) CreateSnapshot(ctx context.Context, snapshotId, sourceVolumeId string) (*csi.Snapshot, error) {
+	logger := klog.FromContext(ctx)
 	// Check if the source volume exists, so we can snapshot it.
-	sourcePoolDir := filepath.Join(r.sourcePath, sourceVolumeId)
+	sourcePoolDir, err := resolveBeneath(r.sourcePath, sourceVolumeId)
+	if err != nil {
+		return nil, err
+	}
+	snapPath, err := resolveBeneath(r.path, snapshotId)
+	if err != nil {
+		return nil, err
+	}
 	if exists, err := checkPathExist(sourcePoolDir); err != nil {
 		return nil, err
 	} else if exists {
-		snapshotDir := filepath.Join(r.path, snapshotId, dataPath)
-		sourceDir := filepath.Join(r.path, snapshotId, sourceVolumeId)
+		snapshotDir := filepath.Join(snapPath, dataPath)
+		sourceDir := filepath.Join(snapPath, sourceVolumeId)
 		snapshotExists, err := checkPathExist(snapshotDir)
 		if err != nil {
 			return nil, err
 		} else if snapshotExists {
+			logger.V(4).Info("Snapshot data already exists", "path", snapshotDir)
 			return r.createSnapshotFromDir(snapshotId, sourceVolumeId, snapshotDir)
 		}
 		if err := os.MkdirAll(snapshotDir, 0755); err != nil {
@@ -173,9 +196,12 @@ func (r *Reflink) CreateSnapshot(snapshotId, sourceVolumeId string) (*csi.Snapsh
 		}
 		// Use "/." to copy contents of source PVC into snapshot data dir, not the PVC directory itself
 		sourcePoolDirContents := sourcePoolDir + "/."
-		if err := CopyReflinkFunc(sourcePoolDirContents, snapshotDir); err != nil {
+		logger.V(4).Info("Copying volume into snapshot", "source", sourcePoolDir, "target", snapshotDir)
+		start := time.Now()
+		if err := copyReflink(ctx, sourcePoolDirContents, snapshotDir); err != nil {
 			return nil, err
 		}
+		logger.V(3).Info("Copied volume into snapshot", "source", sourcePoolDir, "target", snapshotDir, "duration", time.Since(start))
 		return r.createSnapshotFromDir(snapshotId, sourceVolumeId, snapshotDir)
 	}
 	return nil, fmt.Errorf("source volume %s not found, unable to create snapshot", sourcePoolDir)
@@ -194,20 +220,29 @@ func (r *Reflink) createSnapshotFromDir(snapshotId, sourceVolumeId, path string)
 	}, nil
 }
 
-func (r *Reflink) DeleteSnapshot(snapshotId string) error {
-	snapPath := filepath.Join(r.path, snapshotId)
+func (r *Reflink) DeleteSnapshot(ctx context.Context, snapshotId string) error {
+	snapPath, err := resolveBeneath(r.path, snapshotId)
+	if err != nil {
+		return err
+	}
 	if exists, err := checkPathExist(snapPath); err != nil {
 		return err
 	} else if exists {
-		if err := os.RemoveAll(snapPath); err != nil {
+		if err := removeAll(ctx, snapPath); err != nil {
 			return err
 		}
+		klog.FromContext(ctx).V(4).Info("Deleted snapshot", "path", snapPath)
 	}
 	return nil
 }
 
-func (r *Reflink) RestoreSnapshot(snapshotId, targetPath string) error {
-	snapPath := filepath.Join(r.path, snapshotId, dataPath)
+func (r *Reflink) RestoreSnapshot(ctx context.Context, snapshotId, targetPath string) error {
+	logger := klog.FromContext(ctx)
+	snapPath, err := resolveBeneath(r.path, snapshotId)
+	if err != nil {
+		return err
+	}
+	snapPath = filepath.Join(snapPath, dataPath)
 	if exists, err := checkPathExist(snapPath); err != nil {
 		return err
 	} else if exists {
@@ -219,10 +254,13 @@ func (r *Reflink) RestoreSnapshot(snapshotId, targetPath string) error {
 		}
 
 		// copy the contents of data/ and not the directory itself
+		logger.V(4).Info("Copying snapshot into volume", "source", snapPath, "target", targetPath)
+		start := time.Now()
 		snapPath = snapPath + "/."
-		if err := CopyReflinkFunc(snapPath, targetPath); err != nil {
+		if err := copyReflink(ctx, snapPath, targetPath); err != nil {
 			return err
 		}
+		logger.V(3).Info("Copied snapshot into volume", "target", targetPath, "duration", time.Since(start))
 		return nil
 	}
 	return status.Errorf(codes.NotFound, "snapshot %s not found, unable to restore into volume", snapshotId)
@@ -16,6 +16,7 @@ limitations under the License.
 package hostpath
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -40,7 +41,7 @@ func TestReflink_Initialize(t *testing.T) {
 		sourcePath: "/invalid/path",
 		nodeName:   "testnode",
 	}
-	err := reflink.Initialize()
+	err := reflink.Initialize(context.TODO())
 	Expect(err).To(HaveOccurred())
 }
 
@@ -54,22 +55,22 @@ func TestReflink_GetSnapshotById(t *testing.T) {
 		sourcePath: filepath.Join(tempDir, testVolumeDir),
 		nodeName:   "testnode",
 	}
-	err = reflink.Initialize()
+	err = reflink.Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 	t.Run("snapshot does not exist", func(t *testing.T) {
 		snapshotId := testSnapshot
-		snapshot, err := reflink.GetSnapshotById(snapshotId)
+		snapshot, err := reflink.GetSnapshotById(context.TODO(), snapshotId)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshot).To(BeNil())
 	})
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume))
 	Expect(err).ToNot(HaveOccurred())
-	snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+	snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot).ToNot(BeNil())
 	t.Run("snapshot exists", func(t *testing.T) {
 		snapshotId := testSnapshot
-		snapshot, err := reflink.GetSnapshotById(snapshotId)
+		snapshot, err := reflink.GetSnapshotById(context.TODO(), snapshotId)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshot).ToNot(BeNil())
 		Expect(snapshot.SnapshotId).To(Equal(snapshotId))
@@ -86,20 +87,20 @@ func TestReflink_GetSnapshotsByVolumeSourceId(t *testing.T) {
 		sourcePath: filepath.Join(tempDir, testVolumeDir),
 		nodeName:   "testnode",
 	}
-	err = reflink.Initialize()
+	err = reflink.Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 	t.Run("no snapshots", func(t *testing.T) {
-		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(testVolume)
+		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(context.TODO(), testVolume)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshots).To(BeEmpty())
 	})
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume))
 	Expect(err).ToNot(HaveOccurred())
-	snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+	snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot).ToNot(BeNil())
 	t.Run("snapshot exists", func(t *testing.T) {
-		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(testVolume)
+		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(context.TODO(), testVolume)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshots).To(HaveLen(1))
 		Expect(snapshots[0].SnapshotId).To(Equal(testSnapshot))
@@ -107,21 +108,21 @@ func TestReflink_GetSnapshotsByVolumeSourceId(t *testing.T) {
 	})
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume+"invalid"))
 	Expect(err).ToNot(HaveOccurred())
-	snapshot2, err := reflink.CreateSnapshot(testSnapshot2, testVolume+"invalid")
+	snapshot2, err := reflink.CreateSnapshot(context.TODO(), testSnapshot2, testVolume+"invalid")
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot2).ToNot(BeNil())
 	t.Run("multiple snapshots exist, but unrelated", func(t *testing.T) {
-		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(testVolume)
+		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(context.TODO(), testVolume)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshots).To(HaveLen(1))
 		Expect(snapshots[0].SnapshotId).To(Equal(testSnapshot))
 		Expect(snapshots[0].SourceVolumeId).To(Equal(testVolume))
 	})
-	snapshot3, err := reflink.CreateSnapshot(testSnapshot2+"valid", testVolume)
+	snapshot3, err := reflink.CreateSnapshot(context.TODO(), testSnapshot2+"valid", testVolume)
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot2).ToNot(BeNil())
 	t.Run("multiple snapshots exist, but unrelated", func(t *testing.T) {
-		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(testVolume)
+		snapshots, err := reflink.GetSnapshotsByVolumeSourceId(context.TODO(), testVolume)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshots).To(HaveLen(2))
 		Expect(snapshots[0].SnapshotId).To(Equal(testSnapshot))
@@ -141,9 +142,9 @@ func TestReflink_GetAllSnapshots(t *testing.T) {
 		sourcePath: filepath.Join(tempDir, testVolumeDir),
 		nodeName:   "testnode",
 	}
-	err = reflink.Initialize()
+	err = reflink.Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
-	snapshots, err := reflink.GetAllSnapshots()
+	snapshots, err := reflink.GetAllSnapshots(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshots).To(BeEmpty())
 	err = ensurePathExists(filepath.Join(reflink.path))
@@ -151,19 +152,19 @@ func TestReflink_GetAllSnapshots(t *testing.T) {
 	err = os.WriteFile(filepath.Join(reflink.path, "invalid"), []byte{}, 0644)
 	Expect(err).ToNot(HaveOccurred())
 	t.Run("non directory snapshot file", func(t *testing.T) {
-		snapshots, err := reflink.GetAllSnapshots()
+		snapshots, err := reflink.GetAllSnapshots(context.TODO())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshots).To(BeEmpty())
 	})
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume))
 	Expect(err).ToNot(HaveOccurred())
-	snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+	snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot).ToNot(BeNil())
-	snapshot2, err := reflink.CreateSnapshot(testSnapshot2, testVolume)
+	snapshot2, err := reflink.CreateSnapshot(context.TODO(), testSnapshot2, testVolume)
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot2).ToNot(BeNil())
-	snapshots, err = reflink.GetAllSnapshots()
+	snapshots, err = reflink.GetAllSnapshots(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshots).To(HaveLen(2))
 }
@@ -178,24 +179,24 @@ func TestReflink_CreateSnapshot(t *testing.T) {
 		sourcePath: filepath.Join(tempDir, testVolumeDir),
 		nodeName:   "testnode",
 	}
-	err = reflink.Initialize()
+	err = reflink.Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 	t.Run("source volume does not exist", func(t *testing.T) {
-		snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+		snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 		Expect(err).To(HaveOccurred())
 		Expect(snapshot).To(BeNil())
 	})
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume))
 	Expect(err).ToNot(HaveOccurred())
 	t.Run("source volume exists", func(t *testing.T) {
-		snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+		snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshot).ToNot(BeNil())
 		Expect(snapshot.SnapshotId).To(Equal(testSnapshot))
 		Expect(snapshot.SourceVolumeId).To(Equal(testVolume))
 	})
 	t.Run("source volume exists, and snapshot already exists", func(t *testing.T) {
-		snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+		snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshot).ToNot(BeNil())
 		Expect(snapshot.SnapshotId).To(Equal(testSnapshot))
@@ -213,15 +214,15 @@ func TestReflink_DeleteSnapshot(t *testing.T) {
 		sourcePath: filepath.Join(tempDir, testVolumeDir),
 		nodeName:   "testnode",
 	}
-	err = reflink.Initialize()
+	err = reflink.Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume))
 	Expect(err).ToNot(HaveOccurred())
-	snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+	snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot).ToNot(BeNil())
 
-	err = reflink.DeleteSnapshot(testSnapshot)
+	err = reflink.DeleteSnapshot(context.TODO(), testSnapshot)
 	Expect(err).ToNot(HaveOccurred())
 }
 
@@ -235,15 +236,15 @@ func TestReflink_RestoreSnapshot(t *testing.T) {
 		sourcePath: filepath.Join(tempDir, testVolumeDir),
 		nodeName:   "testnode",
 	}
-	err = reflink.Initialize()
+	err = reflink.Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume))
 	Expect(err).ToNot(HaveOccurred())
-	snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+	snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 	Expect(err).ToNot(HaveOccurred())
 	Expect(snapshot).ToNot(BeNil())
 	os.MkdirAll(filepath.Join(reflink.sourcePath, "restored"), 0777)
-	err = reflink.RestoreSnapshot(testSnapshot, filepath.Join(reflink.sourcePath, "restored"))
+	err = reflink.RestoreSnapshot(context.TODO(), testSnapshot, filepath.Join(reflink.sourcePath, "restored"))
 	Expect(err).ToNot(HaveOccurred())
 }
 
@@ -319,13 +320,13 @@ func TestReflink_ReflinkCopy(t *testing.T) {
 		nodeName:   "testnode",
 	}
 
-	err = reflink.Initialize()
+	err = reflink.Initialize(context.TODO())
 	Expect(err).ToNot(HaveOccurred())
 
 	err = ensurePathExists(filepath.Join(reflink.sourcePath, testVolume))
 	Expect(err).ToNot(HaveOccurred())
 	t.Run("source volume exists", func(t *testing.T) {
-		snapshot, err := reflink.CreateSnapshot(testSnapshot, testVolume)
+		snapshot, err := reflink.CreateSnapshot(context.TODO(), testSnapshot, testVolume)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(snapshot).ToNot(BeNil())
 		Expect(snapshot.SnapshotId).To(Equal(testSnapshot))
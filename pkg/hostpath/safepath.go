@@ -0,0 +1,173 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// openat2Func is a variable so the fallback for kernels without openat2 can be tested.
+	openat2Func = unix.Openat2
+)
+
+// isPathElement returns true if name can only be used as a single entry in a directory.
+func isPathElement(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00")
+}
+
+// resolveBeneath returns the path of the entry name in the directory base. It
+// fails when name is not a single path element, or when the entry exists and
+// resolves outside of base, for instance because it is a symlink pointing
+// out of the storage pool.
+//
+// The returned path is only checked: an entry replaced by a symlink after the
+// check is followed by the callers using the path. os.RemoveAll is not
+// affected since it removes a symlink rather than its target, but the source
+// of a mount is, so mounts use openBeneath instead.
+func resolveBeneath(base, name string) (string, error) {
+	if !isPathElement(name) {
+		return "", status.Errorf(codes.InvalidArgument, "%q is not a valid volume or snapshot name", name)
+	}
+	path := filepath.Join(base, name)
+
+	dirfd, err := unix.Open(base, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			// Nothing exists beneath base yet, so nothing can escape.
+			return path, nil
+		}
+		return "", fmt.Errorf("failed to open %s: %w", base, err)
+	}
+	defer unix.Close(dirfd)
+
+	fd, err := openat2Func(dirfd, name, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	switch {
+	case err == nil:
+		unix.Close(fd)
+		return path, nil
+	case errors.Is(err, unix.ENOENT):
+		return path, nil
+	case errors.Is(err, unix.EXDEV), errors.Is(err, unix.ELOOP):
+		return "", status.Errorf(codes.InvalidArgument, "%s resolves outside of %s", name, base)
+	case errors.Is(err, unix.ENOSYS):
+		return resolveBeneathFallback(base, path)
+	default:
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+}
+
+// resolveBeneathFallback checks path resolves beneath base on kernels without
+// openat2 (before 5.6) by evaluating the symlinks.
+func resolveBeneathFallback(base, path string) (string, error) {
+	resolvedBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", base, err)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if _, lerr := os.Lstat(path); lerr == nil {
+				// A dangling symlink, it is not known where it will point to.
+				return "", status.Errorf(codes.InvalidArgument, "%s is a dangling symlink", path)
+			}
+			return path, nil
+		}
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if !strings.HasPrefix(resolved, resolvedBase+string(filepath.Separator)) {
+		return "", status.Errorf(codes.InvalidArgument, "%s resolves outside of %s", filepath.Base(path), base)
+	}
+	return path, nil
+}
+
+// openBeneath opens the directory name in the directory base with O_PATH, and
+// fails like resolveBeneath when it resolves outside of base. Unlike the path
+// returned by resolveBeneath, the file keeps referring to the checked
+// directory when the entry is replaced afterwards.
+func openBeneath(base, name string) (*os.File, error) {
+	if !isPathElement(name) {
+		return nil, status.Errorf(codes.InvalidArgument, "%q is not a valid volume or snapshot name", name)
+	}
+	path := filepath.Join(base, name)
+
+	dirfd, err := unix.Open(base, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: base, Err: err}
+	}
+	defer unix.Close(dirfd)
+
+	fd, err := openat2Func(dirfd, name, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if errors.Is(err, unix.ENOSYS) {
+		if _, err := resolveBeneathFallback(base, path); err != nil {
+			return nil, err
+		}
+		fd, err = openBeneathFallback(dirfd, base, name)
+	}
+	switch {
+	case err == nil:
+		return os.NewFile(uintptr(fd), path), nil
+	case errors.Is(err, unix.EXDEV), errors.Is(err, unix.ELOOP):
+		return nil, status.Errorf(codes.InvalidArgument, "%s resolves outside of %s", name, base)
+	default:
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+}
+
+// openBeneathFallback opens name in dirfd on kernels without openat2, and
+// checks the opened directory, rather than its path, is beneath base.
+func openBeneathFallback(dirfd int, base, name string) (int, error) {
+	resolvedBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return -1, err
+	}
+	fd, err := unix.Openat(dirfd, name, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	resolved, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	if !strings.HasPrefix(resolved, resolvedBase+string(filepath.Separator)) {
+		unix.Close(fd)
+		return -1, unix.EXDEV
+	}
+	return fd, nil
+}
+
+// procFdPath returns a path referring to the file opened by openBeneath, which
+// other processes like mount can use. /proc/self cannot be used since it
+// refers to the other process.
+func procFdPath(f *os.File) string {
+	return fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), f.Fd())
+}
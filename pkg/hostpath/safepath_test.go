@@ -0,0 +1,236 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// createPoolWithSymlinks creates a storage pool with a volume, a symlink to the
+// volume and symlinks pointing out of the pool.
+func createPoolWithSymlinks(t *testing.T) (string, string) {
+	root := t.TempDir()
+	pool := filepath.Join(root, "pool")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{filepath.Join(pool, "pvc-1"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	links := map[string]string{
+		"inside":   "pvc-1",
+		"escape":   outside,
+		"relative": "../outside",
+		"dangling": filepath.Join(outside, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(pool, name)); err != nil {
+			t.Fatalf("Failed to create symlink %s: %v", name, err)
+		}
+	}
+	return pool, outside
+}
+
+func testResolveBeneath(t *testing.T) {
+	pool, _ := createPoolWithSymlinks(t)
+	tests := []struct {
+		name     string
+		id       string
+		wantCode codes.Code
+	}{
+		{"existing volume", "pvc-1", codes.OK},
+		{"new volume", "pvc-2", codes.OK},
+		{"symlink inside pool", "inside", codes.OK},
+		{"symlink out of pool", "escape", codes.InvalidArgument},
+		{"relative symlink out of pool", "relative", codes.InvalidArgument},
+		{"dangling symlink out of pool", "dangling", codes.InvalidArgument},
+		{"empty", "", codes.InvalidArgument},
+		{"dot", ".", codes.InvalidArgument},
+		{"dot dot", "..", codes.InvalidArgument},
+		{"separator", "pvc-1/..", codes.InvalidArgument},
+		{"absolute path", "/etc", codes.InvalidArgument},
+		{"nul", "pvc\x00", codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RegisterTestingT(t)
+			path, err := resolveBeneath(pool, tt.id)
+			Expect(status.Code(err)).To(Equal(tt.wantCode))
+			if tt.wantCode == codes.OK {
+				Expect(path).To(Equal(filepath.Join(pool, tt.id)))
+			}
+		})
+	}
+}
+
+func Test_resolveBeneath(t *testing.T) {
+	testResolveBeneath(t)
+}
+
+func Test_resolveBeneathWithoutOpenat2(t *testing.T) {
+	oldOpenat2Func := openat2Func
+	defer func() {
+		openat2Func = oldOpenat2Func
+	}()
+	openat2Func = func(dirfd int, path string, how *unix.OpenHow) (int, error) {
+		return -1, unix.ENOSYS
+	}
+	testResolveBeneath(t)
+}
+
+func Test_resolveBeneathMissingBase(t *testing.T) {
+	RegisterTestingT(t)
+	base := filepath.Join(t.TempDir(), "missing")
+	path, err := resolveBeneath(base, "pvc-1")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(path).To(Equal(filepath.Join(base, "pvc-1")))
+}
+
+func testOpenBeneath(t *testing.T) {
+	pool, outside := createPoolWithSymlinks(t)
+	tests := []struct {
+		name     string
+		id       string
+		wantCode codes.Code
+	}{
+		{"existing volume", "pvc-1", codes.OK},
+		{"symlink inside pool", "inside", codes.OK},
+		{"symlink out of pool", "escape", codes.InvalidArgument},
+		{"relative symlink out of pool", "relative", codes.InvalidArgument},
+		{"dangling symlink out of pool", "dangling", codes.InvalidArgument},
+		{"dot dot", "..", codes.InvalidArgument},
+		{"absolute path", "/etc", codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RegisterTestingT(t)
+			f, err := openBeneath(pool, tt.id)
+			Expect(status.Code(err)).To(Equal(tt.wantCode))
+			if tt.wantCode == codes.OK {
+				defer f.Close()
+				Expect(f.Name()).To(Equal(filepath.Join(pool, tt.id)))
+			}
+		})
+	}
+
+	t.Run("missing volume", func(t *testing.T) {
+		RegisterTestingT(t)
+		_, err := openBeneath(pool, "pvc-2")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	t.Run("volume replaced by a symlink", func(t *testing.T) {
+		RegisterTestingT(t)
+		Expect(os.Mkdir(filepath.Join(pool, "pvc-3"), 0755)).To(Succeed())
+		f, err := openBeneath(pool, "pvc-3")
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		Expect(os.Rename(filepath.Join(pool, "pvc-3"), filepath.Join(pool, "pvc-3-moved"))).To(Succeed())
+		Expect(os.Symlink(outside, filepath.Join(pool, "pvc-3"))).To(Succeed())
+		target, err := os.Readlink(procFdPath(f))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target).To(Equal(filepath.Join(pool, "pvc-3-moved")))
+	})
+}
+
+func Test_openBeneath(t *testing.T) {
+	testOpenBeneath(t)
+}
+
+func Test_openBeneathWithoutOpenat2(t *testing.T) {
+	oldOpenat2Func := openat2Func
+	defer func() {
+		openat2Func = oldOpenat2Func
+	}()
+	openat2Func = func(dirfd int, path string, how *unix.OpenHow) (int, error) {
+		return -1, unix.ENOSYS
+	}
+	testOpenBeneath(t)
+}
+
+func Test_DeleteVolumeSymlinkOutOfPool(t *testing.T) {
+	RegisterTestingT(t)
+	pool, outside := createPoolWithSymlinks(t)
+	Expect(os.WriteFile(filepath.Join(outside, "data"), []byte("data"), 0644)).To(Succeed())
+
+	err := DeleteVolume(context.TODO(), pool, "escape")
+	Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	Expect(filepath.Join(outside, "data")).To(BeAnExistingFile())
+	Expect(CreateVolumeDirectory(context.TODO(), pool, "dangling")).ToNot(Succeed())
+	Expect(filepath.Join(outside, "missing")).ToNot(BeADirectory())
+}
+
+func FuzzResolveBeneath(f *testing.F) {
+	for _, seed := range []string{"pvc-1", "inside", "escape", "relative", "dangling", ".", "..", "../outside", "a/b", "/etc", "pvc\x00", ""} {
+		f.Add(seed)
+	}
+	root := f.TempDir()
+	pool := filepath.Join(root, "pool")
+	outside := filepath.Join(root, "outside")
+	if err := os.MkdirAll(filepath.Join(pool, "pvc-1"), 0755); err != nil {
+		f.Fatalf("Failed to create pool: %v", err)
+	}
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		f.Fatalf("Failed to create %s: %v", outside, err)
+	}
+	_ = os.Symlink("pvc-1", filepath.Join(pool, "inside"))
+	_ = os.Symlink(outside, filepath.Join(pool, "escape"))
+	_ = os.Symlink("../outside", filepath.Join(pool, "relative"))
+	resolvedPool, err := filepath.EvalSymlinks(pool)
+	if err != nil {
+		f.Fatalf("Failed to resolve %s: %v", pool, err)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		path, err := resolveBeneath(pool, name)
+		if err != nil {
+			return
+		}
+		if filepath.Dir(path) != pool || filepath.Base(path) != name {
+			t.Fatalf("%q resolved to %s, not an entry of %s", name, path, pool)
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return
+		}
+		if !strings.HasPrefix(resolved, resolvedPool+string(filepath.Separator)) {
+			t.Fatalf("%q resolved to %s outside of %s", name, resolved, pool)
+		}
+	})
+}
+
+func FuzzValidateID(f *testing.F) {
+	for _, seed := range []string{"pvc-1", ".", "..", "../pvc", "a/b", "/", "pvc\x00", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, id string) {
+		if err := validateID("volume ID", id, true); err != nil {
+			return
+		}
+		if joined := filepath.Join("/pool", id); filepath.Dir(joined) != "/pool" {
+			t.Fatalf("valid ID %q escapes the pool as %s", id, joined)
+		}
+	})
+}
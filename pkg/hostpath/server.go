@@ -17,19 +17,29 @@ limitations under the License.
 package hostpath
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	klog "k8s.io/klog/v2"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
 )
 
 func NewNonBlockingGRPCServer() *nonBlockingGRPCServer {
@@ -38,39 +48,28 @@ func NewNonBlockingGRPCServer() *nonBlockingGRPCServer {
 
 // NonBlocking server
 type nonBlockingGRPCServer struct {
-	wg      sync.WaitGroup
-	server  *grpc.Server
-	cleanup func()
-}
-
-func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
-	s.wg.Add(1)
-
-	go s.serve(endpoint, ids, cs, ns)
-}
-
-func (s *nonBlockingGRPCServer) Wait() {
-	s.wg.Wait()
-}
-
-func (s *nonBlockingGRPCServer) Stop() {
-	s.server.GracefulStop()
-	s.cleanup()
-}
-
-func (s *nonBlockingGRPCServer) ForceStop() {
-	s.server.Stop()
-	s.cleanup()
+	wg       sync.WaitGroup
+	server   *grpc.Server
+	cleanup  func()
+	serveErr error
 }
 
-func (s *nonBlockingGRPCServer) serve(ep string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
-	listener, cleanup, err := listen(ep)
+// Start starts listening on the endpoint, and serves the CSI services in the
+// background until the server is stopped.
+func (s *nonBlockingGRPCServer) Start(endpoint string, tlsConfig *tls.Config, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) error {
+	listener, cleanup, err := listen(endpoint)
 	if err != nil {
-		klog.Fatalf("Failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(logGRPC),
+		// The stats handler creates a span for every call, continuing the
+		// trace of the caller when it propagates the W3C trace context.
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(logGRPC, metricsGRPC, recoverGRPC, validateGRPC),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 	server := grpc.NewServer(opts...)
 	s.server = server
@@ -86,35 +85,77 @@ func (s *nonBlockingGRPCServer) serve(ep string, ids csi.IdentityServer, cs csi.
 		csi.RegisterNodeServer(server, ns)
 	}
 
+	s.wg.Add(1)
+	go s.serve(listener)
+	return nil
+}
+
+// Wait blocks until the server stopped serving, and returns the error it stopped with.
+func (s *nonBlockingGRPCServer) Wait() error {
+	s.wg.Wait()
+	return s.serveErr
+}
+
+// Stop stops accepting new calls, and waits up to timeout for the calls in
+// flight to complete before closing their connections.
+func (s *nonBlockingGRPCServer) Stop(timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		klog.V(1).Info("All in flight calls completed")
+	case <-time.After(timeout):
+		klog.Warningf("In flight calls did not complete within %s, stopping anyway", timeout)
+		s.server.Stop()
+	}
+	s.cleanup()
+}
+
+func (s *nonBlockingGRPCServer) ForceStop() {
+	s.server.Stop()
+	s.cleanup()
+}
+
+func (s *nonBlockingGRPCServer) serve(listener net.Listener) {
+	defer s.wg.Done()
+
 	klog.Infof("Listening for connections on address: %#v", listener.Addr())
 
-	err = server.Serve(listener)
-	if err != nil {
-		klog.V(1).ErrorS(err, "Exited server.Serve with error")
+	s.serveErr = s.server.Serve(listener)
+	if s.serveErr != nil {
+		klog.V(1).ErrorS(s.serveErr, "Exited server.Serve with error")
 	}
-	defer klog.V(1).Info("Done?")
 }
 
 func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	pri := klog.Level(3)
+	// Every call gets a logger with a request ID and the IDs of the objects
+	// it refers to, so the handlers can log the lifecycle of a volume.
+	keysAndValues := append([]interface{}{"requestID", uuid.NewUUID(), "method", info.FullMethod}, requestLogValues(req)...)
+	logger := klog.LoggerWithValues(klog.FromContext(ctx), keysAndValues...)
+	ctx = klog.NewContext(ctx, logger)
+
+	pri := 3
 	if info.FullMethod == "/csi.v1.Identity/Probe" {
 		// This call occurs frequently, therefore it only gets log at level 5.
 		pri = 5
 	}
-	klog.V(pri).Infof("GRPC call: %s", info.FullMethod)
+	logger.V(pri).Info("GRPC call")
 
-	v5 := klog.V(5)
+	v5 := logger.V(5)
 	if v5.Enabled() {
-		v5.Infof("GRPC request: %s", protosanitizer.StripSecrets(req))
+		v5.Info("GRPC request", "request", protosanitizer.StripSecrets(req))
 	}
 	resp, err := handler(ctx, req)
 	if err != nil {
-		// Always log errors. Probably not useful though without the method name?!
-		klog.Errorf("GRPC error: %v", err)
+		// Always log errors.
+		logger.Error(err, "GRPC error")
 	}
 
 	if v5.Enabled() {
-		v5.Infof("GRPC response: %s", protosanitizer.StripSecrets(resp))
+		v5.Info("GRPC response", "response", protosanitizer.StripSecrets(resp))
 
 		// In JSON format, intentionally logging without stripping secret
 		// fields due to below reasons:
@@ -132,6 +173,82 @@ func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h
 	return resp, err
 }
 
+// requestLogValues returns the volume, snapshot and storage pool IDs a CSI
+// request refers to as key value pairs for the logger.
+func requestLogValues(req interface{}) []interface{} {
+	var volumeID, snapshotID string
+	var params map[string]string
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		volumeID = r.GetName()
+		snapshotID = r.GetVolumeContentSource().GetSnapshot().GetSnapshotId()
+		params = r.GetParameters()
+	case *csi.CreateSnapshotRequest:
+		volumeID = r.GetSourceVolumeId()
+		snapshotID = r.GetName()
+		params = r.GetParameters()
+	default:
+		if r, ok := req.(interface{ GetVolumeId() string }); ok {
+			volumeID = r.GetVolumeId()
+		}
+		if r, ok := req.(interface{ GetSourceVolumeId() string }); ok && volumeID == "" {
+			volumeID = r.GetSourceVolumeId()
+		}
+		if r, ok := req.(interface{ GetSnapshotId() string }); ok {
+			snapshotID = r.GetSnapshotId()
+		}
+		if r, ok := req.(interface{ GetParameters() map[string]string }); ok {
+			params = r.GetParameters()
+		}
+		if r, ok := req.(interface{ GetVolumeContext() map[string]string }); ok && params == nil {
+			params = r.GetVolumeContext()
+		}
+	}
+
+	var keysAndValues []interface{}
+	if volumeID != "" {
+		keysAndValues = append(keysAndValues, "volumeID", volumeID)
+	}
+	if snapshotID != "" {
+		keysAndValues = append(keysAndValues, "snapshotID", snapshotID)
+	}
+	if pool, ok := params[storagePoolName]; ok {
+		keysAndValues = append(keysAndValues, "pool", pool)
+	}
+	return keysAndValues
+}
+
+// metricsGRPC records the outcome, duration and number of in flight calls per CSI method
+func metricsGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	done := metrics.StartCSIOperation(info.FullMethod)
+	resp, err := handler(ctx, req)
+	done(status.Code(err).String())
+	return resp, err
+}
+
+// recoverGRPC converts a panic in a handler into an Internal error, so a bug
+// in a single call does not crash the whole driver.
+func recoverGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			klog.FromContext(ctx).Error(nil, "Recovered from panic in GRPC call", "panic", r, "stack", string(debug.Stack()))
+			metrics.IncCSIPanics(info.FullMethod)
+			resp = nil
+			err = status.Errorf(codes.Internal, "internal error handling %s: %v", info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// validateGRPC rejects requests with missing or unsafe IDs before they reach
+// the handlers.
+func validateGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
 // logGRPCJson logs the called GRPC call details in JSON format
 func logGRPCJson(method string, request, reply interface{}, err error) {
 	// Log JSON with the request and response for easier parsing
@@ -166,7 +283,7 @@ func parse(ep string) (string, string, error) {
 	if strings.HasPrefix(strings.ToLower(ep), "unix://") || strings.HasPrefix(strings.ToLower(ep), "tcp://") {
 		s := strings.SplitN(ep, "://", 2)
 		if s[1] != "" {
-			return s[0], s[1], nil
+			return strings.ToLower(s[0]), s[1], nil
 		}
 		return "", "", fmt.Errorf("invalid endpoint: %v", ep)
 	}
@@ -174,7 +291,6 @@ func parse(ep string) (string, string, error) {
 	return "unix", ep, nil
 }
 
-
 func listen(endpoint string) (net.Listener, func(), error) {
 	proto, addr, err := parse(endpoint)
 	if err != nil {
@@ -182,14 +298,18 @@ func listen(endpoint string) (net.Listener, func(), error) {
 	}
 
 	cleanup := func() {}
-	if proto == "unix" {
-		addr = "/" + addr
-		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
-			return nil, nil, fmt.Errorf("%s: %q", addr, err)
-		}
-		cleanup = func() {
-			os.Remove(addr)
-		}
+	if proto == "tcp" {
+		klog.V(1).Infof("Starting tcp listener: %s", addr)
+		l, err := net.Listen("tcp", addr)
+		return l, cleanup, err
+	}
+
+	addr = "/" + addr
+	if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%s: %q", addr, err)
+	}
+	cleanup = func() {
+		os.Remove(addr)
 	}
 	klog.V(1).Infof("Starting domain socket: %s/%s", proto, addr)
 	l, err := net.Listen("unix", addr)
@@ -17,12 +17,36 @@ limitations under the License.
 package hostpath
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	klog "k8s.io/klog/v2"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
 )
 
 func Test_parse(t *testing.T) {
@@ -55,6 +79,13 @@ func Test_parse(t *testing.T) {
 			wantEp:     "10.10.10.10/test.sock",
 			wantErr:    nil,
 		},
+		{
+			name:       "uppercase tcp endpoint",
+			ep:         "TCP://10.10.10.10:9000",
+			wantScheme: "tcp",
+			wantEp:     "10.10.10.10:9000",
+			wantErr:    nil,
+		},
 		{
 			name:       "missing assume unix",
 			ep:         "test/test.sock",
@@ -90,4 +121,291 @@ func Test_listen(t *testing.T) {
 	defer closer()
 	defer listener.Close()
 	Expect(listener.Addr().Network()).To(Equal("unix"))
+
+	tcpListener, tcpCloser, err := listen("tcp://127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	defer tcpCloser()
+	defer tcpListener.Close()
+	Expect(tcpListener.Addr().Network()).To(Equal("tcp"))
+	Expect(tcpListener.Addr().String()).To(HavePrefix("127.0.0.1:"))
+}
+
+func Test_nonBlockingGRPCServerTLS(t *testing.T) {
+	RegisterTestingT(t)
+	tempDir := t.TempDir()
+	serverCA, serverCAPEM := newTestCA(t)
+	clientCA, clientCAPEM := newTestCA(t)
+	serverCert, serverKey := newTestCert(t, serverCA, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := newTestCert(t, clientCA, x509.ExtKeyUsageClientAuth)
+	Expect(os.WriteFile(filepath.Join(tempDir, "tls.crt"), serverCert, 0600)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(tempDir, "tls.key"), serverKey, 0600)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(tempDir, "ca.crt"), clientCAPEM, 0600)).To(Succeed())
+
+	tlsConfig, err := newGRPCServerTLSConfig(filepath.Join(tempDir, "tls.crt"), filepath.Join(tempDir, "tls.key"), filepath.Join(tempDir, "ca.crt"))
+	Expect(err).ToNot(HaveOccurred())
+
+	endpoint := fmt.Sprintf("tcp://127.0.0.1:%d", getFreePort(t))
+	s := NewNonBlockingGRPCServer()
+	Expect(s.Start(endpoint, tlsConfig, NewHostPathIdentity(&Config{DriverName: "test_driver", Version: "test_version"}), nil, nil)).To(Succeed())
+	defer s.ForceStop()
+
+	rootCAs := x509.NewCertPool()
+	Expect(rootCAs.AppendCertsFromPEM(serverCAPEM)).To(BeTrue())
+	getPluginInfo := func(certs ...tls.Certificate) error {
+		conn, err := grpc.NewClient(strings.TrimPrefix(endpoint, "tcp://"), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certs,
+			ServerName:   "localhost",
+		})))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = csi.NewIdentityClient(conn).GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+		return err
+	}
+
+	t.Run("client with certificate", func(t *testing.T) {
+		cert, err := tls.X509KeyPair(clientCert, clientKey)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getPluginInfo(cert)).To(Succeed())
+	})
+
+	t.Run("client without certificate", func(t *testing.T) {
+		Expect(getPluginInfo()).ToNot(Succeed())
+	})
+}
+
+func getFreePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to get free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newTestCA(t *testing.T) (*tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newTestCert(t *testing.T, ca *tls.Certificate, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{{127, 0, 0, 1}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &key.PublicKey, ca.PrivateKey)
+	Expect(err).ToNot(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func Test_metricsGRPC(t *testing.T) {
+	RegisterTestingT(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/Test_metricsGRPC"}
+
+	_, err := metricsGRPC(context.TODO(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		Expect(metrics.GetCSIOperationsInFlight(info.FullMethod)).To(BeEquivalentTo(1))
+		return nil, nil
+	})
+	Expect(err).ToNot(HaveOccurred())
+	_, err = metricsGRPC(context.TODO(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	Expect(err).To(HaveOccurred())
+
+	Expect(metrics.GetCSIOperationsInFlight(info.FullMethod)).To(BeEquivalentTo(0))
+	Expect(metrics.GetCSIOperations(info.FullMethod, codes.OK.String())).To(BeEquivalentTo(1))
+	Expect(metrics.GetCSIOperations(info.FullMethod, codes.NotFound.String())).To(BeEquivalentTo(1))
+	Expect(metrics.GetCSIOperationDurationCount(info.FullMethod)).To(BeEquivalentTo(2))
+}
+
+func Test_requestLogValues(t *testing.T) {
+	RegisterTestingT(t)
+	tests := []struct {
+		name     string
+		req      interface{}
+		expected []interface{}
+	}{
+		{
+			name: "create volume from snapshot",
+			req: &csi.CreateVolumeRequest{
+				Name:       "pvc-1",
+				Parameters: map[string]string{storagePoolName: "fast"},
+				VolumeContentSource: &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "snap-1"}},
+				},
+			},
+			expected: []interface{}{"volumeID", "pvc-1", "snapshotID", "snap-1", "pool", "fast"},
+		},
+		{
+			name:     "create snapshot",
+			req:      &csi.CreateSnapshotRequest{Name: "snap-1", SourceVolumeId: "pvc-1"},
+			expected: []interface{}{"volumeID", "pvc-1", "snapshotID", "snap-1"},
+		},
+		{
+			name:     "node publish",
+			req:      &csi.NodePublishVolumeRequest{VolumeId: "pvc-1", VolumeContext: map[string]string{storagePoolName: "fast"}},
+			expected: []interface{}{"volumeID", "pvc-1", "pool", "fast"},
+		},
+		{
+			name:     "delete snapshot",
+			req:      &csi.DeleteSnapshotRequest{SnapshotId: "snap-1"},
+			expected: []interface{}{"snapshotID", "snap-1"},
+		},
+		{
+			name:     "probe",
+			req:      &csi.ProbeRequest{},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Expect(requestLogValues(tt.req)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func Test_logGRPC(t *testing.T) {
+	RegisterTestingT(t)
+	buf := &bytes.Buffer{}
+	ctx := klog.NewContext(context.TODO(), newJSONLogger(buf, 0))
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/DeleteVolume"}
+
+	_, err := logGRPC(ctx, &csi.DeleteVolumeRequest{VolumeId: "pvc-1"}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		klog.FromContext(ctx).Info("Deleting volume")
+		return nil, nil
+	})
+	Expect(err).ToNot(HaveOccurred())
+	entry := map[string]interface{}{}
+	Expect(json.Unmarshal(buf.Bytes(), &entry)).To(Succeed())
+	Expect(entry).To(HaveKeyWithValue("msg", "Deleting volume"))
+	Expect(entry).To(HaveKeyWithValue("method", info.FullMethod))
+	Expect(entry).To(HaveKeyWithValue("volumeID", "pvc-1"))
+	Expect(entry).To(HaveKey("requestID"))
+}
+
+func Test_recoverGRPC(t *testing.T) {
+	RegisterTestingT(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/Test_recoverGRPC"}
+
+	resp, err := recoverGRPC(context.TODO(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		var pool *StoragePoolInfo
+		return pool.Path, nil
+	})
+	Expect(resp).To(BeNil())
+	Expect(status.Code(err)).To(Equal(codes.Internal))
+	Expect(metrics.GetCSIPanics(info.FullMethod)).To(BeEquivalentTo(1))
+
+	resp, err = recoverGRPC(context.TODO(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp).To(Equal("ok"))
+	Expect(metrics.GetCSIPanics(info.FullMethod)).To(BeEquivalentTo(1))
+}
+
+func Test_validateGRPC(t *testing.T) {
+	RegisterTestingT(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/DeleteVolume"}
+	called := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	_, err := validateGRPC(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: "../etc"}, info, handler)
+	Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	Expect(called).To(BeFalse())
+
+	_, err = validateGRPC(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: "pvc-1"}, info, handler)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(called).To(BeTrue())
+}
+
+type blockingIdentityServer struct {
+	csi.UnimplementedIdentityServer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingIdentityServer) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	close(b.started)
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+	}
+	return &csi.ProbeResponse{}, nil
+}
+
+func Test_nonBlockingGRPCServerStop(t *testing.T) {
+	RegisterTestingT(t)
+
+	startProbe := func(socket string) (*blockingIdentityServer, *nonBlockingGRPCServer, chan error) {
+		ids := &blockingIdentityServer{started: make(chan struct{}), release: make(chan struct{})}
+		s := NewNonBlockingGRPCServer()
+		Expect(s.Start("unix:/"+socket, nil, ids, nil, nil)).To(Succeed())
+		conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		t.Cleanup(func() { conn.Close() })
+		result := make(chan error, 1)
+		go func() {
+			_, err := csi.NewIdentityClient(conn).Probe(context.Background(), &csi.ProbeRequest{})
+			result <- err
+		}()
+		Eventually(ids.started).Should(BeClosed())
+		return ids, s, result
+	}
+
+	t.Run("in flight call completes", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "test.sock")
+		ids, s, result := startProbe(socket)
+
+		stopped := make(chan struct{})
+		go func() {
+			s.Stop(time.Minute)
+			close(stopped)
+		}()
+		Consistently(stopped, 200*time.Millisecond).ShouldNot(BeClosed())
+		close(ids.release)
+		Eventually(stopped).Should(BeClosed())
+		Expect(<-result).ToNot(HaveOccurred())
+		Expect(s.Wait()).To(Succeed())
+		_, err := os.Stat(socket)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	t.Run("in flight call exceeds timeout", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "test.sock")
+		_, s, result := startProbe(socket)
+
+		s.Stop(100 * time.Millisecond)
+		Expect(<-result).To(HaveOccurred())
+		_, err := os.Stat(socket)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
 }
@@ -264,3 +264,45 @@ func Test_getTLSVersion(t *testing.T) {
 		})
 	}
 }
+
+func Test_getCipherSuites(t *testing.T) {
+	RegisterTestingT(t)
+
+	tests := []struct {
+		name       string
+		suites     []string
+		wantSuites []uint16
+		wantErr    bool
+	}{
+		{
+			name: "no cipher suites",
+		},
+		{
+			name:       "valid cipher suites",
+			suites:     []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+			wantSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		},
+		{
+			name:    "insecure cipher suite",
+			suites:  []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown cipher suite",
+			suites:  []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "invalid"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := getCipherSuites(tt.suites)
+			if tt.wantErr {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result).To(Equal(tt.wantSuites))
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "kubevirt.io/hostpath-provisioner/pkg/hostpath"
+
+// TracingConfig is the configuration of the OpenTelemetry tracing of the driver.
+type TracingConfig struct {
+	// Endpoint is the host:port of the OTLP gRPC collector. Tracing is
+	// disabled when empty.
+	Endpoint string
+	// Insecure disables TLS for the connection to the collector.
+	Insecure bool
+	// SamplingRatio is the fraction of new traces that are sampled, between 0 and 1.
+	// Traces started by the caller, for instance a sidecar, follow the sampling
+	// decision of the caller.
+	SamplingRatio float64
+	// ServiceName and ServiceVersion identify the driver in the traces.
+	ServiceName    string
+	ServiceVersion string
+}
+
+// SetupTracing configures W3C trace context propagation and, when an endpoint
+// is set, exports the spans to an OTLP collector. Without an endpoint the no-op
+// tracer provider stays in place. The returned function flushes the pending
+// spans and stops the exporter.
+func SetupTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if cfg.SamplingRatio < 0 || cfg.SamplingRatio > 1 {
+		return nil, fmt.Errorf("tracing sampling ratio %v must be between 0 and 1", cfg.SamplingRatio)
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	tp := newTracerProvider(sdktrace.WithBatcher(exporter), cfg)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func newTracerProvider(processor sdktrace.TracerProviderOption, cfg TracingConfig) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+			semconv.ServiceVersion(cfg.ServiceVersion),
+		)),
+	)
+}
+
+// startSpan starts a child span of the span in ctx, if any.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on the span, if set, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// setupTestTracing installs a tracer provider recording the spans in memory
+// for the duration of the test.
+func setupTestTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := newTracerProvider(sdktrace.WithSyncer(exporter), TracingConfig{SamplingRatio: 1, ServiceName: "test_driver"})
+	oldProvider := otel.GetTracerProvider()
+	oldPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	_, err := SetupTracing(context.TODO(), TracingConfig{})
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.TODO())
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+	return exporter
+}
+
+func Test_SetupTracing(t *testing.T) {
+	RegisterTestingT(t)
+	oldPropagator := otel.GetTextMapPropagator()
+	defer otel.SetTextMapPropagator(oldPropagator)
+
+	shutdown, err := SetupTracing(context.TODO(), TracingConfig{})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(shutdown(context.TODO())).To(Succeed())
+	Expect(otel.GetTextMapPropagator().Fields()).To(ContainElement("traceparent"))
+
+	_, err = SetupTracing(context.TODO(), TracingConfig{Endpoint: "localhost:4317", SamplingRatio: 2})
+	Expect(err).To(MatchError(ContainSubstring("must be between 0 and 1")))
+}
+
+func Test_copyReflinkSpan(t *testing.T) {
+	RegisterTestingT(t)
+	exporter := setupTestTracing(t)
+	oldCopyReflinkFunc := CopyReflinkFunc
+	defer func() {
+		CopyReflinkFunc = oldCopyReflinkFunc
+	}()
+	CopyReflinkFunc = func(src, dst string) error {
+		return errors.New("copy failed")
+	}
+
+	ctx, parent := startSpan(context.TODO(), "parent")
+	Expect(copyReflink(ctx, "/source", "/target")).ToNot(Succeed())
+	Expect(removeAll(ctx, t.TempDir())).To(Succeed())
+	parent.End()
+
+	spans := exporter.GetSpans()
+	Expect(spans).To(HaveLen(3))
+	Expect(spans[0].Name).To(Equal("CopyReflink"))
+	Expect(spans[0].Parent.SpanID()).To(Equal(parent.SpanContext().SpanID()))
+	Expect(spans[0].Status.Code).To(Equal(codes.Error))
+	Expect(spans[1].Name).To(Equal("RemoveAll"))
+	Expect(spans[1].Parent.SpanID()).To(Equal(parent.SpanContext().SpanID()))
+	Expect(spans[1].Status.Code).To(Equal(codes.Unset))
+}
+
+func Test_nonBlockingGRPCServerTracing(t *testing.T) {
+	RegisterTestingT(t)
+	exporter := setupTestTracing(t)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", getFreePort(t))
+	s := NewNonBlockingGRPCServer()
+	Expect(s.Start("tcp://"+addr, nil, NewHostPathIdentity(&Config{DriverName: "test_driver", Version: "test_version"}), nil, nil)).To(Succeed())
+	defer s.ForceStop()
+
+	// The client propagates the trace context like the sidecars do.
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	Expect(err).ToNot(HaveOccurred())
+	defer conn.Close()
+	ctx, parent := startSpan(context.TODO(), "sidecar")
+	_, err = csi.NewIdentityClient(conn).GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+	Expect(err).ToNot(HaveOccurred())
+	parent.End()
+
+	// The server span ends after the response was sent.
+	var serverSpan *tracetest.SpanStub
+	Eventually(func() *tracetest.SpanStub {
+		for _, span := range exporter.GetSpans() {
+			if span.Name == "csi.v1.Identity/GetPluginInfo" && span.SpanKind.String() == "server" {
+				serverSpan = &span
+			}
+		}
+		return serverSpan
+	}).ShouldNot(BeNil())
+	Expect(serverSpan.SpanContext.TraceID()).To(Equal(parent.SpanContext().TraceID()))
+	Expect(serverSpan.Parent.IsRemote()).To(BeTrue())
+}
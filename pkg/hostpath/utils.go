@@ -16,10 +16,10 @@ limitations under the License.
 package hostpath
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -29,7 +29,7 @@ import (
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/klog/v2"
 
 	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
@@ -84,33 +84,38 @@ func roundDownCapacityPretty(capacityBytes int64) int64 {
 // CreateSnapshotDirectory allocates creates the directory for the hostpath snapshot
 //
 // It returns the err if one occurs. That error is suitable as result of a gRPC call.
-func CreateSnapshotDirectory(base, snapID string) error {
-	return CreateVolumeDirectory(base, snapID)
+func CreateSnapshotDirectory(ctx context.Context, base, snapID string) error {
+	return CreateVolumeDirectory(ctx, base, snapID)
 }
 
 // It returns the err if one occurs. That error is suitable as result of a gRPC call.
-func createVolumeDirectoryFunc(base, volID string) error {
-	path := filepath.Join(base, volID)
-
-	err := os.MkdirAll(path, 0777)
+func createVolumeDirectoryFunc(ctx context.Context, base, volID string) error {
+	path, err := resolveBeneath(base, volID)
 	if err != nil {
 		return err
 	}
-	klog.V(4).Infof("adding hostpath volume: %s", volID)
+
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return err
+	}
+	klog.FromContext(ctx).V(4).Info("Added hostpath volume", "path", path)
 	return nil
 }
 
 // DeleteVolume deletes the directory for the hostpath volume.
 //
 // It returns the err if one occurs. That error is suitable as result of a gRPC call.
-func DeleteVolume(base, volID string) error {
-	klog.V(4).Infof("starting to delete hostpath volume: %s", volID)
-
-	path := filepath.Join(base, volID)
-	if err := os.RemoveAll(path); err != nil && !os.IsNotExist(err) {
+func DeleteVolume(ctx context.Context, base, volID string) error {
+	path, err := resolveBeneath(base, volID)
+	if err != nil {
+		return err
+	}
+	logger := klog.FromContext(ctx).WithValues("path", path)
+	logger.V(4).Info("Deleting hostpath volume")
+	if err := removeAll(ctx, path); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	klog.V(4).Infof("deleted hostpath volume: %s", volID)
+	logger.V(4).Info("Deleted hostpath volume")
 	return nil
 }
 
@@ -154,8 +159,14 @@ func getStoragePoolNameFromMap(params map[string]string) string {
 	return legacyStoragePoolName
 }
 
-func getStoragePoolDataDirectories(storagePoolInfo map[string]StoragePoolInfo) ([]string, error) {
-	directories := make([]string, 0)
+func getStoragePoolDataDirectories(ctx context.Context, storagePoolInfo map[string]StoragePoolInfo) (directories []string, err error) {
+	_, span := startSpan(ctx, "GetStoragePoolDataDirectories", attribute.Int("pools", len(storagePoolInfo)))
+	defer func() {
+		span.SetAttributes(attribute.Int("directories", len(directories)))
+		endSpan(span, err)
+	}()
+
+	directories = make([]string, 0)
 	for _, info := range storagePoolInfo {
 		files, err := os.ReadDir(info.Path)
 		if err != nil {
@@ -188,74 +199,33 @@ func getTLSVersion(versionName string) *uint16 {
 	return nil
 }
 
-// RunPrometheusServer runs a prometheus server for metrics with TLS support.
-// If certFile and keyFile are provided, they will be used for TLS.
-// Otherwise, a self-signed certificate will be generated automatically.
-// tlsVersion should be "VersionTLS10", "VersionTLS11", "VersionTLS12", or "VersionTLS13" (default: "VersionTLS13").
-func RunPrometheusServer(metricsAddr, certFile, keyFile, tlsVersion string) {
-	err := metrics.SetupMetrics()
-	if err != nil {
-		klog.Error(err, "Failed to Setup Prometheus metrics")
+// getCipherSuites converts cipher suite names to their crypto/tls IDs. Only the
+// cipher suites considered secure by crypto/tls are accepted.
+func getCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
 	}
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-
-	server := &http.Server{
-		Addr:    metricsAddr,
-		Handler: mux,
-	}
-
-	// Validate certificate configuration
-	certProvided := certFile != ""
-	keyProvided := keyFile != ""
-	if certProvided != keyProvided {
-		klog.Warningf("Partial TLS certificate configuration: cert=%q, key=%q. Both --metrics-cert-file and --metrics-key-file must be provided together. Falling back to self-signed certificate.", certFile, keyFile)
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
 	}
-
-	// Parse TLS version (maps string name to crypto/tls MinVersion constant)
-	minTLSVersion := getTLSVersion(tlsVersion)
-	if minTLSVersion == nil {
-		klog.Warningf("Invalid TLS version '%s', defaulting to TLS 1.3", tlsVersion)
-		defaultVersion := uint16(tls.VersionTLS13)
-		minTLSVersion = &defaultVersion
-	}
-
-	// Configure TLS
-	tlsConfig := &tls.Config{
-		MinVersion: *minTLSVersion,
-	}
-
-	// If cert and key files are provided, use them
-	if certProvided && keyProvided {
-		klog.V(1).Infof("Using provided certificates for metrics server: cert=%s, key=%s", certFile, keyFile)
-		server.TLSConfig = tlsConfig
-	} else {
-		// Generate self-signed certificate
-		klog.V(1).Info("Generating self-signed certificate for metrics server")
-		cert, err := generateSelfSignedCert()
-		if err != nil {
-			klog.Error(err, "Failed to generate self-signed certificate for metrics server")
-			return
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := suites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
 		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
-		server.TLSConfig = tlsConfig
+		ids = append(ids, id)
 	}
+	return ids, nil
+}
 
-	go func() {
-		var err error
-		if certProvided && keyProvided {
-			err = server.ListenAndServeTLS(certFile, keyFile)
-		} else {
-			// Use the self-signed cert from TLSConfig
-			err = server.ListenAndServeTLS("", "")
-		}
-		if err != nil && err != http.ErrServerClosed {
-			klog.Error(err, "Failed to start Prometheus metrics endpoint server")
-		}
+func getMountInfos(ctx context.Context, args ...string) (mountInfos []MountPointInfo, err error) {
+	_, span := startSpan(ctx, "FindMnt", attribute.StringSlice("args", args))
+	defer func() {
+		endSpan(span, err)
 	}()
-}
 
-func getMountInfos(args ...string) ([]MountPointInfo, error) {
 	cmdPath, err := exec.LookPath("findmnt")
 	if err != nil {
 		return nil, fmt.Errorf("findmnt not found: %w", err)
@@ -271,7 +241,7 @@ func getMountInfos(args ...string) ([]MountPointInfo, error) {
 		return nil, fmt.Errorf("mount point info is nil")
 	}
 
-	mountInfos, err := parseMountInfo([]byte(out))
+	mountInfos, err = parseMountInfo([]byte(out))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse the mount infos: %+v", err)
 	}
@@ -279,13 +249,13 @@ func getMountInfos(args ...string) ([]MountPointInfo, error) {
 	return mountInfos, nil
 }
 
-func checkVolumePathSharedWithOS(volumePath string) bool {
-	mountInfosForPath, err := getMountInfos("-T", volumePath)
+func checkVolumePathSharedWithOS(ctx context.Context, volumePath string) bool {
+	mountInfosForPath, err := getMountInfos(ctx, "-T", volumePath)
 	if err != nil {
 		return false
 	}
 
-	mountInfosForCsiSocketDir, err := getMountInfos("-T", csiSocketDir)
+	mountInfosForCsiSocketDir, err := getMountInfos(ctx, "-T", csiSocketDir)
 	if err != nil {
 		return false
 	}
@@ -308,14 +278,15 @@ func extractDeviceFromMountInfoSource(source string) string {
 }
 
 func evaluateSharedPathMetric(storagePoolDataDir map[string]StoragePoolInfo) {
+	ctx := context.Background()
 	pathShared := false
 	for k, v := range storagePoolDataDir {
-		if checkVolumePathSharedWithOS(v.Path) {
+		if checkVolumePathSharedWithOS(ctx, v.Path) {
 			pathShared = true
 			klog.V(1).Infof("pool (%s, %s), shares path with OS which can lead to node disk pressure", k, v.Path)
 		}
 		if v.SnapshotPath != nil {
-			if checkVolumePathSharedWithOS(*v.SnapshotPath) {
+			if checkVolumePathSharedWithOS(ctx, *v.SnapshotPath) {
 				pathShared = true
 				klog.V(1).Infof("pool (%s, %s), shares path with OS which can lead to node disk pressure", k, *v.SnapshotPath)
 			}
@@ -342,6 +313,15 @@ func checkPathIsEmptyFunc(path string) (bool, error) {
 	return true, nil
 }
 
+// removeAll removes path and any children it contains, in a span as it can
+// take a long time for large volumes.
+func removeAll(ctx context.Context, path string) error {
+	_, span := startSpan(ctx, "RemoveAll", attribute.String("path", path))
+	err := os.RemoveAll(path)
+	endSpan(span, err)
+	return err
+}
+
 func getFileCreationTimeFunc(file string) (*time.Time, error) {
 	var stat syscall.Stat_t
 	err := syscall.Stat(file, &stat)
@@ -17,6 +17,7 @@ limitations under the License.
 package hostpath
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -106,7 +107,7 @@ func Test_UtilCreateVolume(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := CreateVolumeDirectory(tt.base, tt.volId)
+			err := CreateVolumeDirectory(context.TODO(), tt.base, tt.volId)
 			res := err != nil
 			Expect(res).To(Equal(tt.want), "CreateVolume(%s, %s), returned %v, want %v", tt.base, tt.volId, res, tt.want)
 		})
@@ -122,13 +123,13 @@ func Test_DeleteVolume(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	t.Run("validVolId", func(t *testing.T) {
-		err := CreateVolumeDirectory(tempDir, validVolId)
+		err := CreateVolumeDirectory(context.TODO(), tempDir, validVolId)
 		Expect(err).ToNot(HaveOccurred())
-		err = DeleteVolume(tempDir, validVolId)
+		err = DeleteVolume(context.TODO(), tempDir, validVolId)
 		Expect(err).ToNot(HaveOccurred())
 	})
 	t.Run("invalidVolId", func(t *testing.T) {
-		err = DeleteVolume("/dev", "null")
+		err = DeleteVolume(context.TODO(), "/dev", "null")
 		Expect(err).To(HaveOccurred())
 	})
 }
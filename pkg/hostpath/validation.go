@@ -0,0 +1,105 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validateRequest checks that the IDs a CSI request requires are set, and that
+// all the IDs in it are safe to use as a directory name in a storage pool.
+func validateRequest(req interface{}) error {
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		if err := validateID("name", r.GetName(), true); err != nil {
+			return err
+		}
+		return validateID("snapshot ID", r.GetVolumeContentSource().GetSnapshot().GetSnapshotId(), false)
+	case *csi.DeleteVolumeRequest:
+		return validateID("volume ID", r.GetVolumeId(), true)
+	case *csi.ValidateVolumeCapabilitiesRequest:
+		return validateID("volume ID", r.GetVolumeId(), true)
+	case *csi.ControllerGetVolumeRequest:
+		return validateID("volume ID", r.GetVolumeId(), true)
+	case *csi.ControllerModifyVolumeRequest:
+		return validateID("volume ID", r.GetVolumeId(), true)
+	case *csi.CreateSnapshotRequest:
+		if err := validateID("name", r.GetName(), true); err != nil {
+			return err
+		}
+		return validateID("source volume ID", r.GetSourceVolumeId(), true)
+	case *csi.DeleteSnapshotRequest:
+		return validateID("snapshot ID", r.GetSnapshotId(), true)
+	case *csi.ListSnapshotsRequest:
+		if err := validateID("snapshot ID", r.GetSnapshotId(), false); err != nil {
+			return err
+		}
+		return validateID("source volume ID", r.GetSourceVolumeId(), false)
+	case *csi.NodePublishVolumeRequest:
+		if err := validateID("volume ID", r.GetVolumeId(), true); err != nil {
+			return err
+		}
+		return validatePath("target path", r.GetTargetPath())
+	case *csi.NodeUnpublishVolumeRequest:
+		if err := validateID("volume ID", r.GetVolumeId(), true); err != nil {
+			return err
+		}
+		return validatePath("target path", r.GetTargetPath())
+	case *csi.NodeGetVolumeStatsRequest:
+		if err := validateID("volume ID", r.GetVolumeId(), true); err != nil {
+			return err
+		}
+		return validatePath("volume path", r.GetVolumePath())
+	}
+	return nil
+}
+
+// validateID makes sure id is a single path element, so joining it with the
+// path of a storage pool cannot escape the pool.
+func validateID(field, id string, required bool) error {
+	if id == "" {
+		if required {
+			return status.Errorf(codes.InvalidArgument, "%s missing in request", field)
+		}
+		return nil
+	}
+	if !isPathElement(id) {
+		return status.Errorf(codes.InvalidArgument, "%s %q must not be a path", field, id)
+	}
+	return nil
+}
+
+// validatePath makes sure the path set by the container orchestrator does not
+// traverse upwards.
+func validatePath(field, path string) error {
+	if path == "" {
+		return status.Errorf(codes.InvalidArgument, "%s missing in request", field)
+	}
+	if strings.Contains(path, "\x00") {
+		return status.Errorf(codes.InvalidArgument, "%s %q must not contain NUL", field, path)
+	}
+	for _, element := range strings.Split(path, "/") {
+		if element == ".." {
+			return status.Errorf(codes.InvalidArgument, "%s %q must not contain ..", field, path)
+		}
+	}
+	return nil
+}
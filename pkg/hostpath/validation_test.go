@@ -0,0 +1,72 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_validateRequest(t *testing.T) {
+	RegisterTestingT(t)
+	tests := []struct {
+		name    string
+		req     interface{}
+		wantErr bool
+	}{
+		{"create volume", &csi.CreateVolumeRequest{Name: "pvc-1"}, false},
+		{"create volume without name", &csi.CreateVolumeRequest{}, true},
+		{"create volume with traversal", &csi.CreateVolumeRequest{Name: ".."}, true},
+		{"create volume with separator", &csi.CreateVolumeRequest{Name: "a/b"}, true},
+		{"create volume with absolute path", &csi.CreateVolumeRequest{Name: "/etc"}, true},
+		{"create volume from unsafe snapshot", &csi.CreateVolumeRequest{
+			Name: "pvc-1",
+			VolumeContentSource: &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "../snap"}},
+			},
+		}, true},
+		{"delete volume", &csi.DeleteVolumeRequest{VolumeId: "pvc-1"}, false},
+		{"delete volume without ID", &csi.DeleteVolumeRequest{}, true},
+		{"delete volume with nul", &csi.DeleteVolumeRequest{VolumeId: "pvc\x00"}, true},
+		{"get volume with traversal", &csi.ControllerGetVolumeRequest{VolumeId: "."}, true},
+		{"modify volume with traversal", &csi.ControllerModifyVolumeRequest{VolumeId: "../pvc"}, true},
+		{"create snapshot without source", &csi.CreateSnapshotRequest{Name: "snap-1"}, true},
+		{"create snapshot", &csi.CreateSnapshotRequest{Name: "snap-1", SourceVolumeId: "pvc-1"}, false},
+		{"delete snapshot with traversal", &csi.DeleteSnapshotRequest{SnapshotId: ".."}, true},
+		{"list all snapshots", &csi.ListSnapshotsRequest{}, false},
+		{"list snapshots of unsafe volume", &csi.ListSnapshotsRequest{SourceVolumeId: "../pvc"}, true},
+		{"node publish", &csi.NodePublishVolumeRequest{VolumeId: "pvc-1", TargetPath: "/var/lib/kubelet/pods/uid/volumes/mount"}, false},
+		{"node publish traversing target", &csi.NodePublishVolumeRequest{VolumeId: "pvc-1", TargetPath: "/var/lib/../../etc"}, true},
+		{"node unpublish without target", &csi.NodeUnpublishVolumeRequest{VolumeId: "pvc-1"}, true},
+		{"node volume stats", &csi.NodeGetVolumeStatsRequest{VolumeId: "pvc-1", VolumePath: "/var/lib/kubelet/pods/uid/volumes/mount"}, false},
+		{"probe", &csi.ProbeRequest{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequest(tt.req)
+			if tt.wantErr {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
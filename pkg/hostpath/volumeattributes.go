@@ -0,0 +1,230 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// The mutable parameters of a volume, set at creation or changed later by a
+// VolumeAttributesClass.
+const (
+	// attributeMode is the octal permission mode of the volume directory.
+	attributeMode = "mode"
+	// attributeUID and attributeGID are the owner of the volume directory.
+	attributeUID = "uid"
+	attributeGID = "gid"
+	// The I/O limits of the volume, applied by the node when the volume is
+	// published.
+	attributeReadIOPS  = "readIOPS"
+	attributeWriteIOPS = "writeIOPS"
+	attributeReadBPS   = "readBytesPerSecond"
+	attributeWriteBPS  = "writeBytesPerSecond"
+
+	// volumeAttributesSuffix is the suffix of the file next to the volume
+	// directory the mutable parameters are persisted in.
+	volumeAttributesSuffix = ".attributes.json"
+)
+
+// mutableParameters is the allow-list of mutable parameters, with the
+// validation of their values. Quotas and trash retention are not in it, the
+// driver enforces no quota and keeps no trash of deleted volumes.
+var mutableParameters = map[string]func(string) error{
+	attributeMode:      validateModeAttribute,
+	attributeUID:       validateOwnerAttribute,
+	attributeGID:       validateOwnerAttribute,
+	attributeReadIOPS:  validateLimitAttribute,
+	attributeWriteIOPS: validateLimitAttribute,
+	attributeReadBPS:   validateLimitAttribute,
+	attributeWriteBPS:  validateLimitAttribute,
+}
+
+func validateModeAttribute(value string) error {
+	if mode, err := strconv.ParseUint(value, 8, 32); err != nil || mode > 07777 {
+		return fmt.Errorf("%q is not an octal mode", value)
+	}
+	return nil
+}
+
+func validateOwnerAttribute(value string) error {
+	if id, err := strconv.ParseUint(value, 10, 32); err != nil || id > math.MaxInt32 {
+		return fmt.Errorf("%q is not a user or group ID", value)
+	}
+	return nil
+}
+
+func validateLimitAttribute(value string) error {
+	if limit, err := strconv.ParseUint(value, 10, 64); err != nil || limit == 0 {
+		return fmt.Errorf("%q is not a positive integer", value)
+	}
+	return nil
+}
+
+// validateMutableParameters returns an InvalidArgument error when a parameter
+// is not in the allow-list, or has an invalid value.
+func validateMutableParameters(params map[string]string) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		validate, ok := mutableParameters[key]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "parameter %s cannot be modified", key)
+		}
+		if err := validate(params[key]); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid parameter %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// volumeAttributesPath returns the path of the file the mutable parameters
+// of the volume are persisted in, hidden next to its directory in the pool.
+func volumeAttributesPath(base, volID string) (string, error) {
+	return resolveBeneath(base, "."+volID+volumeAttributesSuffix)
+}
+
+// readVolumeAttributes returns the mutable parameters persisted for the
+// volume, none when they were never set.
+func readVolumeAttributes(base, volID string) (map[string]string, error) {
+	path, err := volumeAttributesPath(base, volID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	attributes := make(map[string]string)
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	return attributes, nil
+}
+
+// writeVolumeAttributes persists the mutable parameters of the volume,
+// replacing the file so it is never read half written.
+func writeVolumeAttributes(base, volID string, attributes map[string]string) error {
+	path, err := volumeAttributesPath(base, volID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(base, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeVolumeAttributes removes the mutable parameters persisted for the
+// volume.
+func removeVolumeAttributes(base, volID string) error {
+	path, err := volumeAttributesPath(base, volID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// modifyVolume merges the validated params into the mutable parameters of
+// the volume directory at path, applies the mode and owner to the directory,
+// and persists them.
+func modifyVolume(ctx context.Context, path string, params map[string]string) error {
+	base, volID := filepath.Dir(path), filepath.Base(path)
+	attributes, err := readVolumeAttributes(base, volID)
+	if err != nil {
+		return err
+	}
+	for key, value := range params {
+		attributes[key] = value
+	}
+	if err := applyVolumeAttributes(path, attributes); err != nil {
+		return fmt.Errorf("failed to modify volume %s: %w", volID, err)
+	}
+	if err := writeVolumeAttributes(base, volID, attributes); err != nil {
+		return fmt.Errorf("failed to persist parameters of volume %s: %w", volID, err)
+	}
+	klog.FromContext(ctx).V(4).Info("Modified volume", "path", path, "attributes", attributes)
+	return nil
+}
+
+// applyVolumeAttributes sets the mode and owner of the volume directory. The
+// I/O limits are applied by the node.
+func applyVolumeAttributes(path string, attributes map[string]string) error {
+	if value, ok := attributes[attributeMode]; ok {
+		mode, _ := strconv.ParseUint(value, 8, 32)
+		if err := os.Chmod(path, fileModeOf(uint32(mode))); err != nil {
+			return err
+		}
+	}
+	uid, gid := -1, -1
+	if value, ok := attributes[attributeUID]; ok {
+		uid, _ = strconv.Atoi(value)
+	}
+	if value, ok := attributes[attributeGID]; ok {
+		gid, _ = strconv.Atoi(value)
+	}
+	if uid != -1 || gid != -1 {
+		return os.Chown(path, uid, gid)
+	}
+	return nil
+}
+
+// fileModeOf converts the unix permission bits in mode to an os.FileMode.
+func fileModeOf(mode uint32) os.FileMode {
+	fileMode := os.FileMode(mode & 0777)
+	if mode&01000 != 0 {
+		fileMode |= os.ModeSticky
+	}
+	if mode&02000 != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if mode&04000 != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	return fileMode
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2026 The hostpath provisioner Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostpath
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_validateMutableParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"all", map[string]string{
+			attributeMode:      "0750",
+			attributeUID:       "107",
+			attributeGID:       "107",
+			attributeReadIOPS:  "1000",
+			attributeWriteIOPS: "500",
+			attributeReadBPS:   "104857600",
+			attributeWriteBPS:  "52428800",
+		}, false},
+		{"sticky mode", map[string]string{attributeMode: "1777"}, false},
+		{"decimal mode", map[string]string{attributeMode: "999"}, true},
+		{"mode out of range", map[string]string{attributeMode: "17777"}, true},
+		{"negative uid", map[string]string{attributeUID: "-1"}, true},
+		{"gid out of range", map[string]string{attributeGID: "4294967296"}, true},
+		{"zero limit", map[string]string{attributeReadIOPS: "0"}, true},
+		{"limit with unit", map[string]string{attributeWriteBPS: "10Mi"}, true},
+		{"quota", map[string]string{"quota": "10Gi"}, true},
+		{"storage pool", map[string]string{"storagePool": "fast"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RegisterTestingT(t)
+			err := validateMutableParameters(tt.params)
+			if tt.wantErr {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func Test_volumeAttributes(t *testing.T) {
+	RegisterTestingT(t)
+	dir := t.TempDir()
+	attributes, err := readVolumeAttributes(dir, "pvc-1")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(attributes).To(BeEmpty())
+
+	want := map[string]string{attributeReadIOPS: "100"}
+	Expect(writeVolumeAttributes(dir, "pvc-1", want)).To(Succeed())
+	attributes, err = readVolumeAttributes(dir, "pvc-1")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(attributes).To(Equal(want))
+	entries, err := os.ReadDir(dir)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(entries).To(HaveLen(1))
+	Expect(entries[0].Name()).To(Equal(".pvc-1.attributes.json"))
+
+	Expect(removeVolumeAttributes(dir, "pvc-1")).To(Succeed())
+	Expect(removeVolumeAttributes(dir, "pvc-1")).To(Succeed())
+	entries, err = os.ReadDir(dir)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(entries).To(BeEmpty())
+}
+
+func Test_fileModeOf(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(fileModeOf(0750)).To(Equal(os.FileMode(0750)))
+	Expect(fileModeOf(01777)).To(Equal(os.FileMode(0777) | os.ModeSticky))
+	Expect(fileModeOf(06755)).To(Equal(os.FileMode(0755) | os.ModeSetuid | os.ModeSetgid))
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ioprometheusclient "github.com/prometheus/client_model/go"
+	"github.com/rhobs/operator-observability-toolkit/pkg/operatormetrics"
+)
+
+var (
+	csiMetrics = []operatormetrics.Metric{
+		csiOperations,
+		csiOperationDuration,
+		csiOperationsInFlight,
+		csiPanics,
+	}
+
+	csiOperations = operatormetrics.NewCounterVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_csi_operations_total",
+			Help: "Total number of CSI gRPC calls handled by the HPP CSI driver, by method and gRPC status code",
+		},
+		[]string{"method", "grpc_code"},
+	)
+
+	csiOperationDuration = operatormetrics.NewHistogramVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_csi_operation_duration_seconds",
+			Help: "Duration in seconds of CSI gRPC calls handled by the HPP CSI driver, by method",
+		},
+		prometheus.HistogramOpts{
+			// Snapshots and restores copy whole volumes, so go up to roughly half an hour.
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+		},
+		[]string{"method"},
+	)
+
+	csiPanics = operatormetrics.NewCounterVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_csi_panics_total",
+			Help: "Total number of panics recovered while handling CSI gRPC calls in the HPP CSI driver, by method",
+		},
+		[]string{"method"},
+	)
+
+	csiOperationsInFlight = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_csi_operations_in_flight",
+			Help: "Number of CSI gRPC calls currently being handled by the HPP CSI driver, by method",
+		},
+		[]string{"method"},
+	)
+)
+
+// StartCSIOperation marks a CSI call to the method as in flight, and returns
+// a function that records its outcome and duration once it completes.
+func StartCSIOperation(method string) func(code string) {
+	start := time.Now()
+	csiOperationsInFlight.WithLabelValues(method).Inc()
+	return func(code string) {
+		csiOperationsInFlight.WithLabelValues(method).Dec()
+		csiOperationDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		csiOperations.WithLabelValues(method, code).Inc()
+	}
+}
+
+// IncCSIPanics records a panic recovered while handling a CSI call to the method.
+func IncCSIPanics(method string) {
+	csiPanics.WithLabelValues(method).Inc()
+}
+
+func GetCSIPanics(method string) float64 {
+	dto := &ioprometheusclient.Metric{}
+	csiPanics.WithLabelValues(method).Write(dto)
+	return dto.GetCounter().GetValue()
+}
+
+func GetCSIOperations(method, code string) float64 {
+	dto := &ioprometheusclient.Metric{}
+	csiOperations.WithLabelValues(method, code).Write(dto)
+	return dto.GetCounter().GetValue()
+}
+
+func GetCSIOperationsInFlight(method string) float64 {
+	return getGaugeVecValue(csiOperationsInFlight, method)
+}
+
+func GetCSIOperationDurationCount(method string) uint64 {
+	dto := &ioprometheusclient.Metric{}
+	csiOperationDuration.WithLabelValues(method).(prometheus.Histogram).Write(dto)
+	return dto.GetHistogram().GetSampleCount()
+}
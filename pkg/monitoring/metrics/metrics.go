@@ -2,9 +2,13 @@ package metrics
 
 import "github.com/rhobs/operator-observability-toolkit/pkg/operatormetrics"
 
+// SetupMetrics registers the metrics of the operator and the CSI driver. The
+// metrics of the legacy provisioner are registered by SetupProvisionerMetrics.
 func SetupMetrics() error {
 	return operatormetrics.RegisterMetrics(
 		operatorMetrics,
+		csiMetrics,
+		operationMetrics,
 	)
 }
 
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	ioprometheusclient "github.com/prometheus/client_model/go"
+	"github.com/rhobs/operator-observability-toolkit/pkg/operatormetrics"
+)
+
+var (
+	operationMetrics = []operatormetrics.Metric{
+		operationConcurrencyLimit,
+		operationsRunning,
+		operationsQueued,
+		operationsRejected,
+	}
+
+	operationConcurrencyLimit = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_operation_concurrency_limit",
+			Help: "Maximum number of heavy operations of a type the HPP CSI driver runs at once on the node, 0 if unlimited",
+		},
+		[]string{"operation"},
+	)
+
+	operationsRunning = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_operations_running",
+			Help: "Number of heavy operations of a type the HPP CSI driver is currently running on the node",
+		},
+		[]string{"operation"},
+	)
+
+	operationsQueued = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_operations_queued",
+			Help: "Number of heavy operations of a type waiting for the concurrency limit of the HPP CSI driver",
+		},
+		[]string{"operation"},
+	)
+
+	operationsRejected = operatormetrics.NewCounterVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_operations_rejected_total",
+			Help: "Total number of heavy operations of a type rejected with ResourceExhausted because the concurrency limit of the HPP CSI driver was reached",
+		},
+		[]string{"operation"},
+	)
+)
+
+func SetOperationConcurrencyLimit(operation string, limit int) {
+	operationConcurrencyLimit.WithLabelValues(operation).Set(float64(limit))
+}
+
+func GetOperationConcurrencyLimit(operation string) float64 {
+	return getGaugeVecValue(operationConcurrencyLimit, operation)
+}
+
+func AddOperationsRunning(operation string, delta float64) {
+	operationsRunning.WithLabelValues(operation).Add(delta)
+}
+
+func GetOperationsRunning(operation string) float64 {
+	return getGaugeVecValue(operationsRunning, operation)
+}
+
+func AddOperationsQueued(operation string, delta float64) {
+	operationsQueued.WithLabelValues(operation).Add(delta)
+}
+
+func GetOperationsQueued(operation string) float64 {
+	return getGaugeVecValue(operationsQueued, operation)
+}
+
+func IncOperationsRejected(operation string) {
+	operationsRejected.WithLabelValues(operation).Inc()
+}
+
+func GetOperationsRejected(operation string) float64 {
+	dto := &ioprometheusclient.Metric{}
+	operationsRejected.WithLabelValues(operation).Write(dto)
+	return dto.GetCounter().GetValue()
+}
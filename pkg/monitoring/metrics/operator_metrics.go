@@ -1,13 +1,21 @@
 package metrics
 
 import (
-	"github.com/rhobs/operator-observability-toolkit/pkg/operatormetrics"
+	"github.com/prometheus/client_golang/prometheus"
 	ioprometheusclient "github.com/prometheus/client_model/go"
+	"github.com/rhobs/operator-observability-toolkit/pkg/operatormetrics"
 )
 
 var (
 	operatorMetrics = []operatormetrics.Metric{
 		poolPathSharedWithOs,
+		poolCapacityBytes,
+		poolAvailableBytes,
+		poolInodes,
+		poolAvailableInodes,
+		poolVolumeCount,
+		poolSnapshotCount,
+		volumeUsedBytes,
 	}
 
 	poolPathSharedWithOs = operatormetrics.NewGauge(
@@ -16,8 +24,74 @@ var (
 			Help: "HPP pool path sharing a filesystem with OS, fix to prevent HPP PVs from causing disk pressure and affecting node operation",
 		},
 	)
+
+	poolCapacityBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_pool_capacity_bytes",
+			Help: "Total capacity in bytes of the filesystem backing an HPP storage pool",
+		},
+		[]string{"pool"},
+	)
+
+	poolAvailableBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_pool_available_bytes",
+			Help: "Available bytes on the filesystem backing an HPP storage pool",
+		},
+		[]string{"pool"},
+	)
+
+	poolInodes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_pool_inodes",
+			Help: "Total number of inodes on the filesystem backing an HPP storage pool",
+		},
+		[]string{"pool"},
+	)
+
+	poolAvailableInodes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_pool_available_inodes",
+			Help: "Number of free inodes on the filesystem backing an HPP storage pool",
+		},
+		[]string{"pool"},
+	)
+
+	poolVolumeCount = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_pool_volumes",
+			Help: "Number of volumes in an HPP storage pool",
+		},
+		[]string{"pool"},
+	)
+
+	poolSnapshotCount = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_pool_snapshots",
+			Help: "Number of snapshots in an HPP storage pool",
+		},
+		[]string{"pool"},
+	)
+
+	volumeUsedBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_volume_used_bytes",
+			Help: "Bytes used by an HPP volume",
+		},
+		[]string{"pool", "volume"},
+	)
 )
 
+// PoolStats contains the filesystem statistics of a storage pool
+type PoolStats struct {
+	CapacityBytes   int64
+	AvailableBytes  int64
+	Inodes          int64
+	AvailableInodes int64
+	Volumes         int
+	Snapshots       int
+}
+
 // SetPoolPathSharedWithOs sets the poolPathSharedWithOs metric to a desired value
 func SetPoolPathSharedWithOs(value int) {
 	poolPathSharedWithOs.Set(float64(value))
@@ -28,3 +102,70 @@ func GetPoolPathSharedWithOs() float64 {
 	poolPathSharedWithOs.Write(dto)
 	return dto.GetGauge().GetValue()
 }
+
+// SetPoolStats sets the per pool metrics of the pool with the given name
+func SetPoolStats(pool string, stats PoolStats) {
+	poolCapacityBytes.WithLabelValues(pool).Set(float64(stats.CapacityBytes))
+	poolAvailableBytes.WithLabelValues(pool).Set(float64(stats.AvailableBytes))
+	poolInodes.WithLabelValues(pool).Set(float64(stats.Inodes))
+	poolAvailableInodes.WithLabelValues(pool).Set(float64(stats.AvailableInodes))
+	poolVolumeCount.WithLabelValues(pool).Set(float64(stats.Volumes))
+	poolSnapshotCount.WithLabelValues(pool).Set(float64(stats.Snapshots))
+}
+
+// GetPoolStats returns the per pool metrics of the pool with the given name
+func GetPoolStats(pool string) PoolStats {
+	return PoolStats{
+		CapacityBytes:   int64(getGaugeVecValue(poolCapacityBytes, pool)),
+		AvailableBytes:  int64(getGaugeVecValue(poolAvailableBytes, pool)),
+		Inodes:          int64(getGaugeVecValue(poolInodes, pool)),
+		AvailableInodes: int64(getGaugeVecValue(poolAvailableInodes, pool)),
+		Volumes:         int(getGaugeVecValue(poolVolumeCount, pool)),
+		Snapshots:       int(getGaugeVecValue(poolSnapshotCount, pool)),
+	}
+}
+
+// DeleteVolumeUsedBytes removes the used bytes of a volume that no longer
+// exists, so it stops being reported
+func DeleteVolumeUsedBytes(pool, volume string) {
+	volumeUsedBytes.DeleteLabelValues(pool, volume)
+}
+
+// SetVolumeUsedBytes sets the used bytes of a volume in a pool
+func SetVolumeUsedBytes(pool, volume string, value int64) {
+	volumeUsedBytes.WithLabelValues(pool, volume).Set(float64(value))
+}
+
+func GetVolumeUsedBytes(pool, volume string) float64 {
+	return getGaugeVecValue(volumeUsedBytes, pool, volume)
+}
+
+// GetVolumesWithUsedBytes returns the volumes of a pool whose used bytes are reported
+func GetVolumesWithUsedBytes(pool string) []string {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		volumeUsedBytes.Collect(ch)
+		close(ch)
+	}()
+	volumes := []string{}
+	for metric := range ch {
+		dto := &ioprometheusclient.Metric{}
+		if err := metric.Write(dto); err != nil {
+			continue
+		}
+		labels := map[string]string{}
+		for _, label := range dto.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["pool"] == pool {
+			volumes = append(volumes, labels["volume"])
+		}
+	}
+	return volumes
+}
+
+func getGaugeVecValue(vec *operatormetrics.GaugeVec, labels ...string) float64 {
+	dto := &ioprometheusclient.Metric{}
+	vec.WithLabelValues(labels...).Write(dto)
+	return dto.GetGauge().GetValue()
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ioprometheusclient "github.com/prometheus/client_model/go"
+	"github.com/rhobs/operator-observability-toolkit/pkg/operatormetrics"
+)
+
+var (
+	provisionerMetrics = []operatormetrics.Metric{
+		provisionerDeletionsBlocked,
+		provisionerOperations,
+		provisionerOperationDuration,
+		provisionerQueueDepth,
+	}
+
+	provisionerDeletionsBlocked = operatormetrics.NewCounterVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_provisioner_deletions_blocked_total",
+			Help: "Total number of times the legacy HPP provisioner deferred deleting a volume still in use on the node, by reason",
+		},
+		[]string{"reason"},
+	)
+
+	provisionerOperations = operatormetrics.NewCounterVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_provisioner_operations_total",
+			Help: "Total number of provision and delete operations of the legacy HPP provisioner, by storage class and outcome",
+		},
+		[]string{"operation", "storage_class", "outcome"},
+	)
+
+	provisionerOperationDuration = operatormetrics.NewHistogramVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_provisioner_operation_duration_seconds",
+			Help: "Duration in seconds of provision and delete operations of the legacy HPP provisioner, by storage class and outcome",
+		},
+		prometheus.HistogramOpts{
+			// Deletes remove whole directories, so go up to roughly half an hour.
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+		},
+		[]string{"operation", "storage_class", "outcome"},
+	)
+
+	provisionerQueueDepth = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: "kubevirt_hpp_provisioner_queue_depth",
+			Help: "Number of claims or volumes waiting in a work queue of the legacy HPP provisioner",
+		},
+		[]string{"queue"},
+	)
+)
+
+// SetupProvisionerMetrics registers the metrics of the legacy provisioner only.
+func SetupProvisionerMetrics() error {
+	return operatormetrics.RegisterMetrics(provisionerMetrics)
+}
+
+func IncProvisionerDeletionsBlocked(reason string) {
+	provisionerDeletionsBlocked.WithLabelValues(reason).Inc()
+}
+
+func GetProvisionerDeletionsBlocked(reason string) float64 {
+	dto := &ioprometheusclient.Metric{}
+	provisionerDeletionsBlocked.WithLabelValues(reason).Write(dto)
+	return dto.GetCounter().GetValue()
+}
+
+func ObserveProvisionerOperation(operation, storageClass, outcome string, duration time.Duration) {
+	provisionerOperations.WithLabelValues(operation, storageClass, outcome).Inc()
+	provisionerOperationDuration.WithLabelValues(operation, storageClass, outcome).Observe(duration.Seconds())
+}
+
+func GetProvisionerOperations(operation, storageClass, outcome string) float64 {
+	dto := &ioprometheusclient.Metric{}
+	provisionerOperations.WithLabelValues(operation, storageClass, outcome).Write(dto)
+	return dto.GetCounter().GetValue()
+}
+
+func GetProvisionerOperationDurationCount(operation, storageClass, outcome string) uint64 {
+	dto := &ioprometheusclient.Metric{}
+	provisionerOperationDuration.WithLabelValues(operation, storageClass, outcome).(prometheus.Histogram).Write(dto)
+	return dto.GetHistogram().GetSampleCount()
+}
+
+// ProvisionerQueueDepth returns the gauge of the depth of a work queue.
+func ProvisionerQueueDepth(queue string) prometheus.Gauge {
+	return provisionerQueueDepth.WithLabelValues(queue)
+}
+
+func GetProvisionerQueueDepth(queue string) float64 {
+	return getGaugeVecValue(provisionerQueueDepth, queue)
+}
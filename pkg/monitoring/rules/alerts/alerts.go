@@ -0,0 +1,37 @@
+package alerts
+
+import (
+	"fmt"
+
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/rhobs/operator-observability-toolkit/pkg/operatorrules"
+)
+
+const (
+	severityAlertLabelKey     = "severity"
+	healthImpactAlertLabelKey = "operator_health_impact"
+	partOfAlertLabelKey       = "kubernetes_operator_part_of"
+	componentAlertLabelKey    = "kubernetes_operator_component"
+
+	partOfAlertLabelValue    = "kubevirt"
+	componentAlertLabelValue = "hostpath-provisioner-operator"
+
+	runbookURLTemplate = "https://github.com/kubevirt/hostpath-provisioner/blob/main/docs/runbooks/%s.md"
+)
+
+func Register(registry *operatorrules.Registry) error {
+	alerts := [][]promv1.Rule{
+		csiAlerts,
+		poolAlerts,
+	}
+
+	for _, alertGroup := range alerts {
+		for i := range alertGroup {
+			alertGroup[i].Annotations["runbook_url"] = fmt.Sprintf(runbookURLTemplate, alertGroup[i].Alert)
+			alertGroup[i].Labels[partOfAlertLabelKey] = partOfAlertLabelValue
+			alertGroup[i].Labels[componentAlertLabelKey] = componentAlertLabelValue
+		}
+	}
+
+	return registry.RegisterAlerts(alerts...)
+}
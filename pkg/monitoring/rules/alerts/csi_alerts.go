@@ -0,0 +1,41 @@
+package alerts
+
+import (
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+)
+
+var csiAlerts = []promv1.Rule{
+	{
+		Alert: "HPPCSIOperationErrorRateHigh",
+		// Only count codes that point at a driver or node problem, callers retry
+		// NotFound, AlreadyExists and Aborted as part of the normal CSI flow.
+		Expr: intstr.FromString(`sum by (method) (rate(kubevirt_hpp_csi_operations_total{grpc_code=~"Internal|Unknown|Unavailable|DeadlineExceeded|ResourceExhausted|DataLoss"}[5m]))` +
+			` / sum by (method) (rate(kubevirt_hpp_csi_operations_total[5m])) > 0.05`),
+		For: ptr.To(promv1.Duration("15m")),
+		Annotations: map[string]string{
+			"summary":     "More than 5% of the {{ $labels.method }} calls to the HPP CSI driver fail",
+			"description": "The HPP CSI driver has been failing {{ $value | humanizePercentage }} of the {{ $labels.method }} calls for the last 15 minutes",
+		},
+		Labels: map[string]string{
+			severityAlertLabelKey:     "warning",
+			healthImpactAlertLabelKey: "warning",
+		},
+	},
+	{
+		Alert: "HPPCSIOperationLatencyHigh",
+		// CreateVolume and CreateSnapshot copy volume data when restoring or
+		// snapshotting, so they are expected to be slow.
+		Expr: intstr.FromString(`histogram_quantile(0.99, sum by (method, le) (rate(kubevirt_hpp_csi_operation_duration_seconds_bucket{method!~".*/(CreateVolume|CreateSnapshot)"}[10m]))) > 30`),
+		For:  ptr.To(promv1.Duration("15m")),
+		Annotations: map[string]string{
+			"summary":     "The HPP CSI driver takes more than 30 seconds to handle {{ $labels.method }} calls",
+			"description": "The 99th percentile latency of {{ $labels.method }} calls to the HPP CSI driver has been above 30 seconds for the last 15 minutes",
+		},
+		Labels: map[string]string{
+			severityAlertLabelKey:     "warning",
+			healthImpactAlertLabelKey: "none",
+		},
+	},
+}
@@ -0,0 +1,52 @@
+package alerts
+
+import (
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+)
+
+var poolAlerts = []promv1.Rule{
+	{
+		Alert: "HPPPoolAlmostFull",
+		Expr:  intstr.FromString(`kubevirt_hpp_pool_available_bytes / kubevirt_hpp_pool_capacity_bytes < 0.1`),
+		For:   ptr.To(promv1.Duration("5m")),
+		Annotations: map[string]string{
+			"summary":     "HPP storage pool {{ $labels.pool }} has less than 10% of its capacity available",
+			"description": "Only {{ $value | humanizePercentage }} of the capacity of HPP storage pool {{ $labels.pool }} on {{ $labels.instance }} is available",
+		},
+		Labels: map[string]string{
+			severityAlertLabelKey:     "warning",
+			healthImpactAlertLabelKey: "none",
+		},
+	},
+	{
+		Alert: "HPPSharingPoolPathWithOS",
+		Expr:  intstr.FromString(`kubevirt_hpp_pool_path_shared_with_os == 1`),
+		For:   ptr.To(promv1.Duration("1m")),
+		Annotations: map[string]string{
+			"summary":     "HPP pool path sharing a filesystem with OS, fix to prevent HPP PVs from causing disk pressure and affecting node operation",
+			"description": "A storage pool of the HPP CSI driver on {{ $labels.instance }} is on the same filesystem as the OS",
+		},
+		Labels: map[string]string{
+			severityAlertLabelKey:     "warning",
+			healthImpactAlertLabelKey: "none",
+		},
+	},
+	{
+		Alert: "HPPOrphanedVolumesPresent",
+		// Volume directories are named after the PV they were created for, so a
+		// directory without a matching PV reported by kube-state-metrics is orphaned.
+		Expr: intstr.FromString(`count by (instance, pool) (kubevirt_hpp_volume_used_bytes unless on (volume)` +
+			` label_replace(kube_persistentvolume_info, "volume", "$1", "persistentvolume", "(.*)")) > 0`),
+		For: ptr.To(promv1.Duration("1h")),
+		Annotations: map[string]string{
+			"summary":     "HPP storage pool {{ $labels.pool }} contains volumes without a persistent volume",
+			"description": "HPP storage pool {{ $labels.pool }} on {{ $labels.instance }} contains {{ $value }} volume directories that do not belong to any persistent volume",
+		},
+		Labels: map[string]string{
+			severityAlertLabelKey:     "info",
+			healthImpactAlertLabelKey: "none",
+		},
+	},
+}
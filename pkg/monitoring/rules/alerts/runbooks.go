@@ -0,0 +1,56 @@
+package alerts
+
+// Runbook describes how to handle a firing alert
+type Runbook struct {
+	Meaning    string
+	Impact     string
+	Diagnosis  string
+	Mitigation string
+}
+
+var runbooks = map[string]Runbook{
+	"HPPCSIOperationErrorRateHigh": {
+		Meaning: "More than 5% of the calls to one of the CSI methods of the HPP CSI driver fail with an error " +
+			"that points at a problem in the driver or on the node.",
+		Impact: "Volumes and snapshots using the HPP storage class cannot be created, deleted, mounted or unmounted reliably.",
+		Diagnosis: "Check which method fails in the `method` label of the alert, and look for errors in the logs of the " +
+			"`hostpath-provisioner` container of the HPP CSI driver pod on the affected node:\n\n" +
+			"```bash\n$ kubectl logs -n <namespace> <hpp-csi-pod> -c hostpath-provisioner\n```",
+		Mitigation: "Fix the cause of the errors reported in the logs, usually a storage pool that is full, missing or " +
+			"not writable.",
+	},
+	"HPPCSIOperationLatencyHigh": {
+		Meaning: "The 99th percentile latency of one of the CSI methods of the HPP CSI driver is above 30 seconds.",
+		Impact:  "Pods using HPP volumes are slow to start and to terminate.",
+		Diagnosis: "Check the `kubevirt_hpp_csi_operation_duration_seconds` metric of the affected method, and the load " +
+			"of the disk backing the storage pools on the affected node.",
+		Mitigation: "Reduce the I/O load on the storage pool, or move storage pools to faster disks.",
+	},
+	"HPPPoolAlmostFull": {
+		Meaning: "Less than 10% of the capacity of the filesystem backing an HPP storage pool is available.",
+		Impact: "HPP volumes share the capacity of the storage pool, so workloads writing to any volume in the pool " +
+			"will fail once the pool is full.",
+		Diagnosis:  "Check the `kubevirt_hpp_volume_used_bytes` metric of the volumes in the pool to find the biggest volumes.",
+		Mitigation: "Delete unused volumes and snapshots from the pool, or extend the filesystem backing the pool.",
+	},
+	"HPPSharingPoolPathWithOS": {
+		Meaning: "An HPP storage pool is on the same filesystem as the operating system of the node.",
+		Impact: "Writing to HPP volumes can fill the root filesystem of the node, causing disk pressure and affecting " +
+			"node operation.",
+		Diagnosis: "Check the filesystem of the storage pool path on the affected node:\n\n" +
+			"```bash\n$ findmnt -T <pool path>\n```",
+		Mitigation: "Move the storage pool to a dedicated disk or filesystem.",
+	},
+	"HPPOrphanedVolumesPresent": {
+		Meaning: "An HPP storage pool contains volume directories that do not belong to any persistent volume.",
+		Impact:  "Orphaned volumes use capacity of the storage pool that is not accounted for by any persistent volume.",
+		Diagnosis: "Compare the volume directories in the storage pool with the persistent volumes in the cluster:\n\n" +
+			"```bash\n$ kubectl get pv <volume name>\n```",
+		Mitigation: "Back up any data that is still needed, and delete the orphaned volume directories from the storage pool.",
+	},
+}
+
+// ListRunbooks returns the runbooks of the alerts by alert name
+func ListRunbooks() map[string]Runbook {
+	return runbooks
+}
@@ -0,0 +1,37 @@
+package rules
+
+import (
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/rhobs/operator-observability-toolkit/pkg/operatorrules"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/rules/alerts"
+)
+
+const (
+	ruleName = "prometheus-hpp-csi-rules"
+)
+
+var operatorRegistry = operatorrules.NewRegistry()
+
+func SetupRules() error {
+	return alerts.Register(operatorRegistry)
+}
+
+// BuildPrometheusRule returns a PrometheusRule in the given namespace containing all registered alerts
+func BuildPrometheusRule(namespace string) (*promv1.PrometheusRule, error) {
+	return operatorRegistry.BuildPrometheusRule(
+		ruleName,
+		namespace,
+		map[string]string{
+			"prometheus.kubevirt.io": "true",
+		},
+	)
+}
+
+func ListAlerts() []promv1.Rule {
+	return operatorRegistry.ListAlerts()
+}
+
+func ListRunbooks() map[string]alerts.Runbook {
+	return alerts.ListRunbooks()
+}
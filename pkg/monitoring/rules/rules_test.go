@@ -0,0 +1,78 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rhobs/operator-observability-toolkit/pkg/operatormetrics"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/metrics"
+)
+
+var (
+	metricNameRegex = regexp.MustCompile(`\b(kubevirt_hpp_[a-z0-9_]+|kube_[a-z0-9_]+)\b`)
+
+	// Metrics that are not exposed by the HPP, but by kube-state-metrics
+	externalMetrics = map[string]bool{
+		"kube_persistentvolume_info": true,
+	}
+)
+
+func TestAlerts(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(metrics.SetupMetrics()).To(Succeed())
+	Expect(metrics.SetupProvisionerMetrics()).To(Succeed())
+	Expect(SetupRules()).To(Succeed())
+
+	metricNames := map[string]bool{}
+	for _, metric := range metrics.ListMetrics() {
+		name := metric.GetOpts().Name
+		metricNames[name] = true
+		if metric.GetType() == operatormetrics.HistogramType || metric.GetType() == operatormetrics.HistogramVecType {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				metricNames[name+suffix] = true
+			}
+		}
+	}
+
+	alerts := ListAlerts()
+	Expect(alerts).ToNot(BeEmpty())
+	runbooks := ListRunbooks()
+	for _, alert := range alerts {
+		t.Run(alert.Alert, func(t *testing.T) {
+			RegisterTestingT(t)
+			Expect(alert.For).ToNot(BeNil())
+			Expect(alert.Annotations).To(HaveKeyWithValue("summary", Not(BeEmpty())))
+			Expect(alert.Annotations).To(HaveKeyWithValue("description", Not(BeEmpty())))
+			Expect(alert.Annotations).To(HaveKeyWithValue("runbook_url", ContainSubstring(alert.Alert)))
+			Expect(alert.Labels).To(HaveKeyWithValue("severity", BeElementOf("info", "warning", "critical")))
+			Expect(alert.Labels).To(HaveKeyWithValue("operator_health_impact", BeElementOf("none", "warning", "critical")))
+			Expect(alert.Labels).To(HaveKeyWithValue("kubernetes_operator_part_of", "kubevirt"))
+			Expect(alert.Labels).To(HaveKeyWithValue("kubernetes_operator_component", "hostpath-provisioner-operator"))
+			Expect(runbooks).To(HaveKey(alert.Alert))
+
+			expr := alert.Expr.String()
+			Expect(strings.Count(expr, "(")).To(Equal(strings.Count(expr, ")")), "unbalanced parentheses in %s", expr)
+			usedMetrics := metricNameRegex.FindAllString(expr, -1)
+			Expect(usedMetrics).ToNot(BeEmpty())
+			for _, name := range usedMetrics {
+				Expect(metricNames[name] || externalMetrics[name]).To(BeTrue(), fmt.Sprintf("unknown metric %s in %s", name, expr))
+			}
+		})
+	}
+}
+
+func TestBuildPrometheusRule(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(SetupRules()).To(Succeed())
+
+	promRule, err := BuildPrometheusRule("test-namespace")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(promRule.Name).To(Equal(ruleName))
+	Expect(promRule.Namespace).To(Equal("test-namespace"))
+	Expect(promRule.Spec.Groups).To(HaveLen(1))
+	Expect(promRule.Spec.Groups[0].Rules).To(HaveLen(len(ListAlerts())))
+}
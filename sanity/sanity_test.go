@@ -22,6 +22,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"kubevirt.io/hostpath-provisioner/pkg/hostpath"
@@ -53,14 +54,22 @@ func TestMyDriver(t *testing.T) {
 	cfg.DriverName = "hostpath.csi.kubevirt.io"
 	cfg.Version = "test-version"
 	cfg.NodeID = "testnode"
+	cfg.ShutdownTimeout = 5 * time.Second
 
 	driver, err := hostpath.NewHostPathDriver(context.TODO(), cfg, fmt.Sprintf(TestDatadirValue, volumeDir, snapshotDir))
 	hostpath.CopyReflinkFunc = regularCopy
 	Expect(err).ToNot(HaveOccurred())
 
+	ctx, cancel := context.WithCancel(context.Background())
+	// The error of Run is checked in the test goroutine, a failed assertion
+	// in another goroutine would not fail the test but crash it.
+	runErr := make(chan error, 1)
 	go func() {
-		err := driver.Run()
-		Expect(err).ToNot(HaveOccurred())
+		runErr <- driver.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		Expect(<-runErr).ToNot(HaveOccurred())
 	}()
 
 	testConfig := sanity.NewTestConfig()
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/rhobs/operator-observability-toolkit/pkg/docs"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/rules"
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/rules/alerts"
+)
+
+const tpl = `# Hostpath Provisioner Alerts
+
+The following alerts are recommended for monitoring the HPP CSI driver, they are
+based on the metrics described in [metrics.md](metrics.md).
+
+{{- range . }}
+
+### {{.Name}}
+**Summary:** {{ index .Annotations "summary" }}.
+
+**Description:** {{ index .Annotations "description" }}.
+
+**Severity:** {{ index .Labels "severity" }}.
+
+**Runbook:** [{{ .Name }}](runbooks/{{ .Name }}.md).
+{{- if .For }}
+
+**For:** {{ .For }}.
+{{- end }}
+
+**Expression:**
+` + "```" + `
+{{ .Expr }}
+` + "```" + `
+{{- end }}
+
+## Developing new alerts
+
+All alerts documented here are auto-generated and reflect exactly what is being
+exposed. After developing new alerts or changing old ones please regenerate
+this document.
+`
+
+const runbookTpl = `# {{ .Name }}
+
+## Meaning
+
+{{ .Meaning }}
+
+## Impact
+
+{{ .Impact }}
+
+## Diagnosis
+
+{{ .Diagnosis }}
+
+## Mitigation
+
+{{ .Mitigation }}
+`
+
+func main() {
+	runbooksDir := flag.String("runbooks-dir", "", "When set, write a runbook for every alert to this directory")
+	flag.Parse()
+
+	err := rules.SetupRules()
+	if err != nil {
+		panic(err)
+	}
+
+	if *runbooksDir != "" {
+		if err := writeRunbooks(*runbooksDir); err != nil {
+			panic(err)
+		}
+	}
+
+	docsString := docs.BuildAlertsDocsWithCustomTemplate(rules.ListAlerts(), tpl)
+	fmt.Print(docsString)
+}
+
+func writeRunbooks(dir string) error {
+	t := template.Must(template.New("runbook").Parse(runbookTpl))
+	runbooks := rules.ListRunbooks()
+	for _, alert := range rules.ListAlerts() {
+		runbook, ok := runbooks[alert.Alert]
+		if !ok {
+			return fmt.Errorf("no runbook for alert %s", alert.Alert)
+		}
+		f, err := os.Create(filepath.Join(dir, alert.Alert+".md"))
+		if err != nil {
+			return err
+		}
+		err = t.Execute(f, struct {
+			Name string
+			alerts.Runbook
+		}{alert.Alert, runbook})
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
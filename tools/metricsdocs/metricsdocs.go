@@ -15,6 +15,10 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	err = metrics.SetupProvisionerMetrics()
+	if err != nil {
+		panic(err)
+	}
 
 	metricsList := metrics.ListMetrics()
 
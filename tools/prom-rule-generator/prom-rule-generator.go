@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	"kubevirt.io/hostpath-provisioner/pkg/monitoring/rules"
+)
+
+func main() {
+	namespace := flag.String("namespace", "default", "The namespace of the generated PrometheusRule")
+	flag.Parse()
+
+	err := rules.SetupRules()
+	if err != nil {
+		panic(err)
+	}
+
+	promRule, err := rules.BuildPrometheusRule(*namespace)
+	if err != nil {
+		panic(err)
+	}
+
+	b, err := yaml.Marshal(promRule)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(string(b))
+}